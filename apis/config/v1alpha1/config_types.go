@@ -20,6 +20,33 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// TransferSCP uploads files with the remote scp binary.
+	TransferSCP = "scp"
+	// TransferSFTP uploads files with the SFTP subsystem.
+	TransferSFTP = "sftp"
+
+	// ShellWindowsPowerShell runs scripts with the builtin Windows PowerShell 5.1.
+	ShellWindowsPowerShell = "powershell"
+	// ShellPowerShellCore runs scripts with PowerShell 7.
+	ShellPowerShellCore = "pwsh"
+
+	// ProviderLibvirt runs the Windows node as a libvirt domain.
+	ProviderLibvirt = "libvirt"
+	// ProviderNone uses an existing Windows host reachable over SSH.
+	ProviderNone = "none"
+
+	// DiskBusSATA attaches the disks on a SATA controller, supported by Windows out of the box.
+	DiskBusSATA = "sata"
+	// DiskBusVirtio attaches the disks as virtio devices, requires the virtio-win drivers.
+	DiskBusVirtio = "virtio"
+
+	// ShareVirtioFS exposes the host directory through a virtiofs device of the domain.
+	ShareVirtioFS = "virtiofs"
+	// ShareSMB maps a Samba share served by the host.
+	ShareSMB = "smb"
+)
+
 type SSHSpec struct {
 	// Username set the Windows user
 	Username string `json:"username,omitempty"`
@@ -32,9 +59,32 @@ type SSHSpec struct {
 
 	// PrivateKey is the SSH private path for this user
 	PrivateKey string `json:"privateKey,omitempty"`
+
+	// Transfer is the file transfer protocol, scp or sftp.
+	// SFTP is used when the node supports it and the field is empty.
+	Transfer string `json:"transfer,omitempty"`
+
+	// Shell is the PowerShell binary running the scripts, powershell or pwsh.
+	// Windows PowerShell is used when the field is empty.
+	Shell string `json:"shell,omitempty"`
+
+	// MaxSessions bounds the sessions opened concurrently on the connection,
+	// keep it under the MaxSessions of the node sshd (10 by default).
+	MaxSessions int `json:"maxSessions,omitempty"`
+
+	// KeepAlive is the interval between keepalive requests, like 30s. Use 0 to disable.
+	KeepAlive string `json:"keepAlive,omitempty"`
+
+	// PersistentShell runs the scripts in one long-lived PowerShell process, so
+	// variables, modules and the working directory persist across steps.
+	PersistentShell bool `json:"persistentShell,omitempty"`
 }
 
 type VirtualizationSpec struct {
+	// Provider is the hypervisor running the Windows node, libvirt or none
+	// for an existing host. Libvirt is used when the field is empty.
+	Provider string `json:"provider,omitempty"`
+
 	// KVM Qemu URI is the path of qemu socket URI
 	KvmQemuURI string `json:"kvmQemuURI,omitempty"`
 	// DiskPath is the path of the Windows qcow2 file.
@@ -43,6 +93,123 @@ type VirtualizationSpec struct {
 
 	// SSH stored the Windows VM credentials.
 	SSH *SSHSpec `json:"ssh,omitempty"`
+
+	// Emulator is the path of the QEMU binary, libvirt picks the host default when empty.
+	Emulator string `json:"emulator,omitempty"`
+
+	// Machine is the QEMU machine type, like pc-q35-8.2. The q35 alias is used when empty.
+	Machine string `json:"machine,omitempty"`
+
+	// DiskBus is the bus of the Windows disk, sata or virtio. SATA is used when empty.
+	DiskBus string `json:"diskBus,omitempty"`
+
+	// ExtraDisks are attached after the Windows disk, like a virtio-win ISO.
+	ExtraDisks []DiskSpec `json:"extraDisks,omitempty"`
+
+	// VideoModel is the model of the video device, like virtio or vga. QXL is used when empty.
+	VideoModel string `json:"videoModel,omitempty"`
+
+	// XMLPatch is a domain XML merged into the generated definition, its values
+	// replace the generated ones and its devices replace the generated device with
+	// the same key, like the disk target, or are appended.
+	XMLPatch string `json:"xmlPatch,omitempty"`
+
+	// Networks are the libvirt networks of the Windows domain, created and removed
+	// by swdt unless they are marked as existing.
+	Networks NetworksSpec `json:"networks,omitempty"`
+
+	// StaticIP is reserved for the Windows machine with a DHCP host entry on the
+	// private network, so the node keeps its address across boots.
+	StaticIP string `json:"staticIP,omitempty"`
+
+	// Bootstrap is the configuration applied by the first-boot agent of the image,
+	// from a config medium attached to the domain.
+	Bootstrap *BootstrapSpec `json:"bootstrap,omitempty"`
+
+	// Shares are the host directories exposed to the Windows node, mounted at
+	// their drive letter by swdt setup.
+	Shares []ShareSpec `json:"shares,omitempty"`
+}
+
+type ShareSpec struct {
+	// Name is the virtiofs tag or the name of the Samba share on the host.
+	Name string `json:"name"`
+
+	// HostPath is the absolute path of the host directory. The provisioners with
+	// a source under it are copied from the share on the node. For smb it must be
+	// the directory exported by the Samba share.
+	HostPath string `json:"hostPath"`
+
+	// DriveLetter is the drive the node mounts the share at, from D to Z.
+	DriveLetter string `json:"driveLetter"`
+
+	// Protocol is virtiofs or smb, virtiofs is used when empty. Virtiofs requires
+	// the virtio-win guest tools and WinFsp on the node, smb a Samba share
+	// exporting the host path.
+	Protocol string `json:"protocol,omitempty"`
+
+	// Server is the address of the Samba server, the default gateway of the node,
+	// the host on the libvirt NAT network, is used when empty.
+	Server string `json:"server,omitempty"`
+
+	// Username and Password authenticate to the Samba share.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type BootstrapSpec struct {
+	// Hostname is the computer name of the node, kept from the image when empty.
+	Hostname string `json:"hostname,omitempty"`
+
+	// AuthorizedKey is the path of the SSH public key authorized for the Administrator,
+	// the ssh.privateKey with a .pub extension is used when empty.
+	AuthorizedKey string `json:"authorizedKey,omitempty"`
+
+	// FirstBootScript is the path of a PowerShell script run once after the
+	// configuration is applied.
+	FirstBootScript string `json:"firstBootScript,omitempty"`
+}
+
+type NetworksSpec struct {
+	// NAT is the network giving the Windows node access to the internet.
+	NAT NetworkSpec `json:"nat,omitempty"`
+
+	// Private is the isolated network shared with the control plane, minikube
+	// is started on it.
+	Private NetworkSpec `json:"private,omitempty"`
+}
+
+type NetworkSpec struct {
+	// Name of the libvirt network, swdt-<cluster>-nat or swdt-<cluster>-private when empty.
+	Name string `json:"name,omitempty"`
+
+	// Subnet of the network in CIDR notation, like 192.168.125.0/24. The host
+	// takes its first address as gateway. The first free 192.168.x.0/24 subnet
+	// from 192.168.124.0/24 is picked when empty.
+	Subnet string `json:"subnet,omitempty"`
+
+	// DHCPStart and DHCPEnd bound the leased addresses, the addresses after the
+	// gateway are leased when empty.
+	DHCPStart string `json:"dhcpStart,omitempty"`
+	DHCPEnd   string `json:"dhcpEnd,omitempty"`
+
+	// Existing reuses a network already defined on the host, like the minikube one,
+	// instead of creating it. Existing networks are never removed.
+	Existing bool `json:"existing,omitempty"`
+}
+
+type DiskSpec struct {
+	// Path of the disk image or ISO file.
+	Path string `json:"path"`
+
+	// Format of the image, qcow2 or raw. Raw is used for cdrom devices, qcow2 otherwise.
+	Format string `json:"format,omitempty"`
+
+	// Device is disk or cdrom, disk is used when empty.
+	Device string `json:"device,omitempty"`
+
+	// Bus of the disk, sata or virtio. The Windows disk bus is used when empty.
+	Bus string `json:"bus,omitempty"`
 }
 
 type AuxiliarySpec struct {
@@ -104,8 +271,21 @@ type ClusterSpec struct {
 	CalicoVersion string           `json:"calicoVersion,omitempty"`
 }
 
-// ClusterStatus -- tbd
-type ClusterStatus struct{}
+// ClusterStatus is the recorded state of the cluster, refreshed by the commands
+// changing the Windows machine.
+type ClusterStatus struct {
+	// State is the power state of the Windows machine.
+	State string `json:"state,omitempty"`
+
+	// Leases are the leased IP addresses by hostname.
+	Leases map[string]string `json:"leases,omitempty"`
+
+	// Snapshot is the current snapshot of the Windows machine.
+	Snapshot string `json:"snapshot,omitempty"`
+
+	// UpdatedAt is the time of the last refresh.
+	UpdatedAt metav1.Time `json:"updatedAt,omitempty"`
+}
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
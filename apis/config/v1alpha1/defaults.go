@@ -31,4 +31,25 @@ func (c *ClusterSpec) Defaults() {
 	if c.Workload.Auxiliary.ChocoPackages == nil {
 		c.Workload.Auxiliary.ChocoPackages = &[]string{}
 	}
+	if c.Workload.Virtualization.Provider == "" {
+		c.Workload.Virtualization.Provider = ProviderLibvirt
+	}
+	for i := range c.Workload.Virtualization.Shares {
+		if c.Workload.Virtualization.Shares[i].Protocol == "" {
+			c.Workload.Virtualization.Shares[i].Protocol = ShareVirtioFS
+		}
+	}
+}
+
+// Defaults sets the names of the networks created by swdt, their subnets are picked
+// when they are defined.
+func (n *NetworksSpec) Defaults(nat, private string) {
+	n.NAT.defaults(nat)
+	n.Private.defaults(private)
+}
+
+func (n *NetworkSpec) defaults(name string) {
+	if n.Name == "" {
+		n.Name = name
+	}
 }
@@ -17,10 +17,14 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
 	"github.com/spf13/cobra"
+	"os"
 	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
 	"swdt/pkg/drivers"
 	"swdt/pkg/executors/exec"
+	"swdt/pkg/executors/iface"
 )
 
 // destroyCmd represents the destroy command
@@ -47,17 +51,57 @@ func RunDestroy(cmd *cobra.Command, args []string) error {
 	}
 
 	if config.Spec.ControlPlane.Minikube {
-		e := exec.NewLocalExecutor()
-		go exec.EnableOutput(nil, e.Stdout)
-		return e.Run("minikube delete --purge", nil)
+		e := newLocalExecutor()
+		cmd := iface.NewCommand("minikube", "delete", "-p", controlPlaneHost(config))
+		if err = e.Run(cmd, iface.Streams{Stdout: os.Stdout, Stderr: os.Stderr}); err != nil {
+			return err
+		}
+	}
+
+	// Remove the networks once the machines using them are gone
+	if err = removeNetworks(config); err != nil {
+		return err
+	}
+	return removeState(config)
+}
+
+// removeState deletes the state directory of the cluster, so it is no longer listed.
+func removeState(cluster *v1alpha1.Cluster) error {
+	if plan != nil {
+		plan.Record(exec.TargetLocal, fmt.Sprintf("remove the state directory %s", config.StateDir(cluster)))
+		return nil
+	}
+	return config.RemoveState(cluster)
+}
+
+// removeNetworks deletes the networks created for the Windows machine.
+func removeNetworks(config *v1alpha1.Cluster) error {
+	if plan != nil {
+		networks := drivers.Networks(config)
+		plan.Record(exec.TargetLibvirt, fmt.Sprintf("remove the networks %s and %s unless existing or in use", networks.NAT.Name, networks.Private.Name))
+		return nil
+	}
+	provider, err := newProvider(config)
+	if err != nil {
+		return err
+	}
+	defer closeProvider(provider)
+	if networker, ok := provider.(drivers.Networker); ok {
+		return networker.RemoveNetworks()
 	}
 	return nil
 }
 
 func destroyWindowsDomain(config *v1alpha1.Cluster) error {
-	drv, err := drivers.NewDriver(config)
+	if plan != nil {
+		plan.Record(exec.TargetLibvirt, "remove the Windows domain")
+		plan.Record(exec.TargetLibvirt, fmt.Sprintf("delete the overlay volume %s and stop pool %s", drivers.OverlayPath(config), drivers.StoragePool(config)))
+		return nil
+	}
+	provider, err := newProvider(config)
 	if err != nil {
 		return err
 	}
-	return drv.KvmDriver.Remove()
+	defer closeProvider(provider)
+	return provider.Remove()
 }
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"regexp"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/executors/exec"
+	"swdt/pkg/executors/iface"
+	ifacer "swdt/pkg/pwsh/iface"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// plan records the actions of the command when --dry-run is set.
+	plan *exec.Plan
+
+	// dryRunResults are canned outputs for the commands driving the next steps.
+	dryRunResults = []exec.Result{
+		{
+			Match:  regexp.MustCompile(`token create --print-join-command`),
+			Output: "kubeadm join control-plane.minikube.internal:8443 --token <token> --discovery-token-ca-cert-hash <hash>",
+		},
+	}
+)
+
+// enableDryRun creates the plan when the dry-run flag is set.
+func enableDryRun(cmd *cobra.Command, args []string) error {
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		plan = &exec.Plan{}
+	}
+	return nil
+}
+
+// printPlan writes the recorded actions after a dry-run.
+func printPlan(cmd *cobra.Command, args []string) {
+	if plan != nil {
+		plan.Print(cmd.OutOrStdout())
+	}
+}
+
+// newLocalExecutor returns the local executor, recording the commands in dry-run
+// or in the cassette when enabled. The executor is wrapped by the middlewares.
+func newLocalExecutor() iface.LocalExecutor {
+	if plan != nil {
+		return exec.NewDryRunLocalExecutor(plan, dryRunResults...)
+	}
+	local := exec.NewLocalExecutor()
+	if cassette != nil {
+		local = exec.NewRecordingLocalExecutor(local, cassette, redactor)
+	}
+	return exec.NewMiddlewareLocalExecutor(local, middlewares...)
+}
+
+// newRunner returns the runner connected to the node, recording the commands in dry-run
+// or in the cassette when enabled. The executors are wrapped by the middlewares.
+func newRunner[R ifacer.RunnerInterface](ssh *v1alpha1.SSHSpec, run R) (*ifacer.Runner[R], error) {
+	if plan != nil {
+		return ifacer.NewDryRunner(plan, run, dryRunResults...), nil
+	}
+	remote := exec.NewRemoteExecutor(ssh)
+	if cassette != nil {
+		remote = exec.NewRecordingExecutor(remote, cassette, redactor)
+	}
+	redactor.AddSecret(ssh.Password)
+	return ifacer.NewRunnerWithExecutors(exec.NewMiddlewareExecutor(remote, middlewares...), newLocalExecutor(), run)
+}
@@ -0,0 +1,282 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"swdt/pkg/drivers"
+	"swdt/pkg/executors/exec"
+	"swdt/pkg/executors/iface"
+	"swdt/pkg/templates"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// Orphan kinds found outside the provider.
+const (
+	orphanProfile = "profile"
+	orphanState   = "state"
+	orphanFile    = "file"
+)
+
+// orphanOrder removes the domains before their overlay volumes and the minikube
+// profiles, all before the networks they use, and the volumes before the state
+// directories holding them.
+var orphanOrder = map[string]int{
+	drivers.OrphanDomain:  0,
+	drivers.OrphanVolume:  1,
+	orphanProfile:         2,
+	drivers.OrphanNetwork: 3,
+	orphanState:           4,
+	orphanFile:            5,
+}
+
+// tempFiles returns the temporary files written by swdt.
+var tempFiles = templates.TempFiles
+
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove the host resources left by unknown clusters",
+	Long: `Find the libvirt domains, overlay volumes and networks, minikube profiles, state directories and
+temporary files created by swdt that no known cluster owns, and remove them after confirmation.
+
+A cluster is known when its status was recorded by a successful start, when its start began less
+than an hour ago, or when it is the cluster of the configuration. The domains are matched through the
+cluster and the owner tagged in their libvirt metadata, the resources of other users sharing the
+libvirt daemon are never removed. Use --dry-run to list the orphans without removing them.`,
+	Args: cobra.NoArgs,
+	RunE: RunGC,
+}
+
+func init() {
+	gcCmd.Flags().BoolP("yes", "y", false, "Remove the orphans without confirmation.")
+}
+
+func RunGC(cmd *cobra.Command, args []string) error {
+	cluster, err := loadConfiguration(cmd)
+	if err != nil {
+		return err
+	}
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+	known, err := knownClusters(cluster)
+	if err != nil {
+		return err
+	}
+
+	provider, err := newProvider(cluster)
+	if err != nil {
+		return err
+	}
+	defer closeProvider(provider)
+	orphans, err := findOrphans(provider, cluster, known)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if len(orphans) == 0 {
+		_, _ = fmt.Fprintln(out, "No orphan resources found.")
+		return nil
+	}
+	if err = printOrphans(out, orphans); err != nil {
+		return err
+	}
+	if plan == nil && !yes && !confirm(cmd.InOrStdin(), out, fmt.Sprintf("Remove the %d orphan resources?", len(orphans))) {
+		return nil
+	}
+	return removeOrphans(provider, orphans)
+}
+
+// knownClusters returns the clusters with a recorded status, the ones whose state
+// directory is younger than drivers.OrphanAge since start creates it first, and the
+// configured one.
+func knownClusters(cluster *v1alpha1.Cluster) ([]*v1alpha1.Cluster, error) {
+	clusters, err := config.ListClusters()
+	if err != nil {
+		return nil, err
+	}
+	known := []*v1alpha1.Cluster{cluster}
+	for _, listed := range clusters {
+		if listed.Name == config.ClusterName(cluster) {
+			continue
+		}
+		if !listed.Status.UpdatedAt.IsZero() {
+			known = append(known, listed)
+		} else if info, err := os.Stat(config.StateDir(listed)); err == nil && time.Since(info.ModTime()) <= drivers.OrphanAge {
+			known = append(known, listed)
+		}
+	}
+	return known, nil
+}
+
+// findOrphans returns the orphans of the provider, the minikube profiles, the state
+// directories and the temporary files no known cluster owns, in removal order. The
+// host is inspected in dry-run too, only the removals are recorded.
+func findOrphans(provider drivers.Provider, cluster *v1alpha1.Cluster, known []*v1alpha1.Cluster) ([]drivers.Orphan, error) {
+	var orphans []drivers.Orphan
+	if collector, ok := provider.(drivers.Collector); ok {
+		found, err := collector.Orphans(known)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, found...)
+	}
+
+	clusters, profiles := map[string]bool{}, map[string]bool{}
+	for _, owner := range known {
+		clusters[config.ClusterName(owner)] = true
+		profiles[config.MinikubeProfile(owner)] = true
+	}
+	if cluster.Spec.ControlPlane.Minikube {
+		names, err := minikubeProfiles(exec.NewLocalExecutor())
+		if err != nil {
+			klog.Warningf("Unable to list the minikube profiles: %v", err)
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name, config.ResourcePrefix) && !profiles[name] {
+				orphans = append(orphans, drivers.Orphan{Kind: orphanProfile, Name: name})
+			}
+		}
+	}
+
+	states, err := config.ListClusters()
+	if err != nil {
+		return nil, err
+	}
+	for _, state := range states {
+		if !clusters[state.Name] {
+			orphans = append(orphans, drivers.Orphan{Kind: orphanState, Name: config.StateDir(state), Cluster: state.Name})
+		}
+	}
+
+	files, err := tempFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > drivers.OrphanAge {
+			orphans = append(orphans, drivers.Orphan{Kind: orphanFile, Name: file})
+		}
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		return orphanOrder[orphans[i].Kind] < orphanOrder[orphans[j].Kind]
+	})
+	return orphans, nil
+}
+
+// minikubeProfiles returns the names of the minikube profiles, the invalid ones included.
+func minikubeProfiles(local iface.LocalExecutor) ([]string, error) {
+	var stdout bytes.Buffer
+	err := local.Run(iface.NewCommand("minikube", "profile", "list", "-o", "json"), iface.Streams{Stdout: &stdout})
+	var list struct {
+		Valid   []struct{ Name string } `json:"valid"`
+		Invalid []struct{ Name string } `json:"invalid"`
+	}
+	// minikube exits with an error when no profile exists, its output is still parsed
+	if jerr := json.Unmarshal(stdout.Bytes(), &list); jerr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed parsing the minikube profiles: %w", jerr)
+	}
+	var names []string
+	for _, profile := range append(list.Valid, list.Invalid...) {
+		names = append(names, profile.Name)
+	}
+	return names, nil
+}
+
+// printOrphans writes the table of the orphans.
+func printOrphans(out io.Writer, orphans []drivers.Orphan) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KIND\tNAME\tCLUSTER")
+	for _, orphan := range orphans {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", orphan.Kind, orphan.Name, orphan.Cluster)
+	}
+	return w.Flush()
+}
+
+// confirm asks the question and reports whether the answer is yes.
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	_, _ = fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// removeOrphans deletes the orphans in order, the failures are returned once all
+// the orphans were tried.
+func removeOrphans(provider drivers.Provider, orphans []drivers.Orphan) error {
+	var errs []error
+	for _, orphan := range orphans {
+		if plan != nil {
+			plan.Record(orphanTarget(orphan), fmt.Sprintf("remove the orphan %s %s", orphan.Kind, orphan.Name))
+			continue
+		}
+		klog.Info(resc.Sprintf("Removing the orphan %s %s", orphan.Kind, orphan.Name))
+		if err := removeOrphan(provider, orphan); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", orphan.Kind, orphan.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// orphanTarget returns the plan target removing the orphan.
+func orphanTarget(orphan drivers.Orphan) string {
+	switch orphan.Kind {
+	case drivers.OrphanDomain, drivers.OrphanVolume, drivers.OrphanNetwork:
+		return exec.TargetLibvirt
+	}
+	return exec.TargetLocal
+}
+
+func removeOrphan(provider drivers.Provider, orphan drivers.Orphan) error {
+	switch orphan.Kind {
+	case orphanProfile:
+		return newLocalExecutor().Run(iface.NewCommand("minikube", "delete", "-p", orphan.Name), iface.Streams{Stdout: os.Stdout, Stderr: os.Stderr})
+	case orphanState:
+		return os.RemoveAll(orphan.Name)
+	case orphanFile:
+		return os.Remove(orphan.Name)
+	}
+	collector, ok := provider.(drivers.Collector)
+	if !ok {
+		return fmt.Errorf("the provider does not remove the %s orphans", orphan.Kind)
+	}
+	return collector.RemoveOrphan(orphan)
+}
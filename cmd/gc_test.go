@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"swdt/pkg/drivers"
+	"swdt/pkg/executors/exec"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// useTempFiles replaces the temporary files of swdt for the test.
+func useTempFiles(t *testing.T, files ...string) {
+	previous := tempFiles
+	tempFiles = func() ([]string, error) { return files, nil }
+	t.Cleanup(func() { tempFiles = previous })
+}
+
+func TestFindOrphans(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(config.StateHomeEnv, home)
+
+	// dev was started, broken failed before recording its status and starting is running
+	dev := &v1alpha1.Cluster{}
+	dev.Name = "dev"
+	useProvider(t, drivers.NewFake(nil))
+	assert.Nil(t, startWindowsVM(dev))
+	broken := filepath.Join(home, "clusters", "broken")
+	assert.Nil(t, os.MkdirAll(broken, 0o755))
+	assert.Nil(t, os.Chtimes(broken, time.Now(), time.Now().Add(-2*time.Hour)))
+	assert.Nil(t, os.MkdirAll(filepath.Join(home, "clusters", "starting"), 0o755))
+
+	stale, fresh := filepath.Join(home, "swdt-1.yaml"), filepath.Join(home, "swdt-2.yaml")
+	for _, file := range []string{stale, fresh} {
+		assert.Nil(t, os.WriteFile(file, nil, 0o644))
+	}
+	assert.Nil(t, os.Chtimes(stale, time.Now(), time.Now().Add(-2*time.Hour)))
+	useTempFiles(t, stale, fresh)
+
+	network := drivers.Orphan{Kind: drivers.OrphanNetwork, Name: "swdt-broken-private"}
+	domain := drivers.Orphan{Kind: drivers.OrphanDomain, Name: "swdt-broken-windows", Cluster: "broken"}
+	volume := drivers.Orphan{Kind: drivers.OrphanVolume, Name: filepath.Join(broken, "windows.qcow2"), Cluster: "broken"}
+	fake := drivers.NewFake(nil).SetOrphans(network, volume, domain,
+		drivers.Orphan{Kind: drivers.OrphanDomain, Name: "swdt-dev-windows", Cluster: "dev"},
+		drivers.Orphan{Kind: drivers.OrphanDomain, Name: "swdt-ci-windows", Cluster: "ci"})
+
+	ci := &v1alpha1.Cluster{}
+	ci.Name = "ci"
+	known, err := knownClusters(ci)
+	assert.Nil(t, err)
+	assert.Len(t, known, 3)
+	orphans, err := findOrphans(fake, ci, known)
+	assert.Nil(t, err)
+	assert.Equal(t, []drivers.Orphan{domain, volume, network,
+		{Kind: orphanState, Name: filepath.Join(home, "clusters", "broken"), Cluster: "broken"},
+		{Kind: orphanFile, Name: stale}}, orphans)
+
+	var out bytes.Buffer
+	assert.Nil(t, printOrphans(&out, orphans))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Regexp(t, `^KIND\s+NAME\s+CLUSTER$`, lines[0])
+	assert.Regexp(t, `^domain\s+swdt-broken-windows\s+broken$`, lines[1])
+
+	assert.Nil(t, removeOrphans(fake, orphans))
+	assert.NoDirExists(t, filepath.Join(home, "clusters", "broken"))
+	assert.DirExists(t, filepath.Join(home, "clusters", "dev"))
+	assert.DirExists(t, filepath.Join(home, "clusters", "starting"))
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, fresh)
+	left, err := fake.Orphans(known)
+	assert.Nil(t, err)
+	assert.Empty(t, left)
+}
+
+func TestRemoveOrphansFailures(t *testing.T) {
+	fake := drivers.NewFake(nil).Fail("RemoveOrphan", errors.New("libvirt is down"))
+	missing := filepath.Join(t.TempDir(), "swdt-1.yaml")
+	err := removeOrphans(fake, []drivers.Orphan{
+		{Kind: drivers.OrphanNetwork, Name: "swdt-old-nat"},
+		{Kind: orphanFile, Name: missing},
+	})
+	// every orphan is tried
+	assert.ErrorContains(t, err, "network swdt-old-nat: libvirt is down")
+	assert.ErrorContains(t, err, "file "+missing)
+
+	err = removeOrphans(drivers.NewNone(&v1alpha1.Cluster{}), []drivers.Orphan{{Kind: drivers.OrphanDomain, Name: "swdt-old-windows"}})
+	assert.EqualError(t, err, "domain swdt-old-windows: the provider does not remove the domain orphans")
+}
+
+func TestMinikubeProfiles(t *testing.T) {
+	local := exec.NewDryRunLocalExecutor(&exec.Plan{}, exec.Result{Match: regexp.MustCompile(`minikube profile list`),
+		Output: `{"invalid":[{"Name":"swdt-old"}],"valid":[{"Name":"minikube","Status":"Running"},{"Name":"swdt-dev"}]}`})
+	names, err := minikubeProfiles(local)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"minikube", "swdt-dev", "swdt-old"}, names)
+
+	local = exec.NewDryRunLocalExecutor(&exec.Plan{}, exec.Result{Match: regexp.MustCompile(`minikube`), Err: errors.New("minikube not found")})
+	_, err = minikubeProfiles(local)
+	assert.EqualError(t, err, "minikube not found")
+}
+
+func TestConfirm(t *testing.T) {
+	for answer, expected := range map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "\n": false, "": false} {
+		var out bytes.Buffer
+		assert.Equal(t, expected, confirm(strings.NewReader(answer), &out, "Remove?"), answer)
+		assert.Equal(t, "Remove? [y/N] ", out.String())
+	}
+}
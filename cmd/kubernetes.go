@@ -19,7 +19,6 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 	"swdt/apis/config/v1alpha1"
-	ifacer "swdt/pkg/pwsh/iface"
 	"swdt/pkg/pwsh/kubernetes"
 )
 
@@ -42,7 +41,7 @@ func RunKubernetes(cmd *cobra.Command, args []string) error {
 
 	// Starting the executor
 	ssh := config.Spec.Workload.Virtualization.SSH
-	r, err := ifacer.NewRunner(ssh, &kubernetes.Runner{})
+	r, err := newRunner(ssh, &kubernetes.Runner{Shares: config.Spec.Workload.Virtualization.Shares})
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,123 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"swdt/pkg/drivers"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the clusters managed by swdt on the host",
+	Long: `List the clusters of the state directories in $SWDT_HOME or ~/.swdt, merged with the libvirt
+domains tagged by swdt on the daemon of the configuration, whichever user created them.
+The status of a cluster with a state directory is the one recorded by the last command changing the
+Windows machine. The domains without state directory, like the ones of the other users sharing the
+libvirt daemon, are marked as foreign with their current state.`,
+	Args: cobra.NoArgs,
+	RunE: RunList,
+}
+
+func RunList(cmd *cobra.Command, args []string) error {
+	var machines []drivers.Machine
+	if cluster, err := loadConfiguration(cmd); err != nil {
+		klog.Warningf("Unable to load the configuration, the libvirt domains are not listed: %v", err)
+	} else if machines, err = listMachines(cluster); err != nil {
+		klog.Warningf("Unable to list the libvirt domains: %v", err)
+	}
+	return listClusters(cmd.OutOrStdout(), machines)
+}
+
+// listMachines returns the machines swdt created on the provider of the configuration,
+// of every user.
+func listMachines(cluster *v1alpha1.Cluster) ([]drivers.Machine, error) {
+	provider, err := newProvider(cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer closeProvider(provider)
+	lister, ok := provider.(drivers.Lister)
+	if !ok {
+		return nil, nil
+	}
+	return lister.Machines()
+}
+
+// clusterEntry is a row of the cluster list.
+type clusterEntry struct {
+	name, owner, state, ip, snapshot, updated string
+	foreign                                   bool
+}
+
+// listClusters writes the table of the clusters with their recorded status, merged
+// with the machines of the clusters without state directory marked as foreign.
+func listClusters(out io.Writer, machines []drivers.Machine) error {
+	clusters, err := config.ListClusters()
+	if err != nil {
+		return err
+	}
+	owner := config.CurrentOwner()
+	local := map[string]bool{}
+	var entries []clusterEntry
+	for _, cluster := range clusters {
+		local[cluster.Name] = true
+		updated := ""
+		if !cluster.Status.UpdatedAt.IsZero() {
+			updated = cluster.Status.UpdatedAt.Format(time.RFC3339)
+		}
+		entries = append(entries, clusterEntry{name: cluster.Name, owner: owner.User, state: string(cluster.Status.State),
+			ip: cluster.Status.Leases[windowsHost], snapshot: cluster.Status.Snapshot, updated: updated})
+	}
+	for _, machine := range machines {
+		// the domains tagged before the owner was recorded belong to the local cluster
+		if local[machine.Cluster] && (machine.Owner == owner || machine.Owner.IsZero()) {
+			continue
+		}
+		entries = append(entries, clusterEntry{name: machine.Cluster, owner: machine.Owner.User, state: string(machine.State), foreign: true})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].name != entries[j].name {
+			return entries[i].name < entries[j].name
+		} else if entries[i].foreign != entries[j].foreign {
+			return !entries[i].foreign
+		}
+		return entries[i].owner < entries[j].owner
+	})
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tOWNER\tSTATE\tWINDOWS IP\tSNAPSHOT\tUPDATED\tFOREIGN")
+	for _, entry := range entries {
+		foreign := ""
+		if entry.foreign {
+			foreign = "yes"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.name, entry.owner, entry.state,
+			entry.ip, entry.snapshot, entry.updated, foreign)
+	}
+	return w.Flush()
+}
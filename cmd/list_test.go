@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"swdt/pkg/drivers"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListClusters(t *testing.T) {
+	t.Setenv(config.StateHomeEnv, t.TempDir())
+	var out bytes.Buffer
+	assert.Nil(t, listClusters(&out, nil))
+	assert.Regexp(t, `^NAME\s+OWNER\s+STATE\s+WINDOWS IP\s+SNAPSHOT\s+UPDATED\s+FOREIGN\n$`, out.String())
+
+	// the started clusters are listed until destroyed
+	dev, ci := &v1alpha1.Cluster{}, &v1alpha1.Cluster{}
+	dev.Name, ci.Name = "dev", "ci"
+	useProvider(t, drivers.NewFake(map[string]string{windowsHost: "192.168.39.10"}))
+	assert.Nil(t, startWindowsVM(dev))
+	useProvider(t, drivers.NewFake(nil).SetState(drivers.StateStopped))
+	assert.Nil(t, startWindowsVM(ci))
+
+	owner := config.CurrentOwner()
+	out.Reset()
+	assert.Nil(t, listClusters(&out, nil))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, `^ci\s+`+owner.User+`\s+Stopped\s+\S+\s*$`, lines[1])
+	assert.Regexp(t, `^dev\s+`+owner.User+`\s+Running\s+192\.168\.39\.10\s+\S+\s*$`, lines[2])
+
+	assert.Nil(t, removeState(ci))
+	out.Reset()
+	assert.Nil(t, listClusters(&out, nil))
+	assert.NotContains(t, out.String(), "ci")
+}
+
+func TestListClustersMachines(t *testing.T) {
+	t.Setenv(config.StateHomeEnv, t.TempDir())
+	dev := &v1alpha1.Cluster{}
+	dev.Name = "dev"
+	useProvider(t, drivers.NewFake(nil))
+	assert.Nil(t, startWindowsVM(dev))
+
+	owner := config.CurrentOwner()
+	ops := config.Owner{User: "ops", UID: "1001", Home: "/home/ops/.swdt"}
+	fake := drivers.NewFake(nil).SetMachines(
+		drivers.Machine{Name: "swdt-dev-windows", Cluster: "dev", Owner: owner, State: drivers.StateRunning},
+		drivers.Machine{Name: "swdt-dev-windows", Cluster: "dev", Owner: ops, State: drivers.StatePaused},
+		drivers.Machine{Name: "swdt-old-windows", Cluster: "old", Owner: owner, State: drivers.StateStopped})
+	useProvider(t, fake)
+	machines, err := listMachines(dev)
+	assert.Nil(t, err)
+	assert.True(t, fake.Closed())
+
+	// the domain of the local cluster is merged, the others are foreign
+	var out bytes.Buffer
+	assert.Nil(t, listClusters(&out, machines))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Regexp(t, `^dev\s+`+owner.User+`\s+Running\s+\S+\s*$`, lines[1])
+	assert.Regexp(t, `^dev\s+ops\s+Paused\s+yes$`, lines[2])
+	assert.Regexp(t, `^old\s+`+owner.User+`\s+Stopped\s+yes$`, lines[3])
+
+	// the existing hosts have no machine of swdt
+	useProvider(t, drivers.NewNone(dev))
+	machines, err = listMachines(dev)
+	assert.Nil(t, err)
+	assert.Empty(t, machines)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"swdt/pkg/executors/exec"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// middlewares wrap the executors, built from the flags.
+	middlewares []exec.Middleware
+
+	// redactor hides the secrets from the printed commands, nil when disabled.
+	redactor *exec.Redactor
+
+	transcriptFile *os.File
+)
+
+// enableMiddlewares builds the executors middlewares from the flags.
+func enableMiddlewares(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	redact, err := flags.GetBool("redact")
+	if err != nil {
+		return err
+	}
+	if redact {
+		patterns, err := flags.GetStringArray("redact-pattern")
+		if err != nil {
+			return err
+		}
+		if redactor, err = exec.NewRedactor(append(exec.DefaultSecretPatterns, patterns...)...); err != nil {
+			return err
+		}
+	}
+	middlewares = []exec.Middleware{exec.Trace(traceOutput(cmd), redactor)}
+
+	timing, err := flags.GetBool("timing")
+	if err != nil {
+		return err
+	}
+	if timing {
+		middlewares = append(middlewares, exec.Timing(redactor))
+	}
+
+	transcript, err := flags.GetString("transcript")
+	if err != nil {
+		return err
+	}
+	if transcript != "" {
+		if transcriptFile, err = os.Create(transcript); err != nil {
+			return err
+		}
+		middlewares = append(middlewares, exec.Transcript(transcriptFile, redactor))
+	}
+
+	retries, err := flags.GetInt("retries")
+	if err != nil {
+		return err
+	}
+	delay, err := flags.GetDuration("retry-delay")
+	if err != nil {
+		return err
+	}
+	if retries > 0 {
+		middlewares = append(middlewares, exec.Retry(exec.RetryPolicy{Attempts: retries + 1, Delay: delay}))
+	}
+	return nil
+}
+
+// closeTranscript closes the transcript file when enabled.
+func closeTranscript() error {
+	if transcriptFile == nil {
+		return nil
+	}
+	return transcriptFile.Close()
+}
+
+// traceOutput returns the writer of the traced commands, stderr when the command
+// prints a machine readable output on stdout.
+func traceOutput(cmd *cobra.Command) io.Writer {
+	if output := cmd.Flags().Lookup("output"); output != nil && output.Value.String() != outputTable {
+		return os.Stderr
+	}
+	return os.Stdout
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"swdt/pkg/executors/exec"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// cassette records the executed commands when --record is set.
+	cassette     *exec.Cassette
+	cassetteFile string
+)
+
+// enableRecording creates the cassette when the record flag is set.
+func enableRecording(cmd *cobra.Command, args []string) (err error) {
+	if cassetteFile, err = cmd.Flags().GetString("record"); err != nil {
+		return err
+	}
+	if cassetteFile != "" {
+		cassette = &exec.Cassette{}
+	}
+	return nil
+}
+
+// saveRecording writes the cassette with the recorded session.
+func saveRecording() error {
+	if cassette == nil {
+		return nil
+	}
+	klog.Infof("Saving %d recorded interactions in %s", len(cassette.Interactions), cassetteFile)
+	return cassette.Save(cassetteFile)
+}
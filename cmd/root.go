@@ -19,6 +19,7 @@ package cmd
 import (
 	"swdt/apis/config/v1alpha1"
 	"swdt/pkg/config"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -43,21 +44,56 @@ func NewRootCommand() *cobra.Command {
 		Short: "SIG Windows Development Tools",
 		Long: `Auxiliary program for Windows nodes installation and initial setup.
 	Check the subcommands.`,
+		PersistentPreRunE:  preRun,
+		PersistentPostRunE: postRun,
 	}
 
 	featureGate.AddFlag(cmd.Flags())
 	logsapi.AddFlags(logscfg, cmd.Flags())
 
 	cmd.PersistentFlags().StringP("config", "c", "samples/config.yaml", "Configuration file path.")
+	cmd.PersistentFlags().Bool("dry-run", false, "Print the plan of remote and local actions without running them.")
+	cmd.PersistentFlags().String("record", "", "Record the remote and local commands with their results in a YAML cassette.")
+	cmd.PersistentFlags().Int("retries", 2, "Retries of the commands failing to start on connection errors, 0 disables them.")
+	cmd.PersistentFlags().Duration("retry-delay", 2*time.Second, "Delay before the first retry, doubled on every retry.")
+	cmd.PersistentFlags().Bool("redact", true, "Redact tokens and passwords from the printed commands, the transcript and the recorded cassette.")
+	cmd.PersistentFlags().StringArray("redact-pattern", nil, "Extra regexp of a secret to redact, the first group is replaced.")
+	cmd.PersistentFlags().Bool("timing", false, "Log the duration of every command.")
+	cmd.PersistentFlags().String("transcript", "", "Write the commands with their redacted output in a timestamped transcript file.")
 
 	cmd.AddCommand(setupCmd)
 	cmd.AddCommand(startCmd)
 	cmd.AddCommand(destroyCmd)
+	cmd.AddCommand(gcCmd)
 	cmd.AddCommand(kubernetesCmd)
+	cmd.AddCommand(listCmd)
+	cmd.AddCommand(snapshotCmd)
+	cmd.AddCommand(statusCmd)
+	cmd.AddCommand(vmCmd)
 
 	return cmd
 }
 
+// preRun enables the optional executors wrappers from the flags
+func preRun(cmd *cobra.Command, args []string) error {
+	if err := enableDryRun(cmd, args); err != nil {
+		return err
+	}
+	if err := enableRecording(cmd, args); err != nil {
+		return err
+	}
+	return enableMiddlewares(cmd, args)
+}
+
+// postRun prints the dry-run plan, closes the transcript and saves the recorded cassette
+func postRun(cmd *cobra.Command, args []string) error {
+	printPlan(cmd, args)
+	if err := closeTranscript(); err != nil {
+		return err
+	}
+	return saveRecording()
+}
+
 // loadConfiguration marshal the YAML configuration in an internal struct
 func loadConfiguration(cmd *cobra.Command) (*v1alpha1.Cluster, error) {
 	cfg := cmd.Flag("config").Value.String()
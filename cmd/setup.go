@@ -17,18 +17,27 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
 	"k8s.io/klog/v2"
+	"strings"
 	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
 	"swdt/pkg/drivers"
-	ifacer "swdt/pkg/pwsh/iface"
+	"swdt/pkg/executors/exec"
+	"swdt/pkg/executors/iface"
 	"swdt/pkg/pwsh/setup"
+	"time"
 )
 
-var (
-	windowsHost      = "windows"
-	controlPlaneHost = "minikube"
-)
+var windowsHost = drivers.WindowsLease
+
+// controlPlaneHost returns the hostname leased by the minikube machine, named after its profile.
+func controlPlaneHost(cluster *v1alpha1.Cluster) string {
+	return config.MinikubeProfile(cluster)
+}
 
 // setupCmd represents the setup command
 var setupCmd = &cobra.Command{
@@ -38,6 +47,10 @@ var setupCmd = &cobra.Command{
 	RunE:  RunSetup,
 }
 
+func init() {
+	setupCmd.Flags().Duration("lease-timeout", 5*time.Minute, "Time waiting for the DHCP lease of the Windows machine.")
+}
+
 func RunSetup(cmd *cobra.Command, args []string) error {
 	var (
 		err    error
@@ -48,38 +61,70 @@ func RunSetup(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	var leases map[string]string
-	if leases, err = findPrivateIPs(config); err != nil {
+	timeout, err := cmd.Flags().GetDuration("lease-timeout")
+	if err != nil {
 		return err
 	}
+	var leases map[string]string
+	if leases, err = findPrivateIPs(config, timeout); err != nil {
+		if plan == nil {
+			return err
+		}
+		klog.Warningf("Unable to read DHCP leases, using placeholders: %v", err)
+		leases = map[string]string{windowsHost: "<windows-ip>", controlPlaneHost(config): "<control-plane-ip>"}
+	}
 	// Find the IP of the Windows machine grabbing from the domain
 	if config.Spec.Workload.Virtualization.SSH.Hostname == "" {
 		config.Spec.Workload.Virtualization.SSH.Hostname = leases[windowsHost] + ":22"
 	}
 	// Find the control plane IP
-	controlPlaneIP := leases[controlPlaneHost]
+	controlPlaneIP := leases[controlPlaneHost(config)]
 	klog.Info(resc.Sprintf("Found DHCP leases: %v", leases))
 
 	ssh := config.Spec.Workload.Virtualization.SSH
-	r, err := ifacer.NewRunner(ssh, &setup.Runner{Logging: true})
+	r, err := newRunner(ssh, &setup.Runner{Logging: true, Profile: controlPlaneHost(config)})
 	if err != nil {
 		return err
 	}
 
-	// Install choco binary and packages if a list of packages exists
-	if len(*config.Spec.Workload.Auxiliary.ChocoPackages) > 0 {
-		if err = r.Inner.InstallChoco(); err != nil {
-			return err
-		}
-		// Install Choco packages from the input list
-		if err = r.Inner.InstallChocoPackages(*config.Spec.Workload.Auxiliary.ChocoPackages); err != nil {
+	// The config medium carries the Administrator password, eject it once applied.
+	if config.Spec.Workload.Virtualization.Bootstrap != nil {
+		if err = ejectMedium(config, r.Inner); err != nil {
 			return err
 		}
 	}
 
+	// Choco and RDP are independent, run them in parallel over the same connection.
+	var group errgroup.Group
+	// Install choco binary and packages if a list of packages exists
+	if len(*config.Spec.Workload.Auxiliary.ChocoPackages) > 0 {
+		group.Go(func() error {
+			if err := r.Inner.InstallChoco(); err != nil {
+				return err
+			}
+			// Install Choco packages from the input list
+			return r.Inner.InstallChocoPackages(*config.Spec.Workload.Auxiliary.ChocoPackages)
+		})
+	}
+
 	// Enable RDP if option is true
 	rdp := config.Spec.Workload.Auxiliary.EnableRDP
-	if err = r.Inner.EnableRDP(*rdp); err != nil {
+	group.Go(func() error {
+		return r.Inner.EnableRDP(*rdp)
+	})
+	if err = group.Wait(); err != nil {
+		return err
+	}
+
+	// Mount the host directories shared with the node
+	shares := config.Spec.Workload.Virtualization.Shares
+	for _, share := range shares {
+		redactor.AddSecret(share.Password)
+	}
+	if err = checkShares(config); err != nil {
+		return err
+	}
+	if err = r.Inner.MountShares(shares); err != nil {
 		return err
 	}
 
@@ -106,15 +151,71 @@ func RunSetup(cmd *cobra.Command, args []string) error {
 	return r.Inner.InstallCNI(config.Spec.CalicoVersion, cpKubernetes, controlPlaneIP)
 }
 
-// findPrivateIPs returns the leased ips from the domain.
-func findPrivateIPs(config *v1alpha1.Cluster) (leases map[string]string, err error) {
-	var drv *drivers.Driver
-	drv, err = drivers.NewDriver(config)
+// ejectMedium ejects and deletes the config medium once the first-boot agent applied it.
+func ejectMedium(config *v1alpha1.Cluster, r *setup.Runner) error {
+	if !r.BootstrapApplied() {
+		klog.Warning("The config medium is not applied yet, keeping it attached")
+		return nil
+	}
+	if plan != nil {
+		plan.Record(exec.TargetLibvirt, fmt.Sprintf("eject and delete the config medium %s", drivers.MediumPath(config)))
+		return nil
+	}
+	provider, err := newProvider(config)
 	if err != nil {
+		return err
+	}
+	defer closeProvider(provider)
+	if ejector, ok := provider.(drivers.MediumEjector); ok {
+		return ejector.EjectMedium()
+	}
+	return nil
+}
+
+// checkShares fails before mounting when the machine lacks a share, like a virtiofs
+// share added to the configuration after the domain was defined.
+func checkShares(config *v1alpha1.Cluster) error {
+	if plan != nil || len(config.Spec.Workload.Virtualization.Shares) == 0 {
+		return nil
+	}
+	provider, err := newProvider(config)
+	if err != nil {
+		return err
+	}
+	defer closeProvider(provider)
+	if sharer, ok := provider.(drivers.Sharer); ok {
+		return sharer.CheckShares()
+	}
+	return nil
+}
+
+// findPrivateIPs waits for the Windows machine lease from the provider, the control
+// plane IP is read from minikube when its machine is not leased by the provider. It
+// is left out for a control plane not run by minikube.
+func findPrivateIPs(config *v1alpha1.Cluster, timeout time.Duration) (leases map[string]string, err error) {
+	var provider drivers.Provider
+	if provider, err = newProvider(config); err != nil {
 		return
 	}
-	if leases, err = drv.GetLeasedIPs(drivers.PrivateNetwork); err != nil {
+	defer closeProvider(provider)
+	if plan != nil {
+		timeout = 0
+	}
+	if leases, err = drivers.WaitForLease(provider, timeout); err != nil {
 		return
 	}
+	host := controlPlaneHost(config)
+	if _, ok := leases[host]; !ok {
+		if !config.Spec.ControlPlane.Minikube {
+			// the control plane is reached from the kubeconfig, like before the leases were awaited
+			klog.Warningf("No DHCP lease for the control plane %s, continuing without its IP", host)
+			return
+		}
+		var stdout bytes.Buffer
+		if err = newLocalExecutor().Run(iface.NewCommand("minikube", "-p", host, "ip"), iface.Streams{Stdout: &stdout}); err != nil {
+			return
+		}
+		leases[host] = strings.TrimSpace(stdout.String())
+	}
 	return
 }
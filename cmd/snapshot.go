@@ -0,0 +1,231 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"swdt/pkg/drivers"
+	"swdt/pkg/executors/exec"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage the snapshots of the Windows domain",
+	Long: `Manage the snapshots of the Windows domain, saved inside its qcow2 disk.
+Take a snapshot like post-setup after a working setup and restore it to get back a known-good node.`,
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Save the Windows domain disks, and memory when running, under a name",
+	Args:  cobra.ExactArgs(1),
+	RunE:  RunSnapshotCreate,
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the snapshots of the Windows domain",
+	Args:  cobra.NoArgs,
+	RunE:  RunSnapshotList,
+}
+
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <name>",
+	Short: "Revert the Windows domain to a snapshot",
+	Args:  cobra.ExactArgs(1),
+	RunE:  RunSnapshotRestore,
+}
+
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a snapshot of the Windows domain",
+	Args:  cobra.ExactArgs(1),
+	RunE:  RunSnapshotDelete,
+}
+
+func init() {
+	snapshotCreateCmd.Flags().String("description", "", "Description saved with the snapshot.")
+	snapshotCmd.AddCommand(snapshotCreateCmd, snapshotListCmd, snapshotRestoreCmd, snapshotDeleteCmd)
+}
+
+func RunSnapshotCreate(cmd *cobra.Command, args []string) error {
+	cluster, err := loadConfiguration(cmd)
+	if err != nil {
+		return err
+	}
+	description, err := cmd.Flags().GetString("description")
+	if err != nil {
+		return err
+	}
+	return createSnapshot(cluster, args[0], description)
+}
+
+func RunSnapshotList(cmd *cobra.Command, args []string) error {
+	cluster, err := loadConfiguration(cmd)
+	if err != nil {
+		return err
+	}
+	return listSnapshots(cluster, cmd.OutOrStdout())
+}
+
+func RunSnapshotRestore(cmd *cobra.Command, args []string) error {
+	cluster, err := loadConfiguration(cmd)
+	if err != nil {
+		return err
+	}
+	return restoreSnapshot(cluster, args[0])
+}
+
+func RunSnapshotDelete(cmd *cobra.Command, args []string) error {
+	cluster, err := loadConfiguration(cmd)
+	if err != nil {
+		return err
+	}
+	return deleteSnapshot(cluster, args[0])
+}
+
+// createSnapshot saves the snapshot and records it as the current one.
+func createSnapshot(cluster *v1alpha1.Cluster, name, description string) error {
+	if err := drivers.ValidateSnapshotName(name); err != nil {
+		return err
+	}
+	if plan != nil {
+		plan.Record(exec.TargetLibvirt, fmt.Sprintf("create the snapshot %s of the Windows domain", name))
+		return nil
+	}
+	return withSnapshotter(cluster, func(snapshotter drivers.Snapshotter) error {
+		klog.Info(resc.Sprintf("Creating snapshot %s...", name))
+		return snapshotter.CreateSnapshot(name, description)
+	})
+}
+
+// listSnapshots writes the snapshots table, the current one is marked.
+func listSnapshots(cluster *v1alpha1.Cluster, out io.Writer) error {
+	provider, err := newProvider(cluster)
+	if err != nil {
+		return err
+	}
+	defer closeProvider(provider)
+	snapshotter, err := asSnapshotter(cluster, provider)
+	if err != nil {
+		return err
+	}
+	snapshots, err := snapshotter.ListSnapshots()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tSTATE\tCREATED\tCURRENT\tDESCRIPTION")
+	for _, snapshot := range snapshots {
+		current := ""
+		if snapshot.Current {
+			current = "*"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", snapshot.Name, snapshot.State,
+			snapshot.CreatedAt.Format(time.RFC3339), current, snapshot.Description)
+	}
+	return w.Flush()
+}
+
+// restoreSnapshot reverts the Windows domain to the snapshot and refreshes the status,
+// the leases can change when the domain comes back.
+func restoreSnapshot(cluster *v1alpha1.Cluster, name string) error {
+	if plan != nil {
+		plan.Record(exec.TargetLibvirt, fmt.Sprintf("restore the Windows domain to the snapshot %s", name))
+		return nil
+	}
+	return withSnapshotter(cluster, func(snapshotter drivers.Snapshotter) error {
+		klog.Info(resc.Sprintf("Restoring snapshot %s...", name))
+		return snapshotter.RestoreSnapshot(name)
+	})
+}
+
+// deleteSnapshot removes the snapshot.
+func deleteSnapshot(cluster *v1alpha1.Cluster, name string) error {
+	if plan != nil {
+		plan.Record(exec.TargetLibvirt, fmt.Sprintf("delete the snapshot %s of the Windows domain", name))
+		return nil
+	}
+	return withSnapshotter(cluster, func(snapshotter drivers.Snapshotter) error {
+		return snapshotter.DeleteSnapshot(name)
+	})
+}
+
+// withSnapshotter calls the function with the snapshots of the provider, then
+// refreshes the recorded cluster status.
+func withSnapshotter(cluster *v1alpha1.Cluster, fn func(drivers.Snapshotter) error) error {
+	provider, err := newProvider(cluster)
+	if err != nil {
+		return err
+	}
+	defer closeProvider(provider)
+	snapshotter, err := asSnapshotter(cluster, provider)
+	if err != nil {
+		return err
+	}
+	if err = fn(snapshotter); err != nil {
+		return err
+	}
+	return refreshStatus(cluster, provider)
+}
+
+// asSnapshotter returns the snapshots of the provider, when supported.
+func asSnapshotter(cluster *v1alpha1.Cluster, provider drivers.Provider) (drivers.Snapshotter, error) {
+	snapshotter, ok := provider.(drivers.Snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("the %s provider does not support snapshots", cluster.Spec.Workload.Virtualization.Provider)
+	}
+	return snapshotter, nil
+}
+
+// refreshStatus records the state, the leases and the current snapshot of the Windows machine.
+func refreshStatus(cluster *v1alpha1.Cluster, provider drivers.Provider) error {
+	state, err := provider.State()
+	if err != nil {
+		return err
+	}
+	status := v1alpha1.ClusterStatus{State: string(state), UpdatedAt: metav1.Now()}
+	if state == drivers.StateRunning {
+		if status.Leases, err = provider.Leases(); err != nil {
+			klog.Warningf("Unable to read DHCP leases: %v", err)
+		}
+	}
+	if snapshotter, ok := provider.(drivers.Snapshotter); ok && state != drivers.StateNotFound {
+		snapshots, err := snapshotter.ListSnapshots()
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			if snapshot.Current {
+				status.Snapshot = snapshot.Name
+			}
+		}
+	}
+	cluster.Status = status
+	return config.SaveStatus(cluster)
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"swdt/pkg/drivers"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotLifecycle(t *testing.T) {
+	t.Setenv(config.StateHomeEnv, t.TempDir())
+	fake := drivers.NewFake(map[string]string{windowsHost: "192.168.39.10"}).SetState(drivers.StateRunning)
+	useProvider(t, fake)
+	cluster := &v1alpha1.Cluster{}
+
+	assert.Nil(t, createSnapshot(cluster, "post-setup", "after swdt setup"))
+	assert.EqualError(t, createSnapshot(cluster, "post setup", ""), `invalid snapshot name "post setup", use letters, digits, '.', '_' and '-'`)
+
+	// a broken experiment stops the node, the restore brings it back running
+	assert.Nil(t, fake.Stop())
+	assert.Nil(t, createSnapshot(cluster, "broken", ""))
+	assert.Nil(t, restoreSnapshot(cluster, "post-setup"))
+	state, _ := fake.State()
+	assert.Equal(t, drivers.StateRunning, state)
+
+	recorded := &v1alpha1.Cluster{}
+	assert.Nil(t, config.LoadStatus(recorded))
+	assert.Equal(t, "Running", recorded.Status.State)
+	assert.Equal(t, "post-setup", recorded.Status.Snapshot)
+	assert.Equal(t, map[string]string{windowsHost: "192.168.39.10"}, recorded.Status.Leases)
+
+	var out bytes.Buffer
+	assert.Nil(t, listSnapshots(cluster, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, `^NAME\s+STATE\s+CREATED\s+CURRENT\s+DESCRIPTION$`, lines[0])
+	assert.Regexp(t, `^post-setup\s+Running\s+\S+\s+\*\s+after swdt setup$`, lines[1])
+	assert.Regexp(t, `^broken\s+Stopped\s+\S+$`, lines[2])
+
+	assert.Nil(t, deleteSnapshot(cluster, "broken"))
+	assert.ErrorIs(t, restoreSnapshot(cluster, "broken"), drivers.ErrNotFound)
+}
+
+func TestSnapshotUnsupported(t *testing.T) {
+	cluster := &v1alpha1.Cluster{}
+	cluster.Spec.Workload.Virtualization.Provider = v1alpha1.ProviderNone
+	useProvider(t, drivers.NewNone(cluster))
+	assert.EqualError(t, restoreSnapshot(cluster, "post-setup"), "the none provider does not support snapshots")
+}
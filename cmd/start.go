@@ -17,20 +17,27 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"github.com/fatih/color"
 	"k8s.io/klog/v2"
 	"log"
+	"os"
 	"strings"
 	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
 	"swdt/pkg/executors/exec"
+	"swdt/pkg/executors/iface"
 
 	"github.com/spf13/cobra"
-	"libvirt.org/go/libvirt"
 	"swdt/pkg/drivers"
 )
 
 var (
 	resc = color.New(color.FgHiGreen).Add(color.Bold)
+
+	// newProvider returns the hypervisor provider of the configuration.
+	newProvider = drivers.NewProvider
 )
 
 // startCmd represents the start command
@@ -52,11 +59,27 @@ func RunStart(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Create the state directory first, gc keeps the resources of a recent one.
+	if err = createStateDir(config); err != nil {
+		return err
+	}
+
+	// Create the networks shared by the control plane and the Windows VM.
+	managed, err := ensureNetworks(config)
+	if err != nil {
+		return err
+	}
+
 	// Start the minikube if the flag is enabled.
 	if config.Spec.ControlPlane.Minikube {
 		version := config.Spec.ControlPlane.KubernetesVersion
 		klog.Info(resc.Sprintf("Starting a Minikube control plane, this operation can take a while..."))
-		if err := startMinikube(version); err != nil {
+		var networks *v1alpha1.NetworksSpec
+		if managed {
+			spec := drivers.Networks(config)
+			networks = &spec
+		}
+		if err := startMinikube(controlPlaneHost(config), version, networks); err != nil {
 			return err
 		}
 	}
@@ -66,54 +89,94 @@ func RunStart(cmd *cobra.Command, args []string) error {
 	return startWindowsVM(config)
 }
 
-// startWindowsVM create the Windows libvirt domain and start it.
+// createStateDir creates the state directory of the cluster before its resources.
+func createStateDir(cluster *v1alpha1.Cluster) error {
+	if plan != nil {
+		return nil
+	}
+	return os.MkdirAll(config.StateDir(cluster), 0o755)
+}
+
+// startWindowsVM create the Windows machine and start it, recording the cluster status
+// so it is listed.
 func startWindowsVM(config *v1alpha1.Cluster) error {
-	var (
-		dom *libvirt.Domain
-		err error
-	)
+	if plan != nil {
+		plan.Record(exec.TargetLibvirt, fmt.Sprintf("create the overlay volume %s through pool %s backed by %s", drivers.OverlayPath(config), drivers.StoragePool(config), config.Spec.Workload.Virtualization.DiskPath))
+		if config.Spec.Workload.Virtualization.Bootstrap != nil {
+			plan.Record(exec.TargetLibvirt, fmt.Sprintf("write the config medium %s", drivers.MediumPath(config)))
+		}
+		plan.Record(exec.TargetLibvirt, "define the Windows domain from the overlay volume")
+		plan.Record(exec.TargetLibvirt, "start the Windows domain")
+		return nil
+	}
 
 	log.Println("Creating domain...")
-	drv, err := drivers.NewDriver(config)
+	provider, err := newProvider(config)
 	if err != nil {
 		return err
 	}
-	// Create the libvirt domain
-	if dom, err = drv.CreateDomain(); err != nil {
-		// Domain already exists, skipping the Windows creation.
-		if alreadyExists(err) {
-			return nil
-		}
+	defer closeProvider(provider)
+
+	// Create the Windows machine and start it, an existing machine is kept as is.
+	if err = provider.Create(); err == nil {
+		err = provider.Start()
+	} else if alreadyExists(err) {
+		err = nil
+	}
+	if err != nil {
 		return err
 	}
-	defer func() {
-		if ferr := dom.Free(); ferr != nil {
-			log.Printf("unable to free domain: %v\n", err)
-			err = ferr
-		}
-	}()
+	return refreshStatus(config, provider)
+}
 
-	// Start the Windows created domain.
-	return drv.KvmDriver.Start()
+// ensureNetworks creates the networks of the Windows machine, reporting whether
+// the provider manages them.
+func ensureNetworks(config *v1alpha1.Cluster) (bool, error) {
+	if plan != nil {
+		if config.Spec.Workload.Virtualization.Provider == v1alpha1.ProviderNone {
+			return false, nil
+		}
+		networks := drivers.Networks(config)
+		plan.Record(exec.TargetLibvirt, fmt.Sprintf("ensure the networks %s and %s", networks.NAT.Name, networks.Private.Name))
+		return true, nil
+	}
+	provider, err := newProvider(config)
+	if err != nil {
+		return false, err
+	}
+	defer closeProvider(provider)
+	networker, ok := provider.(drivers.Networker)
+	if !ok {
+		return false, nil
+	}
+	return true, networker.EnsureNetworks()
 }
 
-// startMinikube initialize a minikube control plane.
-func startMinikube(version string) (err error) {
+// startMinikube initialize a minikube control plane in the profile, on the networks of
+// the Windows machine when set. The subnet is left to minikube, it picks a free one for
+// its own network and the managed networks keep the subnets they were defined with.
+func startMinikube(profile, version string, networks *v1alpha1.NetworksSpec) (err error) {
 	// Start minikube with KVM2 machine
-	cmd := strings.Join([]string{
-		"minikube", "start", "--driver", "kvm2", // KVM Driver
-        "--network-plugin", "cni", 
-        "--cni", "false",  // no CNI
-        "--extra-config","kubeadm.pod-network-cidr=192.168.0.0/16",
-        "subnet", "172.16.0.0/24",
-		"--kubernetes-version", version,  // Kubernetes Version
-	}, " ")
-	e := exec.NewLocalExecutor()
-	go exec.EnableOutput(nil, e.Stdout)
-	go exec.EnableOutput(nil, e.Stderr)
-	return e.Run(cmd, nil)
+	cmd := iface.NewCommand("minikube", "start", "-p", profile, "--driver", "kvm2", // KVM Driver
+		"--network-plugin", "cni",
+		"--cni", "false", // no CNI
+		"--extra-config", "kubeadm.pod-network-cidr=192.168.0.0/16",
+		"--kubernetes-version", version, // Kubernetes Version
+	)
+	if networks != nil {
+		cmd.Args = append(cmd.Args, "--kvm-network", networks.NAT.Name, "--network", networks.Private.Name)
+	}
+	e := newLocalExecutor()
+	return e.Run(cmd, iface.Streams{Stdout: os.Stdout, Stderr: os.Stderr})
 }
 
 func alreadyExists(err error) bool {
-	return strings.Contains(err.Error(), "already exists with")
+	return errors.Is(err, drivers.ErrAlreadyExists) || strings.Contains(err.Error(), "already exists with")
+}
+
+// closeProvider closes the hypervisor connection, logging the failure.
+func closeProvider(provider drivers.Provider) {
+	if err := provider.Close(); err != nil {
+		klog.Warningf("unable to close the provider: %v", err)
+	}
 }
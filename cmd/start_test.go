@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"swdt/pkg/drivers"
+	"swdt/pkg/executors/exec"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -9,5 +14,99 @@ import (
 
 func TestAlreadyExists(t *testing.T) {
 	assert.True(t, alreadyExists(errors.New("already exists with")))
+	assert.True(t, alreadyExists(errors.Wrap(drivers.ErrAlreadyExists, "define")))
 	assert.False(t, alreadyExists(errors.New("error")))
 }
+
+// useProvider replaces the hypervisor provider for the test.
+func useProvider(t *testing.T, provider drivers.Provider) {
+	previous := newProvider
+	newProvider = func(*v1alpha1.Cluster) (drivers.Provider, error) { return provider, nil }
+	t.Cleanup(func() { newProvider = previous })
+}
+
+func TestStartWindowsVM(t *testing.T) {
+	t.Setenv(config.StateHomeEnv, t.TempDir())
+	fake := drivers.NewFake(nil)
+	useProvider(t, fake)
+
+	assert.Nil(t, startWindowsVM(&v1alpha1.Cluster{}))
+	state, _ := fake.State()
+	assert.Equal(t, drivers.StateRunning, state)
+	assert.True(t, fake.Closed())
+
+	// the existing machine is not created again
+	assert.Nil(t, startWindowsVM(&v1alpha1.Cluster{}))
+	assert.Equal(t, []string{"Create", "Start", "State", "Leases", "ListSnapshots", "Close", "State",
+		"Create", "State", "Leases", "ListSnapshots", "Close"}, fake.Calls())
+}
+
+func TestDestroyWindowsDomain(t *testing.T) {
+	fake := drivers.NewFake(nil).SetState(drivers.StateRunning)
+	useProvider(t, fake)
+
+	assert.Nil(t, destroyWindowsDomain(&v1alpha1.Cluster{}))
+	state, _ := fake.State()
+	assert.Equal(t, drivers.StateNotFound, state)
+	assert.ErrorIs(t, destroyWindowsDomain(&v1alpha1.Cluster{}), drivers.ErrNotFound)
+}
+
+func TestFindPrivateIPs(t *testing.T) {
+	leases := map[string]string{windowsHost: "192.168.39.10", "swdt-default": "192.168.39.2"}
+	useProvider(t, drivers.NewFake(leases).SetState(drivers.StateRunning))
+
+	found, err := findPrivateIPs(&v1alpha1.Cluster{}, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, leases, found)
+
+	// the Windows machine never gets a lease while stopped
+	useProvider(t, drivers.NewFake(leases).SetState(drivers.StateStopped))
+	_, err = findPrivateIPs(&v1alpha1.Cluster{}, 0)
+	assert.EqualError(t, err, "no DHCP lease for the Windows machine after 0s")
+
+	// a control plane not run by minikube is not leased, it is left out
+	useProvider(t, drivers.NewFake(map[string]string{windowsHost: "192.168.39.10"}).SetState(drivers.StateRunning))
+	found, err = findPrivateIPs(&v1alpha1.Cluster{}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{windowsHost: "192.168.39.10"}, found)
+}
+
+func TestNetworks(t *testing.T) {
+	fake := drivers.NewFake(nil)
+	useProvider(t, fake)
+
+	managed, err := ensureNetworks(&v1alpha1.Cluster{})
+	assert.Nil(t, err)
+	assert.True(t, managed)
+	assert.Nil(t, removeNetworks(&v1alpha1.Cluster{}))
+	assert.Equal(t, []string{"EnsureNetworks", "Close", "RemoveNetworks", "Close"}, fake.Calls())
+
+	// an existing host has no networks to manage
+	cluster := &v1alpha1.Cluster{}
+	useProvider(t, drivers.NewNone(cluster))
+	managed, err = ensureNetworks(cluster)
+	assert.Nil(t, err)
+	assert.False(t, managed)
+}
+
+func TestStartMinikube(t *testing.T) {
+	previous := plan
+	plan = &exec.Plan{}
+	t.Cleanup(func() { plan = previous })
+
+	assert.Nil(t, startMinikube("swdt-dev", "v1.29.0", nil))
+	networks := &v1alpha1.NetworksSpec{
+		NAT:     v1alpha1.NetworkSpec{Name: "swdt-dev-nat"},
+		Private: v1alpha1.NetworkSpec{Name: "swdt-dev-private"},
+	}
+	assert.Nil(t, startMinikube("swdt-dev", "v1.29.0", networks))
+
+	actions := plan.Actions()
+	assert.Len(t, actions, 2)
+	assert.NotContains(t, actions[0].Command, "--kvm-network")
+	assert.Contains(t, actions[1].Command, "--kvm-network swdt-dev-nat --network swdt-dev-private")
+	// the subnet is picked by minikube or comes from the managed networks
+	for _, action := range actions {
+		assert.NotContains(t, action.Command, "--subnet")
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"swdt/pkg/drivers"
+	"swdt/pkg/pwsh/status"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// windowsServices are the services reported by the status command.
+var windowsServices = []string{"containerd", "kubelet"}
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of the Windows domain, node and control plane",
+	Long: `Show the state of the Windows domain with its leased IPs, the SSH reachability,
+the containerd and kubelet services, the Ready condition of the Windows node and the minikube status.`,
+	Args: cobra.NoArgs,
+	RunE: RunStatus,
+}
+
+func init() {
+	statusCmd.Flags().StringP("output", "o", outputTable, "Output format, one of table, json or yaml.")
+}
+
+// clusterStatus is the state printed by the status command, the probes failures
+// are listed in the errors instead of failing the command.
+type clusterStatus struct {
+	Name     string            `json:"name"`
+	Domain   string            `json:"domain"`
+	Leases   map[string]string `json:"leases,omitempty"`
+	SSH      sshStatus         `json:"ssh"`
+	Services map[string]string `json:"services,omitempty"`
+	Nodes    map[string]string `json:"nodes,omitempty"`
+	Minikube map[string]string `json:"minikube,omitempty"`
+	Errors   []string          `json:"errors,omitempty"`
+}
+
+// sshStatus is the reachability of the Windows node.
+type sshStatus struct {
+	Address   string `json:"address"`
+	Reachable bool   `json:"reachable"`
+}
+
+func (s *clusterStatus) addError(probe string, err error) {
+	s.Errors = append(s.Errors, fmt.Sprintf("%s: %v", probe, err))
+}
+
+func RunStatus(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if output != outputTable && output != outputJSON && output != outputYAML {
+		return fmt.Errorf("unknown output %q, use %s, %s or %s", output, outputTable, outputJSON, outputYAML)
+	}
+	cluster, err := loadConfiguration(cmd)
+	if err != nil {
+		return err
+	}
+	return printStatus(cmd.OutOrStdout(), output, collectStatus(cluster))
+}
+
+// collectStatus probes the domain, the node and the control plane.
+func collectStatus(cluster *v1alpha1.Cluster) *clusterStatus {
+	s := &clusterStatus{Name: config.ClusterName(cluster), Domain: string(drivers.StateUnknown)}
+	collectDomain(cluster, s)
+
+	var ssh v1alpha1.SSHSpec
+	if cluster.Spec.Workload.Virtualization.SSH != nil {
+		ssh = *cluster.Spec.Workload.Virtualization.SSH
+	}
+	private := drivers.Networks(cluster).Private.Name
+	if ssh.Hostname == "" && s.Leases[private] != "" {
+		ssh.Hostname = s.Leases[private] + ":22"
+	}
+	s.SSH.Address = ssh.Hostname
+
+	runner := &status.Runner{Profile: controlPlaneHost(cluster)}
+	if ssh.Hostname == "" {
+		runner.SetLocal(newLocalExecutor())
+		s.addError("ssh", fmt.Errorf("no address for the Windows node"))
+	} else if _, err := newRunner(&ssh, runner); err != nil {
+		s.addError("ssh", err)
+	} else {
+		s.SSH.Reachable = true
+	}
+	collectNode(cluster, s, runner)
+	return s
+}
+
+// collectNode probes the Windows services when the node is reachable, the Ready
+// condition of the Windows nodes and minikube.
+func collectNode(cluster *v1alpha1.Cluster, s *clusterStatus, runner *status.Runner) {
+	if s.SSH.Reachable {
+		s.Services = map[string]string{}
+		for _, name := range windowsServices {
+			state, err := runner.Service(name)
+			if err != nil {
+				s.addError("service "+name, err)
+			}
+			s.Services[name] = state
+		}
+	}
+
+	var err error
+	if s.Nodes, err = runner.WindowsNodes(); err != nil {
+		s.addError("nodes", err)
+	}
+	if cluster.Spec.ControlPlane.Minikube {
+		if s.Minikube, err = runner.Minikube(); err != nil {
+			s.addError("minikube", err)
+		}
+	}
+}
+
+// collectDomain reads the state and the Windows leases of the domain from the provider,
+// the recorded cluster status is left unchanged since the command is read-only.
+func collectDomain(cluster *v1alpha1.Cluster, s *clusterStatus) {
+	provider, err := newProvider(cluster)
+	if err != nil {
+		s.addError("domain", err)
+		return
+	}
+	defer closeProvider(provider)
+	state, err := provider.State()
+	if err != nil {
+		s.addError("domain", err)
+		return
+	}
+	s.Domain = string(state)
+	if state != drivers.StateRunning {
+		return
+	}
+
+	var leases map[string]map[string]string
+	if leaser, ok := provider.(drivers.NetworkLeaser); ok {
+		leases, err = leaser.NetworkLeases()
+	} else {
+		var leased map[string]string
+		leased, err = provider.Leases()
+		leases = map[string]map[string]string{drivers.Networks(cluster).Private.Name: leased}
+	}
+	if err != nil {
+		s.addError("leases", err)
+	}
+	for network, leased := range leases {
+		if ip, ok := leased[windowsHost]; ok {
+			if s.Leases == nil {
+				s.Leases = map[string]string{}
+			}
+			s.Leases[network] = ip
+		}
+	}
+}
+
+// printStatus writes the status in the output format.
+func printStatus(out io.Writer, output string, s *clusterStatus) error {
+	switch output {
+	case outputJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(s)
+	case outputYAML:
+		content, err := yaml.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(content)
+		return err
+	}
+
+	reachable := "Unreachable"
+	if s.SSH.Reachable {
+		reachable = "Reachable"
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "COMPONENT\tSTATUS\tDETAILS")
+	_, _ = fmt.Fprintf(w, "domain\t%s\t%s\n", s.Domain, s.Name)
+	for _, network := range sortedKeys(s.Leases) {
+		_, _ = fmt.Fprintf(w, "lease/%s\t%s\n", network, s.Leases[network])
+	}
+	_, _ = fmt.Fprintf(w, "ssh\t%s\t%s\n", reachable, s.SSH.Address)
+	for _, name := range sortedKeys(s.Services) {
+		_, _ = fmt.Fprintf(w, "service/%s\t%s\n", name, s.Services[name])
+	}
+	for _, name := range sortedKeys(s.Nodes) {
+		_, _ = fmt.Fprintf(w, "node/%s\t%s\n", name, s.Nodes[name])
+	}
+	if s.Minikube != nil {
+		var details []string
+		for _, component := range sortedKeys(s.Minikube) {
+			if component != "Host" {
+				details = append(details, fmt.Sprintf("%s=%s", strings.ToLower(component), s.Minikube[component]))
+			}
+		}
+		_, _ = fmt.Fprintf(w, "minikube\t%s\t%s\n", s.Minikube["Host"], strings.Join(details, " "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, err := range s.Errors {
+		_, _ = fmt.Fprintln(out, "error:", err)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
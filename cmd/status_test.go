@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"swdt/pkg/drivers"
+	"swdt/pkg/executors/exec"
+	"swdt/pkg/executors/tests"
+	"swdt/pkg/pwsh/status"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectDomain(t *testing.T) {
+	t.Setenv(config.StateHomeEnv, t.TempDir())
+	leases := map[string]string{windowsHost: "192.168.39.10", "swdt-default": "192.168.39.2"}
+	useProvider(t, drivers.NewFake(leases).SetState(drivers.StateRunning))
+
+	s := &clusterStatus{}
+	cluster := &v1alpha1.Cluster{}
+	collectDomain(cluster, s)
+	assert.Equal(t, "Running", s.Domain)
+	assert.Equal(t, map[string]string{"swdt-default-private": "192.168.39.10"}, s.Leases)
+	assert.Empty(t, s.Errors)
+	// the status is read-only, nothing is recorded
+	assert.NoDirExists(t, config.StateDir(cluster))
+
+	useProvider(t, drivers.NewFake(leases).Fail("State", errors.New("libvirt is down")))
+	s = &clusterStatus{Domain: "Unknown"}
+	collectDomain(&v1alpha1.Cluster{}, s)
+	assert.Equal(t, "Unknown", s.Domain)
+	assert.Equal(t, []string{"domain: libvirt is down"}, s.Errors)
+}
+
+func TestCollectNode(t *testing.T) {
+	host := tests.NewWindowsHost(t)
+	host.SetService("containerd", tests.ServiceRunning)
+	remote := exec.NewSSHExecutor(host.Credentials())
+	assert.Nil(t, remote.Connect())
+	t.Cleanup(func() { _ = remote.Close() })
+
+	runner := &status.Runner{}
+	runner.SetRemote(remote)
+	runner.SetLocal(exec.NewDryRunLocalExecutor(&exec.Plan{},
+		exec.Result{Match: regexp.MustCompile(`kubectl get nodes`), Err: errors.New("connection refused")},
+		exec.Result{Match: regexp.MustCompile(`minikube status`), Output: `{"Name":"minikube","Host":"Running","APIServer":"Running"}`}))
+
+	cluster := &v1alpha1.Cluster{}
+	cluster.Spec.ControlPlane.Minikube = true
+	s := &clusterStatus{SSH: sshStatus{Reachable: true}}
+	collectNode(cluster, s, runner)
+	assert.Equal(t, map[string]string{"containerd": "Running", "kubelet": status.ServiceNotFound}, s.Services)
+	assert.Equal(t, map[string]string{"Host": "Running", "APIServer": "Running"}, s.Minikube)
+	assert.Equal(t, []string{"nodes: connection refused"}, s.Errors)
+}
+
+func TestPrintStatus(t *testing.T) {
+	s := &clusterStatus{
+		Name:     "default",
+		Domain:   "Running",
+		Leases:   map[string]string{"swdt-default-private": "192.168.39.10", "swdt-default-nat": "192.168.122.50"},
+		SSH:      sshStatus{Address: "192.168.39.10:22", Reachable: true},
+		Services: map[string]string{"containerd": "Running", "kubelet": "Stopped"},
+		Nodes:    map[string]string{"win-dev": status.NodeNotReady},
+		Minikube: map[string]string{"Host": "Running", "APIServer": "Running", "Kubelet": "Running"},
+		Errors:   []string{"nodes: connection refused"},
+	}
+
+	var out bytes.Buffer
+	assert.Nil(t, printStatus(&out, outputTable, s))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 10)
+	assert.Regexp(t, `^COMPONENT\s+STATUS\s+DETAILS$`, lines[0])
+	assert.Regexp(t, `^domain\s+Running\s+default$`, lines[1])
+	assert.Regexp(t, `^lease/swdt-default-nat\s+192\.168\.122\.50$`, lines[2])
+	assert.Regexp(t, `^lease/swdt-default-private\s+192\.168\.39\.10$`, lines[3])
+	assert.Regexp(t, `^ssh\s+Reachable\s+192\.168\.39\.10:22$`, lines[4])
+	assert.Regexp(t, `^service/kubelet\s+Stopped$`, lines[6])
+	assert.Regexp(t, `^node/win-dev\s+NotReady$`, lines[7])
+	assert.Regexp(t, `^minikube\s+Running\s+apiserver=Running kubelet=Running$`, lines[8])
+	assert.Equal(t, "error: nodes: connection refused", lines[9])
+
+	out.Reset()
+	assert.Nil(t, printStatus(&out, outputJSON, s))
+	decoded := &clusterStatus{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), decoded))
+	assert.Equal(t, s, decoded)
+
+	out.Reset()
+	assert.Nil(t, printStatus(&out, outputYAML, s))
+	assert.Contains(t, out.String(), "ssh:\n  address: 192.168.39.10:22\n  reachable: true\n")
+}
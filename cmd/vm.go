@@ -0,0 +1,273 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/drivers"
+	"swdt/pkg/executors/exec"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"k8s.io/klog/v2"
+)
+
+// consoleEscape is the Ctrl+] character detaching from the console, like virsh.
+const consoleEscape = 0x1d
+
+// vmCmd represents the vm command
+var vmCmd = &cobra.Command{
+	Use:   "vm",
+	Short: "Control the power state of the Windows domain",
+	Long: `Control the power state of the Windows domain created by swdt start.
+Stop sends an ACPI shutdown and forces the stop when the guest does not power off in time.`,
+}
+
+var vmStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Shut the Windows domain down gracefully, forcing it after the timeout",
+	Args:  cobra.NoArgs,
+	RunE:  RunVMStop,
+}
+
+var vmRestartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "Shut the Windows domain down and boot it again",
+	Args:  cobra.NoArgs,
+	RunE:  RunVMRestart,
+}
+
+var vmSuspendCmd = &cobra.Command{
+	Use:   "suspend",
+	Short: "Pause the Windows domain keeping its memory",
+	Args:  cobra.NoArgs,
+	RunE:  RunVMSuspend,
+}
+
+var vmResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Continue the suspended Windows domain",
+	Args:  cobra.NoArgs,
+	RunE:  RunVMResume,
+}
+
+var vmConsoleCmd = &cobra.Command{
+	Use:   "console",
+	Short: "Attach to the serial console of the Windows domain, Ctrl+] detaches",
+	Long: `Attach to the serial console of the Windows domain, Ctrl+] detaches.
+The Windows SAC or the boot logs are available there when the node never gets a lease.`,
+	Args: cobra.NoArgs,
+	RunE: RunVMConsole,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{vmStopCmd, vmRestartCmd} {
+		cmd.Flags().Duration("timeout", drivers.ShutdownTimeout, "Time given to Windows to power off before forcing the stop.")
+	}
+	vmCmd.AddCommand(vmStopCmd, vmRestartCmd, vmSuspendCmd, vmResumeCmd, vmConsoleCmd)
+}
+
+func RunVMStop(cmd *cobra.Command, args []string) error {
+	cluster, err := loadConfiguration(cmd)
+	if err != nil {
+		return err
+	}
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+	return stopVM(cluster, timeout)
+}
+
+func RunVMRestart(cmd *cobra.Command, args []string) error {
+	cluster, err := loadConfiguration(cmd)
+	if err != nil {
+		return err
+	}
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+	return restartVM(cluster, timeout)
+}
+
+func RunVMSuspend(cmd *cobra.Command, args []string) error {
+	cluster, err := loadConfiguration(cmd)
+	if err != nil {
+		return err
+	}
+	return suspendVM(cluster)
+}
+
+func RunVMResume(cmd *cobra.Command, args []string) error {
+	cluster, err := loadConfiguration(cmd)
+	if err != nil {
+		return err
+	}
+	return resumeVM(cluster)
+}
+
+func RunVMConsole(cmd *cobra.Command, args []string) error {
+	cluster, err := loadConfiguration(cmd)
+	if err != nil {
+		return err
+	}
+	return openConsole(cluster)
+}
+
+// stopVM shuts the Windows domain down.
+func stopVM(cluster *v1alpha1.Cluster, timeout time.Duration) error {
+	if plan != nil {
+		plan.Record(exec.TargetLibvirt, fmt.Sprintf("shut the Windows domain down, forcing it after %s", timeout))
+		return nil
+	}
+	return withLifecycle(cluster, func(_ drivers.Provider, lifecycle drivers.Lifecycle) error {
+		klog.Info(resc.Sprintf("Stopping the Windows domain..."))
+		return lifecycle.Shutdown(timeout)
+	})
+}
+
+// restartVM shuts the Windows domain down and starts it again, waiting for its lease.
+func restartVM(cluster *v1alpha1.Cluster, timeout time.Duration) error {
+	if plan != nil {
+		plan.Record(exec.TargetLibvirt, fmt.Sprintf("shut the Windows domain down, forcing it after %s", timeout))
+		plan.Record(exec.TargetLibvirt, "start the Windows domain")
+		plan.Record(exec.TargetLibvirt, fmt.Sprintf("wait %s for the DHCP lease of the Windows domain", timeout))
+		return nil
+	}
+	return withLifecycle(cluster, func(provider drivers.Provider, lifecycle drivers.Lifecycle) error {
+		klog.Info(resc.Sprintf("Restarting the Windows domain..."))
+		if err := lifecycle.Shutdown(timeout); err != nil {
+			return err
+		}
+		if err := provider.Start(); err != nil {
+			return err
+		}
+		_, err := drivers.WaitForLease(provider, timeout)
+		return err
+	})
+}
+
+// suspendVM pauses the Windows domain.
+func suspendVM(cluster *v1alpha1.Cluster) error {
+	if plan != nil {
+		plan.Record(exec.TargetLibvirt, "suspend the Windows domain")
+		return nil
+	}
+	return withLifecycle(cluster, func(_ drivers.Provider, lifecycle drivers.Lifecycle) error {
+		return lifecycle.Suspend()
+	})
+}
+
+// resumeVM continues the suspended Windows domain.
+func resumeVM(cluster *v1alpha1.Cluster) error {
+	if plan != nil {
+		plan.Record(exec.TargetLibvirt, "resume the Windows domain")
+		return nil
+	}
+	return withLifecycle(cluster, func(_ drivers.Provider, lifecycle drivers.Lifecycle) error {
+		return lifecycle.Resume()
+	})
+}
+
+// withLifecycle calls the function with the lifecycle of the provider, then
+// refreshes the recorded cluster status.
+func withLifecycle(cluster *v1alpha1.Cluster, fn func(drivers.Provider, drivers.Lifecycle) error) error {
+	provider, err := newProvider(cluster)
+	if err != nil {
+		return err
+	}
+	defer closeProvider(provider)
+	lifecycle, ok := provider.(drivers.Lifecycle)
+	if !ok {
+		return fmt.Errorf("the %s provider does not manage the machine power", cluster.Spec.Workload.Virtualization.Provider)
+	}
+	if err = fn(provider, lifecycle); err != nil {
+		return err
+	}
+	return refreshStatus(cluster, provider)
+}
+
+// openConsole attaches the terminal in raw mode to the serial console of the Windows domain.
+func openConsole(cluster *v1alpha1.Cluster) error {
+	provider, err := newProvider(cluster)
+	if err != nil {
+		return err
+	}
+	defer closeProvider(provider)
+	console, ok := provider.(drivers.Console)
+	if !ok {
+		return fmt.Errorf("the %s provider has no serial console", cluster.Spec.Workload.Virtualization.Provider)
+	}
+	if plan != nil {
+		plan.Record(exec.TargetLibvirt, "attach to the serial console of the Windows domain")
+		return nil
+	}
+	stream, err := console.OpenConsole()
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(os.Stderr, "Connected to the serial console, escape character is ^]")
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			_ = stream.Close()
+			return err
+		}
+		defer func() { _ = term.Restore(fd, state) }()
+	}
+	return attachConsole(stream, os.Stdin, os.Stdout)
+}
+
+// attachConsole copies the console output to out and the input to the console,
+// it returns when the input ends or carries the escape character. The console is
+// closed on return, once its output is copied.
+func attachConsole(console io.ReadWriteCloser, in io.Reader, out io.Writer) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = io.Copy(out, console)
+	}()
+	defer func() {
+		_ = console.Close()
+		<-done
+	}()
+	buf := make([]byte, 256)
+	for {
+		n, err := in.Read(buf)
+		if i := bytes.IndexByte(buf[:n], consoleEscape); i >= 0 {
+			_, err = console.Write(buf[:i])
+			return err
+		}
+		if n > 0 {
+			if _, werr := console.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"swdt/pkg/drivers"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVMLifecycle(t *testing.T) {
+	t.Setenv(config.StateHomeEnv, t.TempDir())
+	fake := drivers.NewFake(map[string]string{windowsHost: "192.168.39.10"}).SetState(drivers.StateRunning)
+	useProvider(t, fake)
+	cluster := &v1alpha1.Cluster{}
+
+	assert.Nil(t, suspendVM(cluster))
+	recorded := &v1alpha1.Cluster{}
+	assert.Nil(t, config.LoadStatus(recorded))
+	assert.Equal(t, "Paused", recorded.Status.State)
+
+	assert.Nil(t, resumeVM(cluster))
+	assert.Nil(t, restartVM(cluster, time.Second))
+	state, _ := fake.State()
+	assert.Equal(t, drivers.StateRunning, state)
+	// the restart waits for the lease of the Windows machine
+	assert.Contains(t, strings.Join(fake.Calls(), ","), "Shutdown,Start,Leases,")
+
+	assert.Nil(t, stopVM(cluster, time.Second))
+	state, _ = fake.State()
+	assert.Equal(t, drivers.StateStopped, state)
+	assert.EqualError(t, resumeVM(cluster), "Resume: machine is Stopped, not Paused")
+
+	fake.Fail("Shutdown", errors.New("domain is locked"))
+	assert.EqualError(t, restartVM(cluster, time.Second), "domain is locked")
+	assert.Contains(t, strings.Join(fake.Calls(), ","), "Suspend,")
+}
+
+func TestVMUnsupported(t *testing.T) {
+	cluster := &v1alpha1.Cluster{}
+	cluster.Spec.Workload.Virtualization.Provider = v1alpha1.ProviderNone
+	useProvider(t, drivers.NewNone(cluster))
+	assert.EqualError(t, stopVM(cluster, time.Second), "the none provider does not manage the machine power")
+	assert.EqualError(t, openConsole(cluster), "the none provider has no serial console")
+}
+
+// console is a serial pty recording the input, its output blocks until it is closed.
+type console struct {
+	input  bytes.Buffer
+	closed chan struct{}
+}
+
+func newConsole() *console { return &console{closed: make(chan struct{})} }
+
+func (c *console) Read(p []byte) (int, error) {
+	<-c.closed
+	return 0, io.EOF
+}
+func (c *console) Write(p []byte) (int, error) { return c.input.Write(p) }
+func (c *console) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestAttachConsole(t *testing.T) {
+	pty := newConsole()
+	assert.Nil(t, attachConsole(pty, strings.NewReader("cmd\r\x1dignored"), io.Discard))
+	assert.Equal(t, "cmd\r", pty.input.String())
+
+	// the console is left when the input ends, and closed
+	pty = newConsole()
+	assert.Nil(t, attachConsole(pty, strings.NewReader("ch -si 1\r"), io.Discard))
+	assert.Equal(t, "ch -si 1\r", pty.input.String())
+	select {
+	case <-pty.closed:
+	default:
+		t.Error("the console is not closed")
+	}
+}
@@ -7,17 +7,22 @@ require (
 	github.com/docker/docker v24.0.7+incompatible
 	github.com/docker/machine v0.16.2
 	github.com/fatih/color v1.16.0
+	github.com/kdomanski/iso9660 v0.4.0
 	github.com/pkg/errors v0.9.1
+	github.com/pkg/sftp v1.13.6
 	github.com/spf13/cobra v1.8.0
 	github.com/stretchr/testify v1.8.4
 	golang.org/x/crypto v0.14.0
+	golang.org/x/sync v0.5.0
 	golang.org/x/term v0.13.0
 	k8s.io/apimachinery v0.29.0
 	k8s.io/component-base v0.28.3
 	k8s.io/klog/v2 v2.110.1
 	k8s.io/minikube v1.32.0
 	libvirt.org/go/libvirt v1.10001.0
+	libvirt.org/go/libvirtxml v1.10001.0
 	sigs.k8s.io/controller-runtime v0.16.3
+	sigs.k8s.io/yaml v1.3.0
 )
 
 require (
@@ -39,6 +44,7 @@ require (
 	github.com/juju/clock v1.0.3 // indirect
 	github.com/juju/errors v0.0.0-20220203013757-bd733f3c86b9 // indirect
 	github.com/juju/mutex/v2 v2.0.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
@@ -53,7 +59,6 @@ require (
 	github.com/prometheus/procfs v0.10.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/net v0.17.0 // indirect
-	golang.org/x/sync v0.5.0 // indirect
 	golang.org/x/sys v0.14.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
@@ -64,7 +69,6 @@ require (
 	k8s.io/utils v0.0.0-20230726121419-3b25d923346b // indirect
 	sigs.k8s.io/json v0.0.0-20221116044647-bc3834ca7abd // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.4.1 // indirect
-	sigs.k8s.io/yaml v1.3.0 // indirect
 )
 
 replace (
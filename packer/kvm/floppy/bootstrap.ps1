@@ -9,6 +9,18 @@ $authorizedKey = Get-Content -Path A:\ssh_key.pub
 Add-Content -Force -Path $env:ProgramData\ssh\administrators_authorized_keys -Value $authorizedKey
 icacls.exe ""$env:ProgramData\ssh\administrators_authorized_keys"" /inheritance:r /grant ""Administrators:F"" /grant ""SYSTEM:F""
 
+# Install the loader of the swdt config medium, attached to the domain by swdt start.
+# The agent on the medium sets the hostname, authorized key and password at boot.
+echo "Installing swdt first-boot loader."
+New-Item -ItemType Directory -Force -Path $env:ProgramData\swdt | Out-Null
+Set-Content -Path $env:ProgramData\swdt\loader.ps1 -Value @'
+$volume = Get-Volume | Where-Object { $_.FileSystemLabel -eq 'SWDTCONFIG' -and $_.DriveLetter } | Select-Object -First 1
+if ($volume) { & "$($volume.DriveLetter):\agent.ps1" }
+'@
+$action = New-ScheduledTaskAction -Execute "powershell.exe" -Argument "-NoProfile -ExecutionPolicy Bypass -File $env:ProgramData\swdt\loader.ps1"
+$trigger = New-ScheduledTaskTrigger -AtStartup
+Register-ScheduledTask -TaskName "swdt-firstboot" -Action $action -Trigger $trigger -User "SYSTEM" -RunLevel Highest -Force | Out-Null
+
 # Enable required features for Hyper-V and Containers
 echo "Installing Containers feature.."
 Install-WindowsFeature -Name "Containers"
@@ -19,6 +19,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 
 	"swdt/apis/config/v1alpha1"
 
@@ -59,6 +61,62 @@ func loadConfigNode(data []byte) (*v1alpha1.Cluster, error) {
 	if !ok {
 		return nil, fmt.Errorf("got unexpected config type: %v", gvk)
 	}
+	if err = ValidateClusterName(config); err != nil {
+		return nil, err
+	}
 	config.Spec.Defaults()
+	config.Spec.Workload.Virtualization.Networks.Defaults(ResourceName(config, "nat"), ResourceName(config, "private"))
+	if err = ValidateSSH(config.Spec.Workload.Virtualization.SSH); err != nil {
+		return nil, err
+	}
+	if err = ValidateShares(config.Spec.Workload.Virtualization.Shares); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
+
+// ValidateSSH checks the file transfer protocol of the SSH settings.
+func ValidateSSH(ssh *v1alpha1.SSHSpec) error {
+	if ssh == nil {
+		return nil
+	}
+	switch ssh.Transfer {
+	case "", v1alpha1.TransferSCP, v1alpha1.TransferSFTP:
+		return nil
+	default:
+		return fmt.Errorf("unsupported transfer %q, use %s or %s", ssh.Transfer, v1alpha1.TransferSCP, v1alpha1.TransferSFTP)
+	}
+}
+
+var (
+	// shareName matches the virtiofs tags and the Samba share names.
+	shareName = regexp.MustCompile(`^[A-Za-z0-9][-A-Za-z0-9_.]{0,35}$`)
+	// driveLetter matches the drives free for the shares, C is the system one.
+	driveLetter = regexp.MustCompile(`^[D-Z]$`)
+)
+
+// ValidateShares checks the shares have distinct names and drive letters, an absolute
+// host path and a supported protocol.
+func ValidateShares(shares []v1alpha1.ShareSpec) error {
+	names, drives := map[string]bool{}, map[string]bool{}
+	for _, share := range shares {
+		switch {
+		case !shareName.MatchString(share.Name):
+			return fmt.Errorf("invalid share name %q, use up to 36 letters, digits, '-', '_' and '.'", share.Name)
+		case names[share.Name]:
+			return fmt.Errorf("duplicate share %s", share.Name)
+		case !filepath.IsAbs(share.HostPath):
+			return fmt.Errorf("host path %q of share %s is not absolute", share.HostPath, share.Name)
+		case !driveLetter.MatchString(share.DriveLetter):
+			return fmt.Errorf("invalid drive letter %q of share %s, use an uppercase letter from D to Z", share.DriveLetter, share.Name)
+		case drives[share.DriveLetter]:
+			return fmt.Errorf("drive %s: of share %s is used by another share", share.DriveLetter, share.Name)
+		case share.Protocol != v1alpha1.ShareVirtioFS && share.Protocol != v1alpha1.ShareSMB:
+			return fmt.Errorf("unsupported protocol %q of share %s, use %s or %s", share.Protocol, share.Name, v1alpha1.ShareVirtioFS, v1alpha1.ShareSMB)
+		case share.Protocol == v1alpha1.ShareSMB && share.Username == "":
+			return fmt.Errorf("share %s requires a username for %s", share.Name, v1alpha1.ShareSMB)
+		}
+		names[share.Name], drives[share.DriveLetter] = true, true
+	}
+	return nil
+}
@@ -17,8 +17,11 @@ limitations under the License.
 package config
 
 import (
+	"strings"
 	"testing"
 
+	"swdt/apis/config/v1alpha1"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -37,6 +40,37 @@ func TestLoadConfigNodeDefaults(t *testing.T) {
 
 	assert.True(t, *config.Spec.Workload.Auxiliary.EnableRDP)
 	assert.Len(t, *config.Spec.Workload.Auxiliary.ChocoPackages, 0)
+	assert.Equal(t, "libvirt", config.Spec.Workload.Virtualization.Provider)
+	networks := config.Spec.Workload.Virtualization.Networks
+	assert.Equal(t, v1alpha1.NetworkSpec{Name: "swdt-sample-nat"}, networks.NAT)
+	assert.Equal(t, v1alpha1.NetworkSpec{Name: "swdt-sample-private"}, networks.Private)
+}
+
+func TestLoadConfigNodeExistingNetwork(t *testing.T) {
+	config, err := loadConfigNode([]byte(SAMPLE_DEFAULT + `
+  workload:
+    virtualization:
+      networks:
+        private:
+          name: mk-minikube
+          existing: true`))
+	assert.Nil(t, err)
+	// the existing network keeps its own subnet
+	assert.Equal(t, v1alpha1.NetworkSpec{Name: "mk-minikube", Existing: true}, config.Spec.Workload.Virtualization.Networks.Private)
+}
+
+func TestLoadConfigNodeName(t *testing.T) {
+	_, err := loadConfigNode([]byte(strings.Replace(SAMPLE_DEFAULT, "name: sample", "name: Team_A", 1)))
+	assert.EqualError(t, err, `invalid cluster name "Team_A", use up to 40 lowercase letters, digits and '-'`)
+}
+
+func TestLoadConfigNodeTransfer(t *testing.T) {
+	_, err := loadConfigNode([]byte(SAMPLE_DEFAULT + `
+  workload:
+    virtualization:
+      ssh:
+        transfer: rsync`))
+	assert.EqualError(t, err, `unsupported transfer "rsync", use scp or sftp`)
 }
 
 func TestLoadConfigNode(t *testing.T) {
@@ -54,3 +88,38 @@ func TestLoadConfigNode(t *testing.T) {
 		assert.GreaterOrEqual(t, len(d.Destination), 4)
 	}
 }
+
+func TestLoadConfigNodeShares(t *testing.T) {
+	config, err := loadConfigNode([]byte(SAMPLE_DEFAULT + `
+  workload:
+    virtualization:
+      shares:
+        - name: k8s
+          hostPath: /home/user/kubernetes/_output
+          driveLetter: K`))
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha1.ShareVirtioFS, config.Spec.Workload.Virtualization.Shares[0].Protocol)
+}
+
+func TestValidateShares(t *testing.T) {
+	share := v1alpha1.ShareSpec{Name: "k8s", HostPath: "/home/user/k8s", DriveLetter: "K", Protocol: v1alpha1.ShareVirtioFS}
+	assert.Nil(t, ValidateShares([]v1alpha1.ShareSpec{share}))
+
+	invalid := func(change func(*v1alpha1.ShareSpec)) []v1alpha1.ShareSpec {
+		s := share
+		change(&s)
+		return []v1alpha1.ShareSpec{s}
+	}
+	for expected, shares := range map[string][]v1alpha1.ShareSpec{
+		`invalid share name "k8s src", use up to 36 letters, digits, '-', '_' and '.'`: invalid(func(s *v1alpha1.ShareSpec) { s.Name = "k8s src" }),
+		`host path "k8s" of share k8s is not absolute`:                                 invalid(func(s *v1alpha1.ShareSpec) { s.HostPath = "k8s" }),
+		`invalid drive letter "C" of share k8s, use an uppercase letter from D to Z`:   invalid(func(s *v1alpha1.ShareSpec) { s.DriveLetter = "C" }),
+		`invalid drive letter "k:" of share k8s, use an uppercase letter from D to Z`:  invalid(func(s *v1alpha1.ShareSpec) { s.DriveLetter = "k:" }),
+		`unsupported protocol "nfs" of share k8s, use virtiofs or smb`:                 invalid(func(s *v1alpha1.ShareSpec) { s.Protocol = "nfs" }),
+		`share k8s requires a username for smb`:                                        invalid(func(s *v1alpha1.ShareSpec) { s.Protocol = v1alpha1.ShareSMB }),
+		`duplicate share k8s`:                                                          {share, share},
+		`drive K: of share src is used by another share`:                               {share, {Name: "src", HostPath: "/src", DriveLetter: "K", Protocol: v1alpha1.ShareVirtioFS}},
+	} {
+		assert.EqualError(t, ValidateShares(shares), expected)
+	}
+}
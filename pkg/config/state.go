@@ -0,0 +1,192 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"swdt/apis/config/v1alpha1"
+
+	klog "k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// StateHomeEnv overrides the directory holding the state of the clusters.
+	StateHomeEnv = "SWDT_HOME"
+	// ResourcePrefix starts the names of the host resources created by swdt.
+	ResourcePrefix = "swdt-"
+
+	defaultClusterName = "default"
+	statusFile         = "status.yaml"
+)
+
+// clusterName matches the cluster names usable in the host resource names.
+var clusterName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,38}[a-z0-9])?$`)
+
+// StateHome returns the directory holding the state of the clusters, $SWDT_HOME or ~/.swdt.
+func StateHome() string {
+	if home := os.Getenv(StateHomeEnv); home != "" {
+		return home
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".swdt"
+	}
+	return filepath.Join(home, ".swdt")
+}
+
+// Owner is the user running swdt with its state home. It is recorded on the libvirt
+// domains since several users can share the libvirt daemon of qemu:///system.
+type Owner struct {
+	User string
+	UID  string
+	Home string
+}
+
+// CurrentOwner returns the owner of the resources created by the running user.
+func CurrentOwner() Owner {
+	owner := Owner{UID: strconv.Itoa(os.Getuid()), Home: StateHome()}
+	if current, err := user.Current(); err == nil {
+		owner.User = current.Username
+	}
+	if home, err := filepath.Abs(owner.Home); err == nil {
+		owner.Home = home
+	}
+	return owner
+}
+
+// IsZero reports whether the owner is not recorded, like on the domains tagged before.
+func (o Owner) IsZero() bool {
+	return o == Owner{}
+}
+
+func (o Owner) String() string {
+	return fmt.Sprintf("%s (uid %s, %s)", o.User, o.UID, o.Home)
+}
+
+// ClusterName returns the metadata name of the cluster, default when empty.
+func ClusterName(config *v1alpha1.Cluster) string {
+	if config.Name == "" {
+		return defaultClusterName
+	}
+	return config.Name
+}
+
+// ValidateClusterName checks the metadata name can be used in the host resource names.
+func ValidateClusterName(config *v1alpha1.Cluster) error {
+	if config.Name != "" && !clusterName.MatchString(config.Name) {
+		return fmt.Errorf("invalid cluster name %q, use up to 40 lowercase letters, digits and '-'", config.Name)
+	}
+	return nil
+}
+
+// ResourceName returns the name of a host resource of the cluster, like its libvirt
+// domain, prefixed by the cluster name so parallel clusters do not collide.
+func ResourceName(config *v1alpha1.Cluster, suffix string) string {
+	return ResourcePrefix + ClusterName(config) + "-" + suffix
+}
+
+// MinikubeProfile returns the minikube profile running the control plane of the cluster,
+// its machine gets the profile as hostname.
+func MinikubeProfile(config *v1alpha1.Cluster) string {
+	return ResourcePrefix + ClusterName(config)
+}
+
+// MinikubeCommand returns the minikube command line on the profile, the active one when empty.
+func MinikubeCommand(profile string, args ...string) []string {
+	if profile != "" {
+		args = append([]string{"-p", profile}, args...)
+	}
+	return append([]string{"minikube"}, args...)
+}
+
+// KubectlCommand returns the kubectl command line on the context minikube names after
+// the profile, the current context when empty.
+func KubectlCommand(profile string, args ...string) []string {
+	if profile != "" {
+		args = append([]string{"--context", profile}, args...)
+	}
+	return append([]string{"kubectl"}, args...)
+}
+
+// StateDir returns the state directory of the cluster.
+func StateDir(config *v1alpha1.Cluster) string {
+	return filepath.Join(StateHome(), "clusters", ClusterName(config))
+}
+
+// SaveStatus writes the cluster status in the state directory.
+func SaveStatus(config *v1alpha1.Cluster) error {
+	dir := StateDir(config)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(config.Status)
+	if err != nil {
+		return err
+	}
+	klog.V(2).Infof("Saving cluster status in '%s'", dir)
+	return os.WriteFile(filepath.Join(dir, statusFile), data, 0o644)
+}
+
+// RemoveState deletes the state directory of the cluster.
+func RemoveState(config *v1alpha1.Cluster) error {
+	return os.RemoveAll(StateDir(config))
+}
+
+// ListClusters returns the clusters having a state directory with their recorded
+// status, ordered by name.
+func ListClusters() ([]*v1alpha1.Cluster, error) {
+	entries, err := os.ReadDir(filepath.Join(StateHome(), "clusters"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var clusters []*v1alpha1.Cluster
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		cluster := &v1alpha1.Cluster{}
+		cluster.Name = entry.Name()
+		if err = LoadStatus(cluster); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+// LoadStatus reads the recorded status into the cluster, it is left empty when
+// nothing was recorded yet.
+func LoadStatus(config *v1alpha1.Cluster) error {
+	data, err := os.ReadFile(filepath.Join(StateDir(config), statusFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, &config.Status)
+}
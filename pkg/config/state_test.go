@@ -0,0 +1,103 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"swdt/apis/config/v1alpha1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(StateHomeEnv, home)
+
+	config := &v1alpha1.Cluster{}
+	assert.Equal(t, filepath.Join(home, "clusters", "default"), StateDir(config))
+	config.Name = "sample"
+	assert.Equal(t, filepath.Join(home, "clusters", "sample"), StateDir(config))
+}
+
+func TestResourceNames(t *testing.T) {
+	config := &v1alpha1.Cluster{}
+	assert.Equal(t, "swdt-default-windows", ResourceName(config, "windows"))
+	assert.Equal(t, "swdt-default", MinikubeProfile(config))
+	config.Name = "team-a"
+	assert.Equal(t, "swdt-team-a-private", ResourceName(config, "private"))
+	assert.Equal(t, "swdt-team-a", MinikubeProfile(config))
+}
+
+func TestListClusters(t *testing.T) {
+	t.Setenv(StateHomeEnv, t.TempDir())
+	clusters, err := ListClusters()
+	assert.Nil(t, err)
+	assert.Empty(t, clusters)
+
+	for _, name := range []string{"team-b", "team-a"} {
+		config := &v1alpha1.Cluster{}
+		config.Name = name
+		config.Status.State = "Running"
+		assert.Nil(t, SaveStatus(config))
+	}
+	removed := &v1alpha1.Cluster{}
+	removed.Name = "team-b"
+	assert.Nil(t, RemoveState(removed))
+
+	clusters, err = ListClusters()
+	assert.Nil(t, err)
+	assert.Len(t, clusters, 1)
+	assert.Equal(t, "team-a", clusters[0].Name)
+	assert.Equal(t, "Running", clusters[0].Status.State)
+}
+
+func TestSaveStatus(t *testing.T) {
+	t.Setenv(StateHomeEnv, t.TempDir())
+
+	config := &v1alpha1.Cluster{}
+	config.Name = "sample"
+	assert.Nil(t, LoadStatus(config))
+	assert.Empty(t, config.Status.State)
+
+	config.Status = v1alpha1.ClusterStatus{State: "Running", Snapshot: "post-setup", Leases: map[string]string{"windows": "192.168.39.10"}}
+	assert.Nil(t, SaveStatus(config))
+
+	loaded := &v1alpha1.Cluster{}
+	loaded.Name = "sample"
+	assert.Nil(t, LoadStatus(loaded))
+	assert.Equal(t, config.Status, loaded.Status)
+}
+
+func TestMinikubeCommands(t *testing.T) {
+	assert.Equal(t, []string{"minikube", "-p", "swdt-dev", "ip"}, MinikubeCommand("swdt-dev", "ip"))
+	assert.Equal(t, []string{"kubectl", "--context", "swdt-dev", "get", "nodes"}, KubectlCommand("swdt-dev", "get", "nodes"))
+	// the active profile and the current context are used without profile
+	assert.Equal(t, []string{"minikube", "ip"}, MinikubeCommand("", "ip"))
+	assert.Equal(t, []string{"kubectl", "get", "nodes"}, KubectlCommand("", "get", "nodes"))
+}
+
+func TestCurrentOwner(t *testing.T) {
+	t.Setenv(StateHomeEnv, "/srv/swdt")
+	owner := CurrentOwner()
+	assert.Equal(t, strconv.Itoa(os.Getuid()), owner.UID)
+	assert.Equal(t, "/srv/swdt", owner.Home)
+	assert.False(t, owner.IsZero())
+}
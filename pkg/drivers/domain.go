@@ -0,0 +1,354 @@
+package drivers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"time"
+
+	"libvirt.org/go/libvirtxml"
+)
+
+// DomainMetadataCluster tags the domains created by swdt with their cluster and owner,
+// in the swdt namespace libvirt requires for the metadata elements.
+type DomainMetadataCluster struct {
+	XMLName xml.Name `xml:"https://sigs.k8s.io/swdt cluster"`
+	Name    string   `xml:"name,attr"`
+	User    string   `xml:"user,attr,omitempty"`
+	UID     string   `xml:"uid,attr,omitempty"`
+	Home    string   `xml:"home,attr,omitempty"`
+	// Created is the definition time in RFC 3339.
+	Created string `xml:"created,attr,omitempty"`
+}
+
+// Owner returns the user who created the domain, the zero value when it is not recorded.
+func (c DomainMetadataCluster) Owner() config.Owner {
+	return config.Owner{User: c.User, UID: c.UID, Home: c.Home}
+}
+
+// CreatedAt returns the time the domain was defined by swdt, zero when it is not recorded.
+func (c DomainMetadataCluster) CreatedAt() time.Time {
+	created, _ := time.Parse(time.RFC3339, c.Created)
+	return created
+}
+
+// domainCluster returns the swdt tag in the metadata of the domain, the zero value
+// when the domain is not tagged. libvirt keeps the metadata elements of the other
+// applications next to it.
+func domainCluster(domain *libvirtxml.Domain) DomainMetadataCluster {
+	var metadata struct {
+		Cluster DomainMetadataCluster `xml:"https://sigs.k8s.io/swdt cluster"`
+	}
+	if domain.Metadata == nil {
+		return DomainMetadataCluster{}
+	}
+	if err := xml.Unmarshal([]byte("<metadata>"+domain.Metadata.XML+"</metadata>"), &metadata); err != nil {
+		return DomainMetadataCluster{}
+	}
+	return metadata.Cluster
+}
+
+// setDomainCluster replaces the metadata of the domain with the swdt tag.
+func setDomainCluster(domain *libvirtxml.Domain, cluster DomainMetadataCluster) error {
+	tag, err := xml.Marshal(cluster)
+	if err != nil {
+		return err
+	}
+	domain.Metadata = &libvirtxml.DomainMetadata{XML: string(tag)}
+	return nil
+}
+
+// DomainSpec holds the values of the Windows domain definition.
+type DomainSpec struct {
+	Name     string
+	Cluster  string       // tagged in the metadata
+	Owner    config.Owner // tagged in the metadata with the cluster
+	Created  time.Time    // tagged in the metadata with the cluster
+	Memory   uint         // MiB
+	CPU      uint
+	DiskPath string
+	Networks []string
+	v1alpha1.VirtualizationSpec
+}
+
+// NewDomain builds the Windows domain: a q35 machine with Hyper-V enlightenments,
+// the Windows disk followed by the extra disks, one virtio interface per network and
+// one virtiofs device per virtiofs share. The XML patch of the spec is merged last.
+func NewDomain(spec DomainSpec) (*libvirtxml.Domain, error) {
+	machine := spec.Machine
+	if machine == "" {
+		machine = "q35"
+	}
+	port, usbBus := uint(0), uint(0)
+	dom := &libvirtxml.Domain{
+		Type:   "kvm",
+		Name:   spec.Name,
+		Memory: &libvirtxml.DomainMemory{Value: spec.Memory, Unit: "MiB"},
+		VCPU:   &libvirtxml.DomainVCPU{Placement: "static", Value: spec.CPU},
+		OS: &libvirtxml.DomainOS{
+			Type:        &libvirtxml.DomainOSType{Arch: "x86_64", Machine: machine, Type: "hvm"},
+			BootDevices: []libvirtxml.DomainBootDevice{{Dev: "hd"}},
+		},
+		Features: &libvirtxml.DomainFeatureList{
+			ACPI: &libvirtxml.DomainFeature{},
+			APIC: &libvirtxml.DomainFeatureAPIC{},
+			HyperV: &libvirtxml.DomainFeatureHyperV{
+				Mode:      "custom",
+				Relaxed:   &libvirtxml.DomainFeatureState{State: "on"},
+				VAPIC:     &libvirtxml.DomainFeatureState{State: "on"},
+				Spinlocks: &libvirtxml.DomainFeatureHyperVSpinlocks{DomainFeatureState: libvirtxml.DomainFeatureState{State: "on"}, Retries: 8191},
+			},
+			VMPort: &libvirtxml.DomainFeatureState{State: "off"},
+		},
+		CPU: &libvirtxml.DomainCPU{Mode: "host-passthrough", Check: "none", Migratable: "on"},
+		Clock: &libvirtxml.DomainClock{
+			Offset: "localtime",
+			Timer: []libvirtxml.DomainTimer{
+				{Name: "rtc", TickPolicy: "catchup"},
+				{Name: "pit", TickPolicy: "delay"},
+				{Name: "hpet", Present: "no"},
+				{Name: "hypervclock", Present: "yes"},
+			},
+		},
+		OnPoweroff: "destroy",
+		OnReboot:   "restart",
+		OnCrash:    "destroy",
+		PM: &libvirtxml.DomainPM{
+			SuspendToMem:  &libvirtxml.DomainPMPolicy{Enabled: "no"},
+			SuspendToDisk: &libvirtxml.DomainPMPolicy{Enabled: "no"},
+		},
+		Devices: &libvirtxml.DomainDeviceList{
+			Emulator: spec.Emulator,
+			Consoles: []libvirtxml.DomainConsole{{
+				Source: &libvirtxml.DomainChardevSource{Pty: &libvirtxml.DomainChardevSourcePty{}},
+				Target: &libvirtxml.DomainConsoleTarget{Type: "serial", Port: &port},
+			}},
+			Inputs: []libvirtxml.DomainInput{
+				{Type: "tablet", Bus: "usb", Address: &libvirtxml.DomainAddress{USB: &libvirtxml.DomainAddressUSB{Bus: &usbBus, Port: "1"}}},
+				{Type: "mouse", Bus: "ps2"},
+				{Type: "keyboard", Bus: "ps2"},
+			},
+			Graphics: []libvirtxml.DomainGraphic{{
+				Spice: &libvirtxml.DomainGraphicSpice{
+					AutoPort:  "yes",
+					Listeners: []libvirtxml.DomainGraphicListener{{Address: &libvirtxml.DomainGraphicListenerAddress{}}},
+					Image:     &libvirtxml.DomainGraphicSpiceImage{Compression: "off"},
+				},
+			}},
+			Videos: []libvirtxml.DomainVideo{newVideo(spec.VideoModel)},
+		},
+	}
+
+	if spec.Cluster != "" {
+		cluster := DomainMetadataCluster{Name: spec.Cluster, User: spec.Owner.User, UID: spec.Owner.UID, Home: spec.Owner.Home}
+		if !spec.Created.IsZero() {
+			cluster.Created = spec.Created.UTC().Format(time.RFC3339)
+		}
+		if err := setDomainCluster(dom, cluster); err != nil {
+			return nil, err
+		}
+	}
+	disks, err := newDisks(spec.DiskPath, spec.DiskBus, spec.ExtraDisks)
+	if err != nil {
+		return nil, err
+	}
+	dom.Devices.Disks = disks
+	for _, network := range spec.Networks {
+		dom.Devices.Interfaces = append(dom.Devices.Interfaces, libvirtxml.DomainInterface{
+			Source: &libvirtxml.DomainInterfaceSource{Network: &libvirtxml.DomainInterfaceSourceNetwork{Network: network}},
+			Model:  &libvirtxml.DomainInterfaceModel{Type: "virtio"},
+		})
+	}
+
+	for _, share := range spec.Shares {
+		if share.Protocol == v1alpha1.ShareSMB {
+			continue
+		}
+		dom.Devices.Filesystems = append(dom.Devices.Filesystems, libvirtxml.DomainFilesystem{
+			AccessMode: "passthrough",
+			Driver:     &libvirtxml.DomainFilesystemDriver{Type: "virtiofs"},
+			Source:     &libvirtxml.DomainFilesystemSource{Mount: &libvirtxml.DomainFilesystemSourceMount{Dir: share.HostPath}},
+			Target:     &libvirtxml.DomainFilesystemTarget{Dir: share.Name},
+		})
+	}
+
+	if spec.XMLPatch != "" {
+		if err := applyPatch(dom, spec.XMLPatch); err != nil {
+			return nil, fmt.Errorf("failed applying the domain XML patch: %w", err)
+		}
+	}
+	if len(dom.Devices.Filesystems) > 0 && dom.MemoryBacking == nil {
+		// virtiofsd requires the guest memory in shared memfd pages, a memory
+		// backing set by the XML patch is kept.
+		dom.MemoryBacking = &libvirtxml.DomainMemoryBacking{
+			MemorySource: &libvirtxml.DomainMemorySource{Type: "memfd"},
+			MemoryAccess: &libvirtxml.DomainMemoryAccess{Mode: "shared"},
+		}
+	}
+	return dom, nil
+}
+
+// newVideo returns the primary video device of the model, with the QXL memory sizes
+// libvirt defaults to.
+func newVideo(model string) libvirtxml.DomainVideo {
+	switch model {
+	case "", "qxl":
+		return libvirtxml.DomainVideo{
+			Model: libvirtxml.DomainVideoModel{Type: "qxl", Ram: 65536, VRam: 65536, VGAMem: 16384, Heads: 1, Primary: "yes"},
+		}
+	case "none":
+		return libvirtxml.DomainVideo{Model: libvirtxml.DomainVideoModel{Type: model}}
+	default:
+		return libvirtxml.DomainVideo{Model: libvirtxml.DomainVideoModel{Type: model, Heads: 1, Primary: "yes"}}
+	}
+}
+
+// applyPatch merges the XML patch into the domain. Unmarshalling appends to the
+// lists, so the generated elements the patch redefines are dropped first: the timer
+// of the same name, the disk on the same target, the interface with the same MAC or
+// network, the filesystem with the same target and the input of the same type and
+// bus. The video, graphics and console devices of the patch replace the generated ones.
+func applyPatch(dom *libvirtxml.Domain, patch string) error {
+	var elements libvirtxml.Domain
+	if err := elements.Unmarshal(patch); err != nil {
+		return err
+	}
+	if elements.Clock != nil && dom.Clock != nil {
+		dom.Clock.Timer = replaced(dom.Clock.Timer, elements.Clock.Timer, func(timer libvirtxml.DomainTimer) string {
+			return timer.Name
+		})
+	}
+	if devices := elements.Devices; devices != nil && dom.Devices != nil {
+		dom.Devices.Disks = replaced(dom.Devices.Disks, devices.Disks, func(disk libvirtxml.DomainDisk) string {
+			if disk.Target == nil {
+				return ""
+			}
+			return disk.Target.Dev
+		})
+		dom.Devices.Interfaces = replaced(dom.Devices.Interfaces, devices.Interfaces, func(iface libvirtxml.DomainInterface) string {
+			if iface.MAC != nil {
+				return iface.MAC.Address
+			} else if iface.Source != nil && iface.Source.Network != nil {
+				return iface.Source.Network.Network
+			}
+			return ""
+		})
+		dom.Devices.Filesystems = replaced(dom.Devices.Filesystems, devices.Filesystems, func(fs libvirtxml.DomainFilesystem) string {
+			if fs.Target == nil {
+				return ""
+			}
+			return fs.Target.Dir
+		})
+		dom.Devices.Inputs = replaced(dom.Devices.Inputs, devices.Inputs, func(input libvirtxml.DomainInput) string {
+			return input.Type + "/" + input.Bus
+		})
+		if len(devices.Videos) > 0 {
+			dom.Devices.Videos = nil
+		}
+		if len(devices.Graphics) > 0 {
+			dom.Devices.Graphics = nil
+		}
+		if len(devices.Consoles) > 0 {
+			dom.Devices.Consoles = nil
+		}
+	}
+	return xml.Unmarshal([]byte(patch), dom)
+}
+
+// replaced returns the items without the ones having the key of a patch item.
+func replaced[T any](items, patch []T, key func(T) string) []T {
+	keys := map[string]bool{}
+	for _, item := range patch {
+		if k := key(item); k != "" {
+			keys[k] = true
+		}
+	}
+	kept := make([]T, 0, len(items))
+	for _, item := range items {
+		if !keys[key(item)] {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// newDisks returns the Windows disk and the extra disks, named in order on each bus.
+func newDisks(path, bus string, extra []v1alpha1.DiskSpec) ([]libvirtxml.DomainDisk, error) {
+	if bus == "" {
+		bus = v1alpha1.DiskBusSATA
+	}
+	specs := append([]v1alpha1.DiskSpec{{Path: path, Bus: bus}}, extra...)
+	disks := make([]libvirtxml.DomainDisk, 0, len(specs))
+	next := map[string]byte{}
+	for _, spec := range specs {
+		device, format, diskBus := spec.Device, spec.Format, spec.Bus
+		if device == "" {
+			device = "disk"
+		}
+		if diskBus == "" {
+			diskBus = bus
+		}
+		if device == "cdrom" {
+			// virtio has no removable media, the ISOs go on the SATA controller.
+			diskBus = v1alpha1.DiskBusSATA
+		}
+		if format == "" {
+			format = "qcow2"
+			if device == "cdrom" {
+				format = "raw"
+			}
+		}
+
+		var prefix string
+		switch diskBus {
+		case v1alpha1.DiskBusSATA:
+			prefix = "sd"
+		case v1alpha1.DiskBusVirtio:
+			prefix = "vd"
+		default:
+			return nil, fmt.Errorf("unsupported disk bus %q for %s, use %s or %s", diskBus, spec.Path, v1alpha1.DiskBusSATA, v1alpha1.DiskBusVirtio)
+		}
+		disk := libvirtxml.DomainDisk{
+			Device: device,
+			Driver: &libvirtxml.DomainDiskDriver{Name: "qemu", Type: format},
+			Source: &libvirtxml.DomainDiskSource{File: &libvirtxml.DomainDiskSourceFile{File: spec.Path}},
+			Target: &libvirtxml.DomainDiskTarget{Dev: fmt.Sprintf("%s%c", prefix, 'a'+next[prefix]), Bus: diskBus},
+		}
+		if device == "cdrom" {
+			disk.ReadOnly = &libvirtxml.DomainDiskReadOnly{}
+		}
+		next[prefix]++
+		disks = append(disks, disk)
+	}
+	return disks, nil
+}
+
+// Sharer is implemented by the providers exposing host directories to the machine.
+type Sharer interface {
+	// CheckShares fails when a share of the configuration is missing from the machine.
+	CheckShares() error
+}
+
+// missingShares returns the virtiofs shares without filesystem in the domain, the
+// devices are only added when the domain is defined.
+func missingShares(domain *libvirtxml.Domain, shares []v1alpha1.ShareSpec) []string {
+	defined := map[string]string{}
+	if domain.Devices != nil {
+		for _, fs := range domain.Devices.Filesystems {
+			if fs.Target != nil && fs.Source != nil && fs.Source.Mount != nil {
+				defined[fs.Target.Dir] = fs.Source.Mount.Dir
+			}
+		}
+	}
+	var missing []string
+	for _, share := range shares {
+		if share.Protocol == v1alpha1.ShareSMB {
+			continue
+		}
+		if dir, ok := defined[share.Name]; !ok || dir != share.HostPath {
+			missing = append(missing, share.Name)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,228 @@
+package drivers
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"libvirt.org/go/libvirtxml"
+)
+
+func windowsSpec(virtualization v1alpha1.VirtualizationSpec) DomainSpec {
+	return DomainSpec{
+		Name:               "windows",
+		Cluster:            "dev",
+		Owner:              config.Owner{User: "dev", UID: "1000", Home: "/home/dev/.swdt"},
+		Memory:             6000,
+		CPU:                4,
+		DiskPath:           "/var/lib/windows.qcow2",
+		Networks:           []string{"mk-minikube", "default"},
+		VirtualizationSpec: virtualization,
+	}
+}
+
+// buildDomain returns the generated XML and the domain parsed back from it.
+func buildDomain(t *testing.T, virtualization v1alpha1.VirtualizationSpec) (string, *libvirtxml.Domain) {
+	dom, err := NewDomain(windowsSpec(virtualization))
+	assert.Nil(t, err)
+	out, err := dom.Marshal()
+	assert.Nil(t, err)
+	parsed := &libvirtxml.Domain{}
+	assert.Nil(t, parsed.Unmarshal(out))
+	return out, parsed
+}
+
+func TestNewDomainDefaults(t *testing.T) {
+	out, dom := buildDomain(t, v1alpha1.VirtualizationSpec{})
+	expected, err := os.ReadFile("testdata/domain.xml")
+	assert.Nil(t, err)
+	assert.Equal(t, strings.TrimSpace(string(expected)), out)
+
+	// libvirt picks the emulator of the host and resolves the q35 alias
+	assert.Empty(t, dom.Devices.Emulator)
+	assert.Equal(t, "q35", dom.OS.Type.Machine)
+}
+
+func TestNewDomainSettings(t *testing.T) {
+	out, dom := buildDomain(t, v1alpha1.VirtualizationSpec{
+		Emulator: "/usr/libexec/qemu-kvm",
+		Machine:  "pc-q35-rhel9.2.0",
+		DiskBus:  v1alpha1.DiskBusVirtio,
+		ExtraDisks: []v1alpha1.DiskSpec{
+			{Path: "/var/lib/virtio-win.iso", Device: "cdrom"},
+			{Path: "/var/lib/data.img", Format: "raw"},
+			{Path: "/var/lib/legacy.qcow2", Bus: v1alpha1.DiskBusSATA},
+		},
+	})
+	assert.Contains(t, out, "<emulator>/usr/libexec/qemu-kvm</emulator>")
+	assert.Equal(t, "pc-q35-rhel9.2.0", dom.OS.Type.Machine)
+
+	disks := dom.Devices.Disks
+	assert.Len(t, disks, 4)
+	assert.Equal(t, libvirtxml.DomainDiskTarget{Dev: "vda", Bus: "virtio"}, *disks[0].Target)
+	assert.Equal(t, "/var/lib/windows.qcow2", disks[0].Source.File.File)
+
+	assert.Equal(t, "cdrom", disks[1].Device)
+	assert.Equal(t, "raw", disks[1].Driver.Type)
+	assert.NotNil(t, disks[1].ReadOnly)
+	assert.Equal(t, libvirtxml.DomainDiskTarget{Dev: "sda", Bus: "sata"}, *disks[1].Target)
+
+	assert.Equal(t, "raw", disks[2].Driver.Type)
+	assert.Equal(t, libvirtxml.DomainDiskTarget{Dev: "vdb", Bus: "virtio"}, *disks[2].Target)
+	assert.Equal(t, libvirtxml.DomainDiskTarget{Dev: "sdb", Bus: "sata"}, *disks[3].Target)
+}
+
+func TestNewDomainPatch(t *testing.T) {
+	_, dom := buildDomain(t, v1alpha1.VirtualizationSpec{
+		XMLPatch: `<domain>
+  <memory unit="GiB">8</memory>
+  <features><hyperv><vapic state="off"/></hyperv></features>
+  <devices>
+    <disk type="file" device="disk"><source file="/var/lib/scratch.qcow2"/><target dev="sdb" bus="sata"/></disk>
+    <hostdev mode="subsystem" type="pci"><source><address domain="0x0000" bus="0x01" slot="0x00" function="0x0"/></source></hostdev>
+  </devices>
+  <memoryBacking><hugepages/></memoryBacking>
+</domain>`,
+	})
+	assert.Equal(t, libvirtxml.DomainMemory{Value: 8, Unit: "GiB"}, *dom.Memory)
+	assert.Equal(t, "off", dom.Features.HyperV.VAPIC.State)
+	// the values missing from the patch are kept
+	assert.Equal(t, "on", dom.Features.HyperV.Relaxed.State)
+	assert.Equal(t, uint(4), dom.VCPU.Value)
+
+	assert.Len(t, dom.Devices.Disks, 2)
+	assert.Equal(t, "/var/lib/scratch.qcow2", dom.Devices.Disks[1].Source.File.File)
+	assert.Len(t, dom.Devices.Hostdevs, 1)
+	assert.Equal(t, uint(1), *dom.Devices.Hostdevs[0].SubsysPCI.Source.Address.Bus)
+	assert.NotNil(t, dom.MemoryBacking.MemoryHugePages)
+}
+
+func TestNewDomainPatchReplaces(t *testing.T) {
+	out, dom := buildDomain(t, v1alpha1.VirtualizationSpec{
+		XMLPatch: `<domain>
+  <clock offset="utc"><timer name="hpet" present="yes"/></clock>
+  <devices>
+    <interface type="network"><source network="default"/><model type="e1000e"/></interface>
+    <video><model type="virtio" heads="2" primary="yes"/></video>
+  </devices>
+</domain>`,
+	})
+	// the patched elements replace the generated ones instead of being appended
+	assert.Equal(t, 1, strings.Count(out, "<video>"))
+	assert.Equal(t, libvirtxml.DomainVideoModel{Type: "virtio", Heads: 2, Primary: "yes"}, dom.Devices.Videos[0].Model)
+	assert.Len(t, dom.Clock.Timer, 4)
+	assert.Equal(t, "utc", dom.Clock.Offset)
+	assert.Contains(t, dom.Clock.Timer, libvirtxml.DomainTimer{Name: "hpet", Present: "yes"})
+	assert.Len(t, dom.Devices.Interfaces, 2)
+	assert.Equal(t, "mk-minikube", dom.Devices.Interfaces[0].Source.Network.Network)
+	assert.Equal(t, "e1000e", dom.Devices.Interfaces[1].Model.Type)
+}
+
+func TestNewDomainVideoModel(t *testing.T) {
+	out, dom := buildDomain(t, v1alpha1.VirtualizationSpec{VideoModel: "virtio"})
+	assert.Equal(t, 1, strings.Count(out, "<video>"))
+	assert.Equal(t, libvirtxml.DomainVideoModel{Type: "virtio", Heads: 1, Primary: "yes"}, dom.Devices.Videos[0].Model)
+
+	_, dom = buildDomain(t, v1alpha1.VirtualizationSpec{VideoModel: "none"})
+	assert.Equal(t, libvirtxml.DomainVideoModel{Type: "none"}, dom.Devices.Videos[0].Model)
+}
+
+func TestNewDomainErrors(t *testing.T) {
+	_, err := NewDomain(windowsSpec(v1alpha1.VirtualizationSpec{DiskBus: "ide"}))
+	assert.EqualError(t, err, `unsupported disk bus "ide" for /var/lib/windows.qcow2, use sata or virtio`)
+
+	_, err = NewDomain(windowsSpec(v1alpha1.VirtualizationSpec{XMLPatch: "<network/>"}))
+	assert.ErrorContains(t, err, "failed applying the domain XML patch")
+}
+
+func TestDomainClusterName(t *testing.T) {
+	// libvirt writes the metadata back with a namespace prefix
+	var dom libvirtxml.Domain
+	assert.Nil(t, dom.Unmarshal(`<domain><name>swdt-dev-windows</name><metadata>
+  <swdt:cluster xmlns:swdt="https://sigs.k8s.io/swdt" name="dev"/>
+  <other:tag xmlns:other="https://example.com/other" name="x"/>
+</metadata></domain>`))
+	cluster := domainCluster(&dom)
+	assert.Equal(t, "dev", cluster.Name)
+	assert.True(t, cluster.Owner().IsZero())
+	assert.True(t, cluster.CreatedAt().IsZero())
+
+	dom = libvirtxml.Domain{}
+	assert.Nil(t, dom.Unmarshal(`<domain><name>minikube</name></domain>`))
+	assert.Empty(t, domainCluster(&dom).Name)
+}
+
+func TestCheckOwner(t *testing.T) {
+	_, dom := buildDomain(t, v1alpha1.VirtualizationSpec{})
+	owner := config.Owner{User: "dev", UID: "1000", Home: "/home/dev/.swdt"}
+	assert.Equal(t, owner, domainCluster(dom).Owner())
+	assert.Nil(t, checkOwner(dom, owner))
+
+	err := checkOwner(dom, config.Owner{User: "ops", UID: "1001", Home: "/home/ops/.swdt"})
+	assert.EqualError(t, err, "domain windows belongs to dev (uid 1000, /home/dev/.swdt), set another metadata.name")
+
+	spec := windowsSpec(v1alpha1.VirtualizationSpec{})
+	spec.Created = time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	created, err := NewDomain(spec)
+	assert.Nil(t, err)
+	assert.Equal(t, "2026-10-19T08:00:00Z", domainCluster(created).Created)
+	assert.True(t, spec.Created.Equal(domainCluster(created).CreatedAt()))
+
+	// the domains tagged before the owner was recorded are reused
+	assert.Nil(t, setDomainCluster(dom, DomainMetadataCluster{Name: "dev"}))
+	assert.Nil(t, checkOwner(dom, owner))
+}
+
+func TestMissingShares(t *testing.T) {
+	shares := []v1alpha1.ShareSpec{
+		{Name: "k8s", HostPath: "/home/user/kubernetes/_output", DriveLetter: "K", Protocol: v1alpha1.ShareVirtioFS},
+		{Name: "src", HostPath: "/home/user/src", DriveLetter: "S", Protocol: v1alpha1.ShareSMB},
+	}
+	_, dom := buildDomain(t, v1alpha1.VirtualizationSpec{Shares: shares})
+	assert.Empty(t, missingShares(dom, shares))
+
+	// the shares added or moved after the domain was defined are missing, smb is not a device
+	shares = append(shares,
+		v1alpha1.ShareSpec{Name: "images", HostPath: "/srv/images", DriveLetter: "I"},
+		v1alpha1.ShareSpec{Name: "smb", HostPath: "/srv/smb", DriveLetter: "T", Protocol: v1alpha1.ShareSMB})
+	shares[0].HostPath = "/home/user/go/src/k8s.io/kubernetes/_output"
+	assert.Equal(t, []string{"k8s", "images"}, missingShares(dom, shares))
+	assert.Equal(t, []string{"images"}, missingShares(&libvirtxml.Domain{}, shares[2:]))
+}
+
+func TestNewDomainShares(t *testing.T) {
+	out, dom := buildDomain(t, v1alpha1.VirtualizationSpec{Shares: []v1alpha1.ShareSpec{
+		{Name: "k8s", HostPath: "/home/user/kubernetes/_output", DriveLetter: "K", Protocol: v1alpha1.ShareVirtioFS},
+		{Name: "src", HostPath: "/home/user/src", DriveLetter: "S", Protocol: v1alpha1.ShareSMB},
+	}})
+	// the Samba shares are served by the host, outside the domain
+	assert.Equal(t, []libvirtxml.DomainFilesystem{{
+		XMLName:    xml.Name{Local: "filesystem"},
+		AccessMode: "passthrough",
+		Driver:     &libvirtxml.DomainFilesystemDriver{Type: "virtiofs"},
+		Source:     &libvirtxml.DomainFilesystemSource{Mount: &libvirtxml.DomainFilesystemSourceMount{Dir: "/home/user/kubernetes/_output"}},
+		Target:     &libvirtxml.DomainFilesystemTarget{Dir: "k8s"},
+	}}, dom.Devices.Filesystems)
+	assert.Equal(t, &libvirtxml.DomainMemoryBacking{
+		MemorySource: &libvirtxml.DomainMemorySource{Type: "memfd"},
+		MemoryAccess: &libvirtxml.DomainMemoryAccess{Mode: "shared"},
+	}, dom.MemoryBacking)
+	assert.Contains(t, out, `<filesystem type="mount" accessmode="passthrough">`)
+
+	// the memory backing of the patch is kept
+	out, dom = buildDomain(t, v1alpha1.VirtualizationSpec{
+		Shares:   []v1alpha1.ShareSpec{{Name: "k8s", HostPath: "/k8s", DriveLetter: "K"}},
+		XMLPatch: `<domain><memoryBacking><hugepages/><access mode="shared"/></memoryBacking></domain>`,
+	})
+	assert.Equal(t, 1, strings.Count(out, "<memoryBacking>"))
+	assert.NotNil(t, dom.MemoryBacking.MemoryHugePages)
+	assert.Nil(t, dom.MemoryBacking.MemorySource)
+
+	out, _ = buildDomain(t, v1alpha1.VirtualizationSpec{})
+	assert.NotContains(t, out, "memoryBacking")
+}
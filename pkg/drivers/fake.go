@@ -0,0 +1,346 @@
+package drivers
+
+import (
+	"fmt"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"sync"
+	"time"
+)
+
+// Fake is an in-memory provider for tests, it records the calls and follows the
+// libvirt lifecycle: Start requires a defined machine and Create fails when it exists.
+type Fake struct {
+	mu     sync.Mutex
+	state  State
+	leases map[string]string
+	errs   map[string]error
+	calls  []string
+	closed bool
+
+	snapshots []Snapshot
+	orphans   []Orphan
+	machines  []Machine
+}
+
+// NewFake returns a provider without machine, answering the leases once it runs.
+func NewFake(leases map[string]string) *Fake {
+	return &Fake{state: StateNotFound, leases: leases, errs: map[string]error{}}
+}
+
+// SetState sets the machine state, StateNotFound removes it.
+func (f *Fake) SetState(state State) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state = state
+	return f
+}
+
+// SetOrphans sets the resources left on the host, the ones of a known cluster are
+// not returned by Orphans.
+func (f *Fake) SetOrphans(orphans ...Orphan) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.orphans = orphans
+	return f
+}
+
+// SetMachines sets the machines swdt created on the host, of every user.
+func (f *Fake) SetMachines(machines ...Machine) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.machines = machines
+	return f
+}
+
+// Fail makes the operation, like Start, return the error.
+func (f *Fake) Fail(op string, err error) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs[op] = err
+	return f
+}
+
+// Calls returns the operations called in order.
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// Closed reports whether the provider was closed.
+func (f *Fake) Closed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+// call records the operation and returns its injected error, the lock must be held.
+func (f *Fake) call(op string) error {
+	f.calls = append(f.calls, op)
+	return f.errs[op]
+}
+
+func (f *Fake) Create() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Create"); err != nil {
+		return err
+	}
+	if f.state != StateNotFound {
+		return ErrAlreadyExists
+	}
+	f.state = StateStopped
+	return nil
+}
+
+func (f *Fake) Start() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Start"); err != nil {
+		return err
+	}
+	if f.state == StateNotFound {
+		return ErrNotFound
+	}
+	f.state = StateRunning
+	return nil
+}
+
+func (f *Fake) Stop() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Stop"); err != nil {
+		return err
+	}
+	if f.state == StateNotFound {
+		return ErrNotFound
+	}
+	f.state = StateStopped
+	return nil
+}
+
+func (f *Fake) Remove() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Remove"); err != nil {
+		return err
+	}
+	if f.state == StateNotFound {
+		return ErrNotFound
+	}
+	f.state = StateNotFound
+	return nil
+}
+
+// Shutdown stops the machine like an ACPI shutdown answered within the timeout.
+func (f *Fake) Shutdown(timeout time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Shutdown"); err != nil {
+		return err
+	}
+	if f.state == StateNotFound {
+		return ErrNotFound
+	}
+	f.state = StateStopped
+	return nil
+}
+
+func (f *Fake) Suspend() error {
+	return f.transition("Suspend", StateRunning, StatePaused)
+}
+
+func (f *Fake) Resume() error {
+	return f.transition("Resume", StatePaused, StateRunning)
+}
+
+// transition moves the machine to the state, failing like libvirt when it is not in the expected one.
+func (f *Fake) transition(op string, from, to State) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(op); err != nil {
+		return err
+	}
+	if f.state == StateNotFound {
+		return ErrNotFound
+	} else if f.state != from {
+		return fmt.Errorf("%s: machine is %s, not %s", op, f.state, from)
+	}
+	f.state = to
+	return nil
+}
+
+// Leases returns the leases while the machine runs, like a DHCP server would.
+func (f *Fake) Leases() (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.call("Leases")
+	if err != nil || f.state != StateRunning {
+		return map[string]string{}, err
+	}
+	leases := make(map[string]string, len(f.leases))
+	for host, ip := range f.leases {
+		leases[host] = ip
+	}
+	return leases, nil
+}
+
+// NetworkLeases returns the leases on the private network of the default cluster,
+// the only one of the fake.
+func (f *Fake) NetworkLeases() (map[string]map[string]string, error) {
+	leases, err := f.Leases()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]map[string]string{Networks(&v1alpha1.Cluster{}).Private.Name: leases}, nil
+}
+
+func (f *Fake) EnsureNetworks() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.call("EnsureNetworks")
+}
+
+func (f *Fake) EjectMedium() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.call("EjectMedium")
+}
+
+func (f *Fake) RemoveNetworks() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.call("RemoveNetworks")
+}
+
+func (f *Fake) State() (State, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.call("State")
+	return f.state, err
+}
+
+func (f *Fake) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.call("Close")
+	f.closed = true
+	return err
+}
+
+func (f *Fake) CreateSnapshot(name, description string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CreateSnapshot"); err != nil {
+		return err
+	}
+	if err := ValidateSnapshotName(name); err != nil {
+		return err
+	}
+	if f.state == StateNotFound {
+		return ErrNotFound
+	}
+	for i := range f.snapshots {
+		if f.snapshots[i].Name == name {
+			return fmt.Errorf("snapshot %s: %w", name, ErrAlreadyExists)
+		}
+		f.snapshots[i].Current = false
+	}
+	f.snapshots = append(f.snapshots, Snapshot{Name: name, Description: description, CreatedAt: time.Now(), State: f.state, Current: true})
+	return nil
+}
+
+func (f *Fake) ListSnapshots() ([]Snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("ListSnapshots"); err != nil {
+		return nil, err
+	}
+	return append([]Snapshot{}, f.snapshots...), nil
+}
+
+// RestoreSnapshot sets the machine state saved in the snapshot.
+func (f *Fake) RestoreSnapshot(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("RestoreSnapshot"); err != nil {
+		return err
+	}
+	index := f.snapshot(name)
+	if index < 0 {
+		return fmt.Errorf("snapshot %s: %w", name, ErrNotFound)
+	}
+	for i := range f.snapshots {
+		f.snapshots[i].Current = i == index
+	}
+	f.state = f.snapshots[index].State
+	return nil
+}
+
+func (f *Fake) DeleteSnapshot(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DeleteSnapshot"); err != nil {
+		return err
+	}
+	index := f.snapshot(name)
+	if index < 0 {
+		return fmt.Errorf("snapshot %s: %w", name, ErrNotFound)
+	}
+	f.snapshots = append(f.snapshots[:index], f.snapshots[index+1:]...)
+	return nil
+}
+
+// snapshot returns the index of the named snapshot, -1 when missing.
+func (f *Fake) snapshot(name string) int {
+	for i := range f.snapshots {
+		if f.snapshots[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *Fake) Machines() ([]Machine, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Machines"); err != nil {
+		return nil, err
+	}
+	return append([]Machine(nil), f.machines...), nil
+}
+
+func (f *Fake) Orphans(known []*v1alpha1.Cluster) ([]Orphan, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Orphans"); err != nil {
+		return nil, err
+	}
+	clusters := map[string]bool{}
+	for _, cluster := range known {
+		clusters[config.ClusterName(cluster)] = true
+	}
+	var orphans []Orphan
+	for _, orphan := range f.orphans {
+		if orphan.Cluster == "" || !clusters[orphan.Cluster] {
+			orphans = append(orphans, orphan)
+		}
+	}
+	return orphans, nil
+}
+
+func (f *Fake) RemoveOrphan(orphan Orphan) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("RemoveOrphan"); err != nil {
+		return err
+	}
+	for i := range f.orphans {
+		if f.orphans[i] == orphan {
+			f.orphans = append(f.orphans[:i], f.orphans[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("orphan %s %s: %w", orphan.Kind, orphan.Name, ErrNotFound)
+}
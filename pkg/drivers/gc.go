@@ -0,0 +1,340 @@
+package drivers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"time"
+
+	"k8s.io/klog/v2"
+	"libvirt.org/go/libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+// Orphan kinds found by the providers.
+const (
+	OrphanDomain  = "domain"
+	OrphanVolume  = "volume"
+	OrphanNetwork = "network"
+)
+
+// Orphan is a host resource created by swdt that no known cluster owns.
+type Orphan struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Cluster is the owner recorded on the resource, empty when it is not recorded.
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// Collector is implemented by the providers finding the resources left by unknown clusters.
+type Collector interface {
+	// Orphans returns the swdt resources of the running user the known clusters do not
+	// own, the domains come before the volumes and the networks they use.
+	Orphans(known []*v1alpha1.Cluster) ([]Orphan, error)
+	// RemoveOrphan deletes the resource.
+	RemoveOrphan(orphan Orphan) error
+}
+
+// OrphanAge is the age of the resources considered left by a failed run, the younger
+// ones can belong to a running start not recorded yet.
+var OrphanAge = time.Hour
+
+// isSwdtNetwork reports whether the network name was derived by Networks.
+func isSwdtNetwork(name string) bool {
+	return networkCluster(name) != ""
+}
+
+// networkCluster returns the cluster of a network name derived by Networks, empty
+// for the other networks.
+func networkCluster(name string) string {
+	if !strings.HasPrefix(name, config.ResourcePrefix) {
+		return ""
+	}
+	for _, suffix := range []string{"-nat", "-private"} {
+		if cluster, ok := strings.CutSuffix(strings.TrimPrefix(name, config.ResourcePrefix), suffix); ok {
+			return cluster
+		}
+	}
+	return ""
+}
+
+// poolCluster returns the cluster of a storage pool name derived by StoragePool,
+// empty for the other pools.
+func poolCluster(name string) string {
+	cluster, ok := strings.CutSuffix(strings.TrimPrefix(name, config.ResourcePrefix), "-state")
+	if !ok || !strings.HasPrefix(name, config.ResourcePrefix) {
+		return ""
+	}
+	return cluster
+}
+
+// Orphans returns the domains of the running user tagged with an unknown cluster,
+// the overlay volumes in the state directories of the unknown clusters, then their
+// swdt networks not used by the kept domains. Several users can share the libvirt
+// daemon, so the resources of the others are never returned.
+func (d *Libvirt) Orphans(known []*v1alpha1.Cluster) ([]Orphan, error) {
+	domains, err := d.listDomains()
+	if err != nil {
+		return nil, err
+	}
+	pools, err := d.listPools()
+	if err != nil {
+		return nil, err
+	}
+	lvnets, err := d.Conn.ListAllNetworks(0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, lvnet := range lvnets {
+			_ = lvnet.Free()
+		}
+	}()
+	networks := make([]string, 0, len(lvnets))
+	for _, lvnet := range lvnets {
+		name, err := lvnet.GetName()
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, name)
+	}
+	states, err := config.ListClusters()
+	if err != nil {
+		return nil, err
+	}
+	owned := map[string]bool{}
+	for _, state := range states {
+		owned[config.ClusterName(state)] = true
+	}
+	return collectOrphans(domains, pools, networks, known, owned, config.CurrentOwner(), time.Now()), nil
+}
+
+// collectOrphans returns the domains of the owner tagged with an unknown cluster and
+// older than OrphanAge, the overlay volumes of the unknown clusters whose storage pool
+// is on a state directory of the owner, then the swdt networks of the unknown clusters
+// the owner has an orphan domain, volume or state directory for, when no kept domain
+// uses them.
+func collectOrphans(domains []*libvirtxml.Domain, pools []*libvirtxml.StoragePool, networks []string, known []*v1alpha1.Cluster, owned map[string]bool, owner config.Owner, now time.Time) []Orphan {
+	clusters, names := map[string]bool{}, map[string]bool{}
+	for _, cluster := range known {
+		clusters[config.ClusterName(cluster)] = true
+		spec := Networks(cluster)
+		names[spec.NAT.Name], names[spec.Private.Name] = true, true
+	}
+
+	var orphans []Orphan
+	used, mine := map[string]bool{}, map[string]bool{}
+	for cluster := range owned {
+		mine[cluster] = true
+	}
+	for _, domain := range domains {
+		tag := domainCluster(domain)
+		if tag.Name != "" && !clusters[tag.Name] && tag.Owner() == owner && now.Sub(tag.CreatedAt()) > OrphanAge {
+			orphans = append(orphans, Orphan{Kind: OrphanDomain, Name: domain.Name, Cluster: tag.Name})
+			mine[tag.Name] = true
+			continue
+		}
+		for _, network := range domainNetworks(domain) {
+			used[network] = true
+		}
+	}
+	for _, pool := range pools {
+		cluster := poolCluster(pool.Name)
+		if cluster == "" || clusters[cluster] || pool.Target == nil {
+			continue
+		}
+		if dir := filepath.Join(owner.Home, "clusters", cluster); pool.Target.Path == dir {
+			orphans = append(orphans, Orphan{Kind: OrphanVolume, Name: filepath.Join(dir, overlayFile), Cluster: cluster})
+			mine[cluster] = true
+		}
+	}
+	for _, name := range networks {
+		if cluster := networkCluster(name); cluster != "" && mine[cluster] && !names[name] && !used[name] {
+			orphans = append(orphans, Orphan{Kind: OrphanNetwork, Name: name, Cluster: cluster})
+		}
+	}
+	return orphans
+}
+
+// RemoveOrphan deletes the orphan domain, volume or network.
+func (d *Libvirt) RemoveOrphan(orphan Orphan) error {
+	switch orphan.Kind {
+	case OrphanDomain:
+		return d.removeDomain(orphan.Name)
+	case OrphanVolume:
+		cluster := &v1alpha1.Cluster{}
+		cluster.Name = orphan.Cluster
+		return d.removeStatePool(StoragePool(cluster))
+	case OrphanNetwork:
+		return d.removeNetwork(orphan.Name)
+	default:
+		return fmt.Errorf("unknown orphan kind %q", orphan.Kind)
+	}
+}
+
+// listDomains returns the definitions of the domains on the host.
+func (d *Libvirt) listDomains() ([]*libvirtxml.Domain, error) {
+	doms, err := d.Conn.ListAllDomains(0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, dom := range doms {
+			_ = dom.Free()
+		}
+	}()
+	domains := make([]*libvirtxml.Domain, 0, len(doms))
+	for i := range doms {
+		domain, err := parseDomain(&doms[i])
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+	return domains, nil
+}
+
+// listPools returns the definitions of the swdt storage pools on the host.
+func (d *Libvirt) listPools() ([]*libvirtxml.StoragePool, error) {
+	lvpools, err := d.Conn.ListAllStoragePools(0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, lvpool := range lvpools {
+			_ = lvpool.Free()
+		}
+	}()
+	var pools []*libvirtxml.StoragePool
+	for _, lvpool := range lvpools {
+		name, err := lvpool.GetName()
+		if err != nil {
+			return nil, err
+		} else if poolCluster(name) == "" {
+			continue
+		}
+		desc, err := lvpool.GetXMLDesc(0)
+		if err != nil {
+			return nil, err
+		}
+		pool := &libvirtxml.StoragePool{}
+		if err = pool.Unmarshal(desc); err != nil {
+			return nil, fmt.Errorf("failed parsing the storage pool XML: %w", err)
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// parseDomain returns the definition of the libvirt domain.
+func parseDomain(dom *libvirt.Domain) (*libvirtxml.Domain, error) {
+	desc, err := dom.GetXMLDesc(0)
+	if err != nil {
+		return nil, err
+	}
+	domain := &libvirtxml.Domain{}
+	if err = domain.Unmarshal(desc); err != nil {
+		return nil, fmt.Errorf("failed parsing the domain XML: %w", err)
+	}
+	return domain, nil
+}
+
+// domainNetworks returns the networks of the domain interfaces.
+func domainNetworks(domain *libvirtxml.Domain) []string {
+	var networks []string
+	if domain.Devices == nil {
+		return networks
+	}
+	for _, iface := range domain.Devices.Interfaces {
+		if iface.Source != nil && iface.Source.Network != nil {
+			networks = append(networks, iface.Source.Network.Network)
+		}
+	}
+	return networks
+}
+
+// removeDomain destroys and undefines the domain with its snapshots metadata, after
+// deleting the static DHCP host entries of its interfaces. Its overlay volume is an
+// orphan of its own.
+func (d *Libvirt) removeDomain(name string) error {
+	dom, err := d.Conn.LookupDomainByName(name)
+	if isLibvirtError(err, libvirt.ERR_NO_DOMAIN) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() { _ = dom.Free() }()
+
+	domain, err := parseDomain(dom)
+	if err != nil {
+		return err
+	}
+	if domain.Devices != nil {
+		for _, iface := range domain.Devices.Interfaces {
+			if iface.MAC == nil || iface.Source == nil || iface.Source.Network == nil {
+				continue
+			}
+			if err = d.releaseHosts(iface.Source.Network.Network, iface.MAC.Address); err != nil {
+				return err
+			}
+		}
+	}
+	if active, err := dom.IsActive(); err != nil {
+		return err
+	} else if active {
+		if err = dom.Destroy(); err != nil {
+			return err
+		}
+	}
+	klog.Infof("Removing domain %s", name)
+	return dom.UndefineFlags(libvirt.DOMAIN_UNDEFINE_SNAPSHOTS_METADATA | libvirt.DOMAIN_UNDEFINE_MANAGED_SAVE | libvirt.DOMAIN_UNDEFINE_NVRAM)
+}
+
+// releaseHosts deletes the static DHCP host entries of the MAC address on the network,
+// a missing network is ignored.
+func (d *Libvirt) releaseHosts(network, mac string) error {
+	lvnet, err := d.Conn.LookupNetworkByName(network)
+	if isLibvirtError(err, libvirt.ERR_NO_NETWORK) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() { _ = lvnet.Free() }()
+
+	desc, err := lvnet.GetXMLDesc(0)
+	if err != nil {
+		return err
+	}
+	var definition Network
+	if err = xml.Unmarshal([]byte(desc), &definition); err != nil {
+		return err
+	}
+	flags := libvirt.NETWORK_UPDATE_AFFECT_CONFIG
+	if active, err := lvnet.IsActive(); err != nil {
+		return err
+	} else if active {
+		flags |= libvirt.NETWORK_UPDATE_AFFECT_LIVE
+	}
+	for _, ip := range definition.IPs {
+		if ip.DHCP == nil {
+			continue
+		}
+		for _, host := range ip.DHCP.Hosts {
+			if !strings.EqualFold(host.MAC, mac) {
+				continue
+			}
+			entry, err := xml.Marshal(host)
+			if err != nil {
+				return err
+			}
+			klog.Infof("Releasing %s of %s on network %s", host.IP, mac, network)
+			if err = lvnet.Update(libvirt.NETWORK_UPDATE_COMMAND_DELETE, libvirt.NETWORK_SECTION_IP_DHCP_HOST, -1, string(entry), flags); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package drivers
+
+import (
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"libvirt.org/go/libvirtxml"
+)
+
+func TestIsSwdtNetwork(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"swdt-dev-nat":     true,
+		"swdt-dev-private": true,
+		"swdt-nat":         false,
+		"default":          false,
+		"mk-minikube":      false,
+		"swdt-dev-bridge":  false,
+	} {
+		assert.Equal(t, expected, isSwdtNetwork(name), name)
+	}
+}
+
+func TestDomainNetworks(t *testing.T) {
+	dom, err := NewDomain(windowsSpec(v1alpha1.VirtualizationSpec{}))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mk-minikube", "default"}, domainNetworks(dom))
+	assert.Empty(t, domainNetworks(&libvirtxml.Domain{}))
+}
+
+func TestCollectOrphans(t *testing.T) {
+	now := time.Now()
+	owner := config.Owner{User: "dev", UID: "1000", Home: "/home/dev/.swdt"}
+	other := config.Owner{User: "ops", UID: "1001", Home: "/home/ops/.swdt"}
+	domain := func(cluster string, owner config.Owner, age time.Duration) *libvirtxml.Domain {
+		c := &v1alpha1.Cluster{}
+		c.Name = cluster
+		networks := Networks(c)
+		dom, err := NewDomain(DomainSpec{Name: config.ResourceName(c, "windows"), Cluster: cluster, Owner: owner,
+			Created: now.Add(-age), DiskPath: "/var/lib/windows.qcow2", Networks: []string{networks.Private.Name, networks.NAT.Name}})
+		assert.Nil(t, err)
+		return dom
+	}
+	domains := []*libvirtxml.Domain{
+		domain("old", owner, 2*time.Hour),
+		domain("starting", owner, time.Minute),
+		domain("shared", other, 2*time.Hour),
+		domain("legacy", config.Owner{}, 2*time.Hour),
+		{Name: "swdt-broken"}, // a minikube machine
+	}
+	pool := func(cluster, home string) *libvirtxml.StoragePool {
+		return newStatePool(config.ResourcePrefix+cluster+"-state", home+"/clusters/"+cluster)
+	}
+	pools := []*libvirtxml.StoragePool{
+		pool("old", owner.Home),
+		pool("known", owner.Home),
+		pool("shared", other.Home),
+		pool("deleted", owner.Home), // left after its domain and state directory were removed
+	}
+	networks := []string{"default", "swdt-old-nat", "swdt-old-private", "swdt-starting-nat", "swdt-shared-nat",
+		"swdt-failed-private", "swdt-unknown-private", "swdt-known-nat", "swdt-deleted-nat"}
+	known := &v1alpha1.Cluster{}
+	known.Name = "known"
+
+	orphans := collectOrphans(domains, pools, networks, []*v1alpha1.Cluster{known}, map[string]bool{"failed": true, "known": true}, owner, now)
+	// the domains and volumes of other users, the recent ones and the networks they use are kept
+	assert.Equal(t, []Orphan{
+		{Kind: OrphanDomain, Name: "swdt-old-windows", Cluster: "old"},
+		{Kind: OrphanVolume, Name: "/home/dev/.swdt/clusters/old/windows.qcow2", Cluster: "old"},
+		{Kind: OrphanVolume, Name: "/home/dev/.swdt/clusters/deleted/windows.qcow2", Cluster: "deleted"},
+		{Kind: OrphanNetwork, Name: "swdt-old-nat", Cluster: "old"},
+		{Kind: OrphanNetwork, Name: "swdt-old-private", Cluster: "old"},
+		{Kind: OrphanNetwork, Name: "swdt-failed-private", Cluster: "failed"},
+		{Kind: OrphanNetwork, Name: "swdt-deleted-nat", Cluster: "deleted"},
+	}, orphans)
+}
+
+func TestPoolCluster(t *testing.T) {
+	cluster := &v1alpha1.Cluster{}
+	cluster.Name = "dev-state"
+	assert.Equal(t, "dev-state", poolCluster(StoragePool(cluster)))
+	assert.Empty(t, poolCluster("default"))
+	assert.Empty(t, poolCluster("swdt-dev"))
+}
+
+func TestFakeOrphans(t *testing.T) {
+	domain := Orphan{Kind: OrphanDomain, Name: "swdt-dev-windows", Cluster: "dev"}
+	network := Orphan{Kind: OrphanNetwork, Name: "swdt-old-nat"}
+	fake := NewFake(nil).SetOrphans(domain, network)
+
+	dev := &v1alpha1.Cluster{}
+	dev.Name = "dev"
+	orphans, err := fake.Orphans([]*v1alpha1.Cluster{dev})
+	assert.Nil(t, err)
+	assert.Equal(t, []Orphan{network}, orphans)
+
+	assert.Nil(t, fake.RemoveOrphan(network))
+	assert.ErrorIs(t, fake.RemoveOrphan(network), ErrNotFound)
+	orphans, err = fake.Orphans(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []Orphan{domain}, orphans)
+}
@@ -1,84 +1,348 @@
 package drivers
 
 import (
-	"bytes"
 	"fmt"
 	"log"
+	"strings"
 	"swdt/apis/config/v1alpha1"
-	"text/template"
+	"swdt/pkg/config"
+	"time"
 
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/pkg/errors"
+	klog "k8s.io/klog/v2"
 	pkgdrivers "k8s.io/minikube/pkg/drivers"
 	"k8s.io/minikube/pkg/drivers/kvm"
 	"k8s.io/minikube/pkg/minikube/localpath"
 	"libvirt.org/go/libvirt"
+	"libvirt.org/go/libvirtxml"
 )
 
-var (
-	DefaultNetwork = "default"
-	PrivateNetwork = "mk-minikube"
-
-	windowsDomain = "windows"
-	hostName      = "win2k22"
-)
-
-type Driver struct {
+// Libvirt is the provider running the Windows node as a libvirt domain, the
+// lifecycle is delegated to the minikube KVM driver.
+type Libvirt struct {
 	KvmDriver *kvm.Driver
 	Conn      *libvirt.Connect
+
+	cluster        *v1alpha1.Cluster
+	virtualization v1alpha1.VirtualizationSpec
+	medium         string // config medium path, empty without bootstrap
 }
 
-func NewDriver(config *v1alpha1.Cluster) (*Driver, error) {
+// DomainName returns the libvirt domain of the Windows node of the cluster.
+func DomainName(cluster *v1alpha1.Cluster) string {
+	return config.ResourceName(cluster, "windows")
+}
+
+// NewLibvirt connects to the libvirt daemon set in the configuration.
+func NewLibvirt(config *v1alpha1.Cluster) (*Libvirt, error) {
 	uri := config.Spec.Workload.Virtualization.KvmQemuURI
 	conn, err := libvirt.NewConnect(uri)
 	if err != nil {
 		return nil, err
 	}
-	return &Driver{
+	var medium string
+	if config.Spec.Workload.Virtualization.Bootstrap != nil {
+		medium = MediumPath(config)
+	}
+	virtualization := config.Spec.Workload.Virtualization
+	virtualization.Networks = Networks(config)
+	return &Libvirt{
 		KvmDriver: &kvm.Driver{
 			BaseDriver: &drivers.BaseDriver{
-				MachineName: windowsDomain,
+				MachineName: DomainName(config),
 				StorePath:   localpath.MiniPath(),
 				SSHUser:     "Administrator",
 				SSHKeyPath:  config.Spec.Workload.Virtualization.SSH.PrivateKey,
 			},
 			Memory:         6000,
 			CPU:            4,
-			Network:        DefaultNetwork,
-			PrivateNetwork: PrivateNetwork,
-			DiskPath:       config.Spec.Workload.Virtualization.DiskPath,
+			Network:        virtualization.Networks.NAT.Name,
+			PrivateNetwork: virtualization.Networks.Private.Name,
 			Hidden:         false,
 			NUMANodeCount:  0,
 			CommonDriver:   &pkgdrivers.CommonDriver{},
 			ConnectionURI:  uri,
 		},
-		Conn: conn,
+		Conn:           conn,
+		cluster:        config,
+		virtualization: virtualization,
+		medium:         medium,
 	}, nil
 }
 
-// CreateDomain starts a new libvirt domain from a predefined template.
-// copied from Minikube KVM drivers, since we need another template formatted.
-func (d *Driver) CreateDomain() (*libvirt.Domain, error) {
-	netd, err := d.Conn.LookupNetworkByName(DefaultNetwork)
+// Create defines the Windows domain booting from the cluster overlay volume, its networks
+// are ensured beforehand by EnsureNetworks. The static IP is reserved for its private
+// interface when set. The config medium is only written for a new domain, it may have
+// been ejected.
+func (d *Libvirt) Create() error {
+	if dom, err := d.domain(); err == nil {
+		defer func() { _ = dom.Free() }()
+		return d.existingDomain(dom)
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	disk, err := d.createOverlay()
+	if err != nil {
+		return err
+	}
+	d.KvmDriver.DiskPath = disk
+	if d.medium != "" {
+		if err := CreateMedium(d.cluster, d.medium); err != nil {
+			return err
+		}
+	}
+	dom, err := d.CreateDomain()
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists with") {
+			return fmt.Errorf("%w: %v", ErrAlreadyExists, err)
+		}
+		return err
+	}
+	defer func() { _ = dom.Free() }()
+	if d.virtualization.StaticIP != "" {
+		return d.reserveIP(d.virtualization.StaticIP)
+	}
+	return nil
+}
+
+// existingDomain returns ErrAlreadyExists for the domain of the running user, the
+// domain of another user on the same libvirt daemon is never reused.
+func (d *Libvirt) existingDomain(dom *libvirt.Domain) error {
+	domain, err := parseDomain(dom)
+	if err != nil {
+		return err
+	}
+	if err = checkOwner(domain, config.CurrentOwner()); err != nil {
+		return err
+	}
+	if err = d.checkShares(domain); err != nil {
+		return err
+	}
+	return fmt.Errorf("domain %s: %w", domain.Name, ErrAlreadyExists)
+}
+
+// CheckShares fails when a virtiofs share of the configuration is missing from the
+// defined domain, like a share added after the first start.
+func (d *Libvirt) CheckShares() error {
+	dom, err := d.domain()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dom.Free() }()
+	domain, err := parseDomain(dom)
+	if err != nil {
+		return err
+	}
+	return d.checkShares(domain)
+}
+
+// checkShares fails with the shares missing from the domain, it must be defined again.
+func (d *Libvirt) checkShares(domain *libvirtxml.Domain) error {
+	if missing := missingShares(domain, d.virtualization.Shares); len(missing) > 0 {
+		return fmt.Errorf("domain %s lacks the virtiofs shares %s added after it was defined, run swdt destroy and swdt start to define it again",
+			domain.Name, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkOwner fails when the domain was created by another owner, the domains tagged
+// without owner are kept usable.
+func checkOwner(domain *libvirtxml.Domain, owner config.Owner) error {
+	if other := domainCluster(domain).Owner(); !other.IsZero() && other != owner {
+		return fmt.Errorf("domain %s belongs to %s, set another metadata.name", domain.Name, other)
+	}
+	return nil
+}
+
+// Start boots the Windows domain.
+func (d *Libvirt) Start() error {
+	return d.KvmDriver.Start()
+}
+
+// Stop shuts the Windows domain down gracefully, forcing it after the ShutdownTimeout.
+func (d *Libvirt) Stop() error {
+	return d.Shutdown(ShutdownTimeout)
+}
+
+// Remove destroys and undefines the Windows domain, releasing its static IP, then
+// deletes the config medium and the overlay volume. The snapshots are stored in the overlay, only their
+// metadata is removed.
+func (d *Libvirt) Remove() error {
+	if err := d.removeSnapshotsMetadata(); err != nil {
+		return err
+	}
+	if d.virtualization.StaticIP != "" {
+		if err := d.releaseIP(d.virtualization.StaticIP); err != nil {
+			return err
+		}
+	}
+	if err := d.KvmDriver.Remove(); err != nil {
+		return err
+	}
+	if err := removeFile(MediumPath(d.cluster)); err != nil {
+		return err
+	}
+	return d.removeOverlay()
+}
+
+// EjectMedium ejects the config medium from the cdrom of the domain, live and in its
+// definition, then deletes it since it carries the Administrator password.
+func (d *Libvirt) EjectMedium() error {
+	if d.medium == "" {
+		return nil
+	}
+	dom, err := d.domain()
+	if errors.Is(err, ErrNotFound) {
+		return removeFile(d.medium)
+	} else if err != nil {
+		return err
+	}
+	defer func() { _ = dom.Free() }()
+
+	domain, err := parseDomain(dom)
+	if err != nil {
+		return err
+	}
+	disk, err := ejectedDisk(domain, d.medium)
 	if err != nil {
-		return nil, errors.Wrapf(err, "%s KVM network doesn't exist", DefaultNetwork)
+		return err
+	}
+	if disk != nil {
+		flags := libvirt.DOMAIN_DEVICE_MODIFY_CONFIG
+		if active, err := dom.IsActive(); err != nil {
+			return err
+		} else if active {
+			flags |= libvirt.DOMAIN_DEVICE_MODIFY_LIVE
+		}
+		klog.Infof("Ejecting the config medium %s", d.medium)
+		if err = dom.UpdateDeviceFlags(string(disk), flags); err != nil {
+			return fmt.Errorf("failed ejecting the config medium: %w", err)
+		}
+	}
+	return removeFile(d.medium)
+}
+
+// removeSnapshotsMetadata deletes the snapshots metadata preventing the domain undefine.
+func (d *Libvirt) removeSnapshotsMetadata() error {
+	dom, err := d.domain()
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() { _ = dom.Free() }()
+
+	snapshots, err := dom.ListAllSnapshots(0)
+	if err != nil {
+		return err
+	}
+	for i := range snapshots {
+		err = snapshots[i].Delete(libvirt.DOMAIN_SNAPSHOT_DELETE_METADATA_ONLY)
+		_ = snapshots[i].Free()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Leases returns the leased IP addresses on the private network, the Windows
+// domain lease is matched by MAC address.
+func (d *Libvirt) Leases() (map[string]string, error) {
+	return d.networkLeases(d.KvmDriver.PrivateNetwork)
+}
+
+// NetworkLeases returns the leased IP addresses on the private and the NAT networks.
+func (d *Libvirt) NetworkLeases() (map[string]map[string]string, error) {
+	leases := map[string]map[string]string{}
+	for _, network := range []string{d.KvmDriver.PrivateNetwork, d.KvmDriver.Network} {
+		leased, err := d.networkLeases(network)
+		if err != nil {
+			return nil, err
+		}
+		leases[network] = leased
+	}
+	return leases, nil
+}
+
+// domain returns the Windows domain, ErrNotFound when it is not defined.
+func (d *Libvirt) domain() (*libvirt.Domain, error) {
+	dom, err := d.Conn.LookupDomainByName(d.KvmDriver.MachineName)
+	if err != nil {
+		if isLibvirtError(err, libvirt.ERR_NO_DOMAIN) {
+			return nil, fmt.Errorf("domain %s: %w", d.KvmDriver.MachineName, ErrNotFound)
+		}
+		return nil, err
+	}
+	return dom, nil
+}
+
+// isLibvirtError reports whether the error is a libvirt error with the code.
+func isLibvirtError(err error, code libvirt.ErrorNumber) bool {
+	var lverr libvirt.Error
+	return errors.As(err, &lverr) && lverr.Code == code
+}
+
+// State returns the state of the Windows domain.
+func (d *Libvirt) State() (State, error) {
+	dom, err := d.domain()
+	if errors.Is(err, ErrNotFound) {
+		return StateNotFound, nil
+	} else if err != nil {
+		return StateUnknown, err
+	}
+	defer func() { _ = dom.Free() }()
+
+	state, _, err := dom.GetState()
+	if err != nil {
+		return StateUnknown, err
+	}
+	return domainState(state), nil
+}
+
+// domainState returns the machine state of the libvirt domain state.
+func domainState(state libvirt.DomainState) State {
+	switch state {
+	case libvirt.DOMAIN_RUNNING, libvirt.DOMAIN_BLOCKED:
+		return StateRunning
+	case libvirt.DOMAIN_PAUSED, libvirt.DOMAIN_PMSUSPENDED:
+		return StatePaused
+	case libvirt.DOMAIN_SHUTDOWN, libvirt.DOMAIN_SHUTOFF, libvirt.DOMAIN_CRASHED:
+		return StateStopped
+	default:
+		return StateUnknown
+	}
+}
+
+// Close closes the libvirt connection.
+func (d *Libvirt) Close() error {
+	_, err := d.Conn.Close()
+	return err
+}
+
+// CreateDomain defines a new libvirt domain built from the virtualization settings.
+// copied from Minikube KVM drivers, since we need another domain definition.
+func (d *Libvirt) CreateDomain() (*libvirt.Domain, error) {
+	netd, err := d.Conn.LookupNetworkByName(d.KvmDriver.Network)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s KVM network doesn't exist", d.KvmDriver.Network)
 	}
 	if netd != nil {
 		_ = netd.Free()
 	}
 
-	// create the XML for the domain using our domainTmpl template
-	var domainXML bytes.Buffer
-	tmpl := template.Must(template.New("domain").Parse(domainTmpl))
-	if err := tmpl.Execute(&domainXML, d.KvmDriver); err != nil {
-		return nil, errors.Wrap(err, "executing domain xml")
+	// create the XML for the domain from the typed definition
+	domainXML, err := d.DomainXML()
+	if err != nil {
+		return nil, errors.Wrap(err, "building domain xml")
 	}
 
-	log.Printf("define libvirt domain using xml: %v\n", domainXML.String())
+	log.Printf("define libvirt domain using xml: %v\n", domainXML)
 	// define the domain in libvirt using the generated XML
-	dom, err := d.Conn.DomainDefineXML(domainXML.String())
+	dom, err := d.Conn.DomainDefineXML(domainXML)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error defining domain xml: %s", domainXML.String())
+		return nil, errors.Wrapf(err, "error defining domain xml: %s", domainXML)
 	}
 
 	// save MAC address
@@ -96,28 +360,27 @@ func (d *Driver) CreateDomain() (*libvirt.Domain, error) {
 	return dom, nil
 }
 
-// GetLeasedIPs returns the network IP leases address for all domains
-func (d *Driver) GetLeasedIPs(filterNetwork string) (leases map[string]string, err error) {
-	var networks []libvirt.Network
-	networks, err = d.Conn.ListAllNetworks(libvirt.CONNECT_LIST_NETWORKS_ACTIVE)
-	if err != nil {
-		return leases, err
+// DomainXML returns the XML definition of the Windows domain, the config medium
+// is attached after the extra disks.
+func (d *Libvirt) DomainXML() (string, error) {
+	virtualization := d.virtualization
+	if d.medium != "" {
+		virtualization.ExtraDisks = append(append([]v1alpha1.DiskSpec{}, virtualization.ExtraDisks...),
+			v1alpha1.DiskSpec{Path: d.medium, Device: "cdrom"})
 	}
-	leases = make(map[string]string, len(networks))
-	for _, network := range networks {
-		name, err := network.GetName()
-		if err != nil {
-			return leases, err
-		}
-		if name == filterNetwork {
-			dhcpLeases, err := network.GetDHCPLeases()
-			if err != nil {
-				return leases, err
-			}
-			for _, lease := range dhcpLeases {
-				leases[lease.Hostname] = lease.IPaddr
-			}
-		}
+	dom, err := NewDomain(DomainSpec{
+		Name:               d.KvmDriver.MachineName,
+		Cluster:            config.ClusterName(d.cluster),
+		Owner:              config.CurrentOwner(),
+		Created:            time.Now(),
+		Memory:             uint(d.KvmDriver.Memory),
+		CPU:                uint(d.KvmDriver.CPU),
+		DiskPath:           d.KvmDriver.DiskPath,
+		Networks:           []string{d.KvmDriver.PrivateNetwork, d.KvmDriver.Network},
+		VirtualizationSpec: virtualization,
+	})
+	if err != nil {
+		return "", err
 	}
-	return leases, nil
+	return dom.Marshal()
 }
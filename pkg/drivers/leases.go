@@ -0,0 +1,154 @@
+package drivers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	"libvirt.org/go/libvirt"
+)
+
+// WindowsLease is the key of the Windows machine lease returned by Leases, whatever
+// DHCP hostname the guest reports.
+const WindowsLease = "windows"
+
+// lease is a DHCP lease of a network.
+type lease struct {
+	Hostname string
+	MAC      string
+	IP       string
+}
+
+// hostLeases returns the leased IPs by hostname, the lease of the MAC address is
+// keyed by WindowsLease. Without MAC address the windows hostname is trusted.
+// IPv4 leases are preferred over IPv6 ones.
+func hostLeases(leases []lease, mac string) map[string]string {
+	hosts := make(map[string]string, len(leases))
+	set := func(host, ip string) {
+		if current, ok := hosts[host]; !ok || strings.Contains(current, ":") {
+			hosts[host] = ip
+		}
+	}
+	for _, l := range leases {
+		matched := mac != "" && strings.EqualFold(l.MAC, mac)
+		if l.Hostname != "" && !matched && (mac == "" || l.Hostname != WindowsLease) {
+			set(l.Hostname, l.IP)
+		}
+		if matched {
+			set(WindowsLease, l.IP)
+		}
+	}
+	return hosts
+}
+
+// WaitForLease polls the leases of the provider until the Windows machine has one,
+// failing after the timeout.
+func WaitForLease(provider Provider, timeout time.Duration) (map[string]string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		leases, err := provider.Leases()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := leases[WindowsLease]; ok {
+			return leases, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no DHCP lease for the Windows machine after %s", timeout)
+		}
+		klog.V(2).Infof("Waiting for the DHCP lease of the Windows machine, found %v", leases)
+		time.Sleep(pollInterval)
+	}
+}
+
+// macAddress returns the MAC address of the Windows domain interface on the network,
+// the addresses saved by CreateDomain are read back from the domain otherwise.
+func (d *Libvirt) macAddress(network string) (string, error) {
+	switch {
+	case network == d.KvmDriver.PrivateNetwork && d.KvmDriver.PrivateMAC != "":
+		return d.KvmDriver.PrivateMAC, nil
+	case network == d.KvmDriver.Network && d.KvmDriver.MAC != "":
+		return d.KvmDriver.MAC, nil
+	}
+	return macFromXML(d.Conn, d.KvmDriver.MachineName, network)
+}
+
+// networkLeases returns the leased IPs on the network by hostname, the Windows
+// domain lease is matched by its MAC address.
+func (d *Libvirt) networkLeases(network string) (map[string]string, error) {
+	mac, err := d.macAddress(network)
+	if err != nil {
+		klog.Warningf("Unable to match the Windows lease by MAC address: %v", err)
+	}
+	net, err := d.Conn.LookupNetworkByName(network)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = net.Free() }()
+	dhcpLeases, err := net.GetDHCPLeases()
+	if err != nil {
+		return nil, err
+	}
+	leases := make([]lease, 0, len(dhcpLeases))
+	for _, l := range dhcpLeases {
+		leases = append(leases, lease{Hostname: l.Hostname, MAC: l.Mac, IP: l.IPaddr})
+	}
+	return hostLeases(leases, mac), nil
+}
+
+// reserveIP adds a static DHCP host entry for the Windows domain on the private network,
+// an existing entry of the MAC address is replaced.
+func (d *Libvirt) reserveIP(ip string) error {
+	mac, err := d.macAddress(d.KvmDriver.PrivateNetwork)
+	if err != nil {
+		return err
+	}
+	host, err := xml.Marshal(NetworkDHCPHost{MAC: mac, Name: WindowsLease, IP: ip})
+	if err != nil {
+		return err
+	}
+	net, err := d.Conn.LookupNetworkByName(d.KvmDriver.PrivateNetwork)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = net.Free() }()
+
+	flags := libvirt.NETWORK_UPDATE_AFFECT_LIVE | libvirt.NETWORK_UPDATE_AFFECT_CONFIG
+	err = net.Update(libvirt.NETWORK_UPDATE_COMMAND_ADD_LAST, libvirt.NETWORK_SECTION_IP_DHCP_HOST, -1, string(host), flags)
+	if isLibvirtError(err, libvirt.ERR_OPERATION_INVALID) {
+		err = net.Update(libvirt.NETWORK_UPDATE_COMMAND_MODIFY, libvirt.NETWORK_SECTION_IP_DHCP_HOST, -1, string(host), flags)
+	}
+	if err != nil {
+		return fmt.Errorf("failed reserving %s for %s on network %s: %w", ip, mac, d.KvmDriver.PrivateNetwork, err)
+	}
+	klog.Infof("Reserved %s for the Windows domain on network %s", ip, d.KvmDriver.PrivateNetwork)
+	return nil
+}
+
+// releaseIP deletes the static DHCP host entry of the Windows domain, a missing
+// entry or domain is ignored.
+func (d *Libvirt) releaseIP(ip string) error {
+	mac, err := d.macAddress(d.KvmDriver.PrivateNetwork)
+	if err != nil {
+		klog.Warningf("Unable to release the reserved %s: %v", ip, err)
+		return nil
+	}
+	host, err := xml.Marshal(NetworkDHCPHost{MAC: mac, Name: WindowsLease, IP: ip})
+	if err != nil {
+		return err
+	}
+	net, err := d.Conn.LookupNetworkByName(d.KvmDriver.PrivateNetwork)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = net.Free() }()
+
+	flags := libvirt.NETWORK_UPDATE_AFFECT_LIVE | libvirt.NETWORK_UPDATE_AFFECT_CONFIG
+	err = net.Update(libvirt.NETWORK_UPDATE_COMMAND_DELETE, libvirt.NETWORK_SECTION_IP_DHCP_HOST, -1, string(host), flags)
+	if err != nil && !isLibvirtError(err, libvirt.ERR_OPERATION_INVALID) {
+		return err
+	}
+	return nil
+}
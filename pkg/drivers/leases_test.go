@@ -0,0 +1,41 @@
+package drivers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostLeases(t *testing.T) {
+	leases := []lease{
+		{Hostname: "minikube", MAC: "52:54:00:aa:aa:aa", IP: "192.168.39.2"},
+		// the guest reports its computer name, not windows
+		{Hostname: "WIN-4M1T0K3N", MAC: "52:54:00:BB:BB:BB", IP: "fe80::1"},
+		{Hostname: "WIN-4M1T0K3N", MAC: "52:54:00:BB:BB:BB", IP: "192.168.39.10"},
+		{MAC: "52:54:00:cc:cc:cc", IP: "192.168.39.20"},
+	}
+	assert.Equal(t, map[string]string{"minikube": "192.168.39.2", WindowsLease: "192.168.39.10"}, hostLeases(leases, "52:54:00:bb:bb:bb"))
+
+	// a lease of another machine using the windows hostname is not the Windows domain
+	leases = []lease{{Hostname: "windows", MAC: "52:54:00:dd:dd:dd", IP: "192.168.39.30"}}
+	assert.Empty(t, hostLeases(leases, "52:54:00:bb:bb:bb"))
+	assert.Equal(t, map[string]string{WindowsLease: "192.168.39.30"}, hostLeases(leases, ""))
+}
+
+func TestWaitForLease(t *testing.T) {
+	pollInterval = time.Millisecond
+	t.Cleanup(func() { pollInterval = time.Second })
+
+	fake := NewFake(map[string]string{WindowsLease: "192.168.39.10"}).SetState(StateStopped)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		fake.SetState(StateRunning)
+	}()
+	leases, err := WaitForLease(fake, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.39.10", leases[WindowsLease])
+
+	_, err = WaitForLease(NewFake(nil).SetState(StateRunning), 5*time.Millisecond)
+	assert.EqualError(t, err, "no DHCP lease for the Windows machine after 5ms")
+}
@@ -0,0 +1,177 @@
+package drivers
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"k8s.io/klog/v2"
+	"libvirt.org/go/libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+// ShutdownTimeout is the time given to the guest to power off before the stop is forced.
+const ShutdownTimeout = 2 * time.Minute
+
+// pollInterval is the delay between the state checks while waiting for the machine.
+var pollInterval = time.Second
+
+// Lifecycle is implemented by the providers shutting down and pausing a running machine.
+type Lifecycle interface {
+	// Shutdown asks the guest to power off, the machine is stopped by force after the timeout.
+	Shutdown(timeout time.Duration) error
+	// Suspend pauses the machine keeping its memory.
+	Suspend() error
+	// Resume continues a suspended machine.
+	Resume() error
+}
+
+// Console is implemented by the providers exposing the serial console of the machine.
+type Console interface {
+	// OpenConsole connects to the serial console of the running machine.
+	OpenConsole() (io.ReadWriteCloser, error)
+}
+
+// waitState polls the state until it is the wanted one, reporting false after the timeout.
+func waitState(get func() (State, error), want State, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		state, err := get()
+		if err != nil {
+			return false, err
+		}
+		if state == want {
+			return true, nil
+		}
+		if time.Now().After(deadline) {
+			return false, nil
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Shutdown sends an ACPI power button event to the Windows domain and waits for it
+// to power off, the domain is destroyed when it is still running after the timeout.
+func (d *Libvirt) Shutdown(timeout time.Duration) error {
+	dom, err := d.domain()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dom.Free() }()
+
+	state, err := d.State()
+	if err != nil || state == StateStopped {
+		return err
+	}
+	if state == StateRunning {
+		if err = dom.ShutdownFlags(libvirt.DOMAIN_SHUTDOWN_ACPI_POWER_BTN); err != nil {
+			klog.Warningf("ACPI shutdown of the domain %s failed: %v", d.KvmDriver.MachineName, err)
+		} else if stopped, err := waitState(d.State, StateStopped, timeout); err != nil || stopped {
+			return err
+		}
+	}
+	klog.Warningf("Forcing the stop of the domain %s", d.KvmDriver.MachineName)
+	return dom.Destroy()
+}
+
+// Suspend pauses the vCPUs of the Windows domain.
+func (d *Libvirt) Suspend() error {
+	dom, err := d.domain()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dom.Free() }()
+	return dom.Suspend()
+}
+
+// Resume continues the vCPUs of the suspended Windows domain.
+func (d *Libvirt) Resume() error {
+	dom, err := d.domain()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dom.Free() }()
+	return dom.Resume()
+}
+
+// OpenConsole streams the serial console of the running domain through libvirt, so it
+// works on a remote URI without access to the pty. Another attached session is taken over.
+func (d *Libvirt) OpenConsole() (io.ReadWriteCloser, error) {
+	dom, err := d.domain()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = dom.Free() }()
+	desc, err := dom.GetXMLDesc(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = consolePath(desc); err != nil {
+		return nil, err
+	}
+	stream, err := d.Conn.NewStream(0)
+	if err != nil {
+		return nil, err
+	}
+	if err = dom.OpenConsole("", stream, libvirt.DOMAIN_CONSOLE_FORCE); err != nil {
+		_ = stream.Free()
+		return nil, fmt.Errorf("failed opening the serial console: %w", err)
+	}
+	return &consoleStream{stream: stream}, nil
+}
+
+// consoleStream is the libvirt stream of a serial console.
+type consoleStream struct {
+	stream *libvirt.Stream
+}
+
+func (c *consoleStream) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return c.stream.Recv(p)
+}
+
+// Write sends the whole buffer, the stream may accept part of it.
+func (c *consoleStream) Write(p []byte) (int, error) {
+	var written int
+	for written < len(p) {
+		n, err := c.stream.Send(p[written:])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Close aborts the stream, the console of the domain is left running.
+func (c *consoleStream) Close() error {
+	err := c.stream.Abort()
+	if ferr := c.stream.Free(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// consolePath returns the source path of the serial pty console in the live domain XML,
+// it is only allocated while the domain runs.
+func consolePath(desc string) (string, error) {
+	var domain libvirtxml.Domain
+	if err := domain.Unmarshal(desc); err != nil {
+		return "", err
+	}
+	if domain.Devices != nil {
+		for _, console := range domain.Devices.Consoles {
+			if console.Source == nil || console.Source.Pty == nil {
+				continue
+			}
+			if console.Source.Pty.Path != "" {
+				return console.Source.Pty.Path, nil
+			} else if console.TTY != "" {
+				return console.TTY, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("domain %s has no serial pty console, is it running?", domain.Name)
+}
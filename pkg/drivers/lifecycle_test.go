@@ -0,0 +1,63 @@
+package drivers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitState(t *testing.T) {
+	pollInterval = time.Millisecond
+	t.Cleanup(func() { pollInterval = time.Second })
+
+	states := []State{StateRunning, StateRunning, StateStopped}
+	get := func() (State, error) {
+		state := states[0]
+		if len(states) > 1 {
+			states = states[1:]
+		}
+		return state, nil
+	}
+	stopped, err := waitState(get, StateStopped, time.Second)
+	assert.Nil(t, err)
+	assert.True(t, stopped)
+
+	// a guest ignoring the ACPI event is reported after the timeout
+	running := func() (State, error) { return StateRunning, nil }
+	stopped, err = waitState(running, StateStopped, 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.False(t, stopped)
+
+	failing := func() (State, error) { return StateUnknown, errors.New("connection lost") }
+	_, err = waitState(failing, StateStopped, time.Second)
+	assert.EqualError(t, err, "connection lost")
+}
+
+func TestConsolePath(t *testing.T) {
+	live := `<domain type="kvm"><name>windows</name><devices>
+  <serial type="pty"><source path="/dev/pts/3"/><target type="isa-serial" port="0"/></serial>
+  <console type="pty" tty="/dev/pts/3"><source path="/dev/pts/3"/><target type="serial" port="0"/></console>
+</devices></domain>`
+	path, err := consolePath(live)
+	assert.Nil(t, err)
+	assert.Equal(t, "/dev/pts/3", path)
+
+	// the pty is allocated when the domain starts
+	_, err = consolePath(`<domain type="kvm"><name>windows</name><devices><console type="pty"><target type="serial" port="0"/></console></devices></domain>`)
+	assert.EqualError(t, err, "domain windows has no serial pty console, is it running?")
+}
+
+func TestFakeSuspendResume(t *testing.T) {
+	fake := NewFake(nil).SetState(StateRunning)
+	assert.EqualError(t, fake.Resume(), "Resume: machine is Running, not Paused")
+	assert.Nil(t, fake.Suspend())
+	state, _ := fake.State()
+	assert.Equal(t, StatePaused, state)
+	assert.Nil(t, fake.Resume())
+	assert.Nil(t, fake.Shutdown(time.Second))
+	state, _ = fake.State()
+	assert.Equal(t, StateStopped, state)
+	assert.ErrorIs(t, NewFake(nil).Suspend(), ErrNotFound)
+}
@@ -0,0 +1,51 @@
+package drivers
+
+import (
+	"swdt/pkg/config"
+)
+
+// Machine is a machine created by swdt on the host, whichever user created it.
+type Machine struct {
+	Name    string
+	Cluster string
+	// Owner is the user who created the machine, the zero value when it is not recorded.
+	Owner config.Owner
+	State State
+}
+
+// Lister is implemented by the providers listing the machines swdt created on the host.
+type Lister interface {
+	// Machines returns the machines tagged with a cluster, of every user.
+	Machines() ([]Machine, error)
+}
+
+// Machines returns the domains tagged with a cluster in their metadata, the domains
+// of the other users sharing the libvirt daemon included.
+func (d *Libvirt) Machines() ([]Machine, error) {
+	doms, err := d.Conn.ListAllDomains(0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, dom := range doms {
+			_ = dom.Free()
+		}
+	}()
+	var machines []Machine
+	for i := range doms {
+		domain, err := parseDomain(&doms[i])
+		if err != nil {
+			return nil, err
+		}
+		tag := domainCluster(domain)
+		if tag.Name == "" {
+			continue
+		}
+		state, _, err := doms[i].GetState()
+		if err != nil {
+			return nil, err
+		}
+		machines = append(machines, Machine{Name: domain.Name, Cluster: tag.Name, Owner: tag.Owner(), State: domainState(state)})
+	}
+	return machines, nil
+}
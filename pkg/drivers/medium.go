@@ -0,0 +1,170 @@
+package drivers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+
+	"github.com/kdomanski/iso9660"
+	"libvirt.org/go/libvirtxml"
+)
+
+const (
+	// MediumLabel is the volume label of the config medium, looked up by the image loader.
+	MediumLabel = "SWDTCONFIG"
+
+	mediumFile = "config.iso"
+)
+
+// agentScript applies the config medium, it is started at every boot by the loader
+// installed in the image and applies a configuration once.
+const agentScript = `# swdt first-boot agent, started by the image loader from the config medium.
+$ErrorActionPreference = 'Stop'
+$root = $PSScriptRoot
+$state = Join-Path $env:ProgramData 'swdt'
+New-Item -ItemType Directory -Force -Path $state | Out-Null
+Start-Transcript -Append -Path (Join-Path $state 'agent.log') | Out-Null
+
+$file = Join-Path $root 'swdt.json'
+$hash = (Get-FileHash -Algorithm SHA256 -LiteralPath $file).Hash
+$marker = Join-Path $state 'applied'
+if ((Test-Path $marker) -and ((Get-Content $marker) -eq $hash)) {
+    Write-Output 'Configuration already applied.'
+    exit 0
+}
+$config = Get-Content -Raw -LiteralPath $file | ConvertFrom-Json
+
+if ($config.authorizedKey) {
+    $keys = Join-Path $env:ProgramData 'ssh\administrators_authorized_keys'
+    Set-Content -Force -Path $keys -Value $config.authorizedKey
+    icacls.exe $keys /inheritance:r /grant 'Administrators:F' /grant 'SYSTEM:F' | Out-Null
+}
+if ($config.password) {
+    $password = ConvertTo-SecureString -String $config.password -AsPlainText -Force
+    Set-LocalUser -Name Administrator -Password $password
+}
+if ($config.firstBootScript) {
+    & (Join-Path $root 'firstboot.ps1')
+}
+Set-Content -Path $marker -Value $hash
+
+if ($config.hostname -and $config.hostname -ne $env:COMPUTERNAME) {
+    Rename-Computer -NewName $config.hostname -Force -Restart
+}
+`
+
+// MediumEjector is implemented by the providers attaching the config medium to the machine.
+type MediumEjector interface {
+	// EjectMedium detaches the config medium from the machine and deletes it.
+	EjectMedium() error
+}
+
+// mediumConfig is the configuration read by the agent from swdt.json.
+type mediumConfig struct {
+	Hostname      string `json:"hostname,omitempty"`
+	Password      string `json:"password,omitempty"`
+	AuthorizedKey string `json:"authorizedKey,omitempty"`
+	// FirstBootScript is the hash of the script, a new script is applied again.
+	FirstBootScript string `json:"firstBootScript,omitempty"`
+}
+
+// MediumPath returns the config medium of the cluster in its state directory.
+func MediumPath(cluster *v1alpha1.Cluster) string {
+	return filepath.Join(config.StateDir(cluster), mediumFile)
+}
+
+// mediumFiles returns the files of the config medium: the agent, its configuration
+// and the first-boot script. The Administrator password is the SSH one.
+func mediumFiles(cluster *v1alpha1.Cluster) (map[string][]byte, error) {
+	virtualization := cluster.Spec.Workload.Virtualization
+	bootstrap := virtualization.Bootstrap
+	cfg := mediumConfig{Hostname: bootstrap.Hostname}
+
+	key := bootstrap.AuthorizedKey
+	if ssh := virtualization.SSH; ssh != nil {
+		cfg.Password = ssh.Password
+		if key == "" && ssh.PrivateKey != "" {
+			key = ssh.PrivateKey + ".pub"
+		}
+	}
+	if key != "" {
+		content, err := os.ReadFile(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading the authorized key: %w", err)
+		}
+		cfg.AuthorizedKey = strings.TrimSpace(string(content))
+	}
+
+	files := map[string][]byte{"agent.ps1": []byte(agentScript)}
+	if bootstrap.FirstBootScript != "" {
+		script, err := os.ReadFile(bootstrap.FirstBootScript)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading the first-boot script: %w", err)
+		}
+		hash := sha256.Sum256(script)
+		cfg.FirstBootScript = hex.EncodeToString(hash[:])
+		files["firstboot.ps1"] = script
+	}
+	content, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files["swdt.json"] = content
+	return files, nil
+}
+
+// CreateMedium writes the ISO config medium of the cluster bootstrap, it is only
+// readable by the owner since it carries the Administrator password.
+func CreateMedium(cluster *v1alpha1.Cluster, path string) error {
+	files, err := mediumFiles(cluster)
+	if err != nil {
+		return err
+	}
+	writer, err := iso9660.NewWriter()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = writer.Cleanup() }()
+	for name, content := range files {
+		if err = writer.AddFile(bytes.NewReader(content), name); err != nil {
+			return err
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err = writer.WriteTo(out, MediumLabel); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("failed writing the config medium: %w", err)
+	}
+	return out.Close()
+}
+
+// ejectedDisk returns the cdrom of the domain holding the medium without its source,
+// the update ejecting it. It is nil when the medium is not inserted.
+func ejectedDisk(domain *libvirtxml.Domain, medium string) ([]byte, error) {
+	if domain.Devices == nil {
+		return nil, nil
+	}
+	for _, disk := range domain.Devices.Disks {
+		if disk.Device != "cdrom" || disk.Source == nil || disk.Source.File == nil || disk.Source.File.File != medium {
+			continue
+		}
+		disk.Source = nil
+		return xml.Marshal(&disk)
+	}
+	return nil, nil
+}
@@ -0,0 +1,92 @@
+package drivers
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"swdt/apis/config/v1alpha1"
+	"testing"
+
+	"github.com/kdomanski/iso9660"
+	"github.com/stretchr/testify/assert"
+	"libvirt.org/go/libvirtxml"
+)
+
+// readMedium returns the label and the files of the ISO medium.
+func readMedium(t *testing.T, path string) (string, map[string]string) {
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	image, err := iso9660.OpenImage(f)
+	assert.Nil(t, err)
+	label, err := image.Label()
+	assert.Nil(t, err)
+	root, err := image.RootDir()
+	assert.Nil(t, err)
+	children, err := root.GetChildren()
+	assert.Nil(t, err)
+
+	files := map[string]string{}
+	for _, child := range children {
+		content, err := io.ReadAll(child.Reader())
+		assert.Nil(t, err)
+		files[child.Name()] = string(content)
+	}
+	return label, files
+}
+
+func TestCreateMedium(t *testing.T) {
+	dir := t.TempDir()
+	key, script := filepath.Join(dir, "id_rsa"), filepath.Join(dir, "firstboot.ps1")
+	assert.Nil(t, os.WriteFile(key+".pub", []byte("ssh-rsa AAAA user@host\n"), 0o644))
+	assert.Nil(t, os.WriteFile(script, []byte("Install-WindowsFeature -Name Containers"), 0o644))
+
+	cluster := &v1alpha1.Cluster{}
+	cluster.Spec.Workload.Virtualization.SSH = &v1alpha1.SSHSpec{Username: "Administrator", Password: "secret", PrivateKey: key}
+	cluster.Spec.Workload.Virtualization.Bootstrap = &v1alpha1.BootstrapSpec{Hostname: "win-dev", FirstBootScript: script}
+
+	medium := filepath.Join(dir, "state", "config.iso")
+	assert.Nil(t, CreateMedium(cluster, medium))
+	info, err := os.Stat(medium)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	label, files := readMedium(t, medium)
+	assert.Equal(t, MediumLabel, label)
+	assert.Equal(t, agentScript, files["agent.ps1"])
+	assert.Equal(t, "Install-WindowsFeature -Name Containers", files["firstboot.ps1"])
+
+	var cfg mediumConfig
+	assert.Nil(t, json.Unmarshal([]byte(files["swdt.json"]), &cfg))
+	assert.Equal(t, "win-dev", cfg.Hostname)
+	assert.Equal(t, "secret", cfg.Password)
+	assert.Equal(t, "ssh-rsa AAAA user@host", cfg.AuthorizedKey)
+	assert.Len(t, cfg.FirstBootScript, 64)
+}
+
+func TestCreateMediumMissingKey(t *testing.T) {
+	cluster := &v1alpha1.Cluster{}
+	cluster.Spec.Workload.Virtualization.Bootstrap = &v1alpha1.BootstrapSpec{AuthorizedKey: "/missing/key.pub"}
+	err := CreateMedium(cluster, filepath.Join(t.TempDir(), "config.iso"))
+	assert.ErrorContains(t, err, "failed reading the authorized key")
+}
+
+func TestEjectedDisk(t *testing.T) {
+	file := func(path string) *libvirtxml.DomainDiskSource {
+		return &libvirtxml.DomainDiskSource{File: &libvirtxml.DomainDiskSourceFile{File: path}}
+	}
+	domain := &libvirtxml.Domain{Devices: &libvirtxml.DomainDeviceList{Disks: []libvirtxml.DomainDisk{
+		{Device: "disk", Source: file("/var/lib/libvirt/images/windows.qcow2"), Target: &libvirtxml.DomainDiskTarget{Dev: "sda", Bus: "sata"}},
+		{Device: "cdrom", Source: file("/home/user/.swdt/clusters/dev/config.iso"), Target: &libvirtxml.DomainDiskTarget{Dev: "sdb", Bus: "sata"}},
+	}}}
+	disk, err := ejectedDisk(domain, "/home/user/.swdt/clusters/dev/config.iso")
+	assert.Nil(t, err)
+	assert.Equal(t, `<disk device="cdrom"><target dev="sdb" bus="sata"></target></disk>`, string(disk))
+	// the source of the domain is kept
+	assert.Equal(t, "/home/user/.swdt/clusters/dev/config.iso", domain.Devices.Disks[1].Source.File.File)
+
+	disk, err = ejectedDisk(domain, "/other/config.iso")
+	assert.Nil(t, err)
+	assert.Nil(t, disk)
+}
@@ -0,0 +1,375 @@
+package drivers
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/netip"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+
+	"k8s.io/klog/v2"
+	"libvirt.org/go/libvirt"
+)
+
+// Networker is implemented by the providers managing the networks of the machine.
+type Networker interface {
+	// EnsureNetworks defines and starts the missing networks, the existing ones are started.
+	EnsureNetworks() error
+	// RemoveNetworks deletes the networks created by swdt.
+	RemoveNetworks() error
+}
+
+// Network is the libvirt definition of a network with a DHCP server.
+type Network struct {
+	XMLName xml.Name        `xml:"network"`
+	Name    string          `xml:"name"`
+	Forward *NetworkForward `xml:"forward"`
+	IPs     []NetworkIP     `xml:"ip"`
+}
+
+type NetworkForward struct {
+	Mode string `xml:"mode,attr,omitempty"`
+}
+
+type NetworkIP struct {
+	Address string       `xml:"address,attr,omitempty"`
+	Netmask string       `xml:"netmask,attr,omitempty"`
+	Prefix  int          `xml:"prefix,attr,omitempty"`
+	DHCP    *NetworkDHCP `xml:"dhcp"`
+}
+
+type NetworkDHCP struct {
+	Ranges []NetworkDHCPRange `xml:"range"`
+	Hosts  []NetworkDHCPHost  `xml:"host"`
+}
+
+type NetworkDHCPRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// NetworkDHCPHost is a static DHCP host entry.
+type NetworkDHCPHost struct {
+	XMLName xml.Name `xml:"host"`
+	MAC     string   `xml:"mac,attr"`
+	Name    string   `xml:"name,attr,omitempty"`
+	IP      string   `xml:"ip,attr"`
+}
+
+// Marshal returns the XML document of the network.
+func (n *Network) Marshal() (string, error) {
+	content, err := xml.MarshalIndent(n, "", "  ")
+	return string(content), err
+}
+
+// firstSubnet is the first subnet tried for the networks without subnet.
+var firstSubnet = netip.MustParsePrefix("192.168.124.0/24")
+
+// Networks returns the networks of the configuration, the unset names are
+// derived from the cluster name.
+func Networks(cluster *v1alpha1.Cluster) v1alpha1.NetworksSpec {
+	networks := cluster.Spec.Workload.Virtualization.Networks
+	networks.Defaults(config.ResourceName(cluster, "nat"), config.ResourceName(cluster, "private"))
+	return networks
+}
+
+// freeSubnet returns the first /24 subnet from firstSubnet not overlapping the used ones.
+func freeSubnet(used []netip.Prefix) (netip.Prefix, error) {
+	for candidate := firstSubnet; candidate.Addr().As4()[2] >= firstSubnet.Addr().As4()[2]; {
+		free := true
+		for _, subnet := range used {
+			if subnet.Overlaps(candidate) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return candidate, nil
+		}
+		addr := candidate.Addr().As4()
+		addr[2]++
+		candidate = netip.PrefixFrom(netip.AddrFrom4(addr), 24)
+	}
+	return netip.Prefix{}, fmt.Errorf("no free subnet after %s, set the network subnet", firstSubnet)
+}
+
+// NewNetwork returns the network of the spec, the host takes the first address of the
+// subnet and the DHCP range defaults to the following ones. The network is isolated
+// when forward is empty, or forwards the traffic with the mode, like nat.
+func NewNetwork(spec v1alpha1.NetworkSpec, forward string) (*Network, error) {
+	subnet, err := netip.ParsePrefix(spec.Subnet)
+	if err != nil || !subnet.Addr().Is4() {
+		return nil, fmt.Errorf("invalid subnet %q of network %s, use an IPv4 CIDR like 192.168.125.0/24", spec.Subnet, spec.Name)
+	}
+	if subnet.Bits() > 29 {
+		return nil, fmt.Errorf("subnet %s of network %s is too small, use a /29 or larger one", spec.Subnet, spec.Name)
+	}
+	subnet = subnet.Masked()
+	gateway := subnet.Addr().Next()
+	start, end := gateway.Next(), broadcast(subnet).Prev()
+	for _, bound := range []struct {
+		value string
+		addr  *netip.Addr
+	}{{spec.DHCPStart, &start}, {spec.DHCPEnd, &end}} {
+		if bound.value == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(bound.value)
+		if err != nil || !subnet.Contains(addr) || addr == gateway || addr == broadcast(subnet) {
+			return nil, fmt.Errorf("DHCP bound %q of network %s is not a host address of %s", bound.value, spec.Name, subnet)
+		}
+		*bound.addr = addr
+	}
+	if end.Less(start) {
+		return nil, fmt.Errorf("DHCP range of network %s starts at %s after its end %s", spec.Name, start, end)
+	}
+
+	network := &Network{
+		Name: spec.Name,
+		IPs: []NetworkIP{{
+			Address: gateway.String(),
+			Netmask: net.IP(net.CIDRMask(subnet.Bits(), 32)).String(),
+			DHCP:    &NetworkDHCP{Ranges: []NetworkDHCPRange{{Start: start.String(), End: end.String()}}},
+		}},
+	}
+	if forward != "" {
+		network.Forward = &NetworkForward{Mode: forward}
+	}
+	return network, nil
+}
+
+// broadcast returns the last address of the IPv4 subnet.
+func broadcast(subnet netip.Prefix) netip.Addr {
+	addr := subnet.Addr().As4()
+	last := binary.BigEndian.Uint32(addr[:]) | (1<<(32-subnet.Bits()) - 1)
+	binary.BigEndian.PutUint32(addr[:], last)
+	return netip.AddrFrom4(addr)
+}
+
+// Subnet returns the IPv4 subnet served by the network.
+func (n *Network) Subnet() (netip.Prefix, error) {
+	for _, ip := range n.IPs {
+		addr, err := netip.ParseAddr(ip.Address)
+		if err != nil || !addr.Is4() {
+			continue
+		}
+		bits := ip.Prefix
+		if ip.Netmask != "" {
+			mask := net.ParseIP(ip.Netmask).To4()
+			if mask == nil {
+				return netip.Prefix{}, fmt.Errorf("invalid netmask %q of network %s", ip.Netmask, n.Name)
+			}
+			bits, _ = net.IPMask(mask).Size()
+		}
+		return netip.PrefixFrom(addr, bits).Masked(), nil
+	}
+	return netip.Prefix{}, fmt.Errorf("network %s has no IPv4 address", n.Name)
+}
+
+// networkSpec is a network of the Windows domain with its forward mode.
+type networkSpec struct {
+	v1alpha1.NetworkSpec
+	forward string
+}
+
+// networks returns the NAT and the isolated private networks of the domain.
+func (d *Libvirt) networks() []networkSpec {
+	return []networkSpec{
+		{NetworkSpec: d.virtualization.Networks.NAT, forward: "nat"},
+		{NetworkSpec: d.virtualization.Networks.Private},
+	}
+}
+
+// EnsureNetworks defines and starts the networks missing on the host. A network
+// defined by a previous run must have the configured subnet, the ones marked as
+// existing must be defined and are only started.
+func (d *Libvirt) EnsureNetworks() error {
+	for _, spec := range d.networks() {
+		if err := d.ensureNetwork(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Libvirt) ensureNetwork(spec networkSpec) error {
+	lvnet, err := d.Conn.LookupNetworkByName(spec.Name)
+	switch {
+	case isLibvirtError(err, libvirt.ERR_NO_NETWORK) && spec.Existing:
+		return fmt.Errorf("network %s does not exist, unset existing to let swdt create it", spec.Name)
+	case isLibvirtError(err, libvirt.ERR_NO_NETWORK):
+		if lvnet, err = d.defineNetwork(spec); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case !spec.Existing && spec.Subnet != "":
+		if err = d.checkSubnet(lvnet, spec); err != nil {
+			_ = lvnet.Free()
+			return err
+		}
+	}
+	defer func() { _ = lvnet.Free() }()
+
+	active, err := lvnet.IsActive()
+	if err != nil || active {
+		return err
+	}
+	klog.Infof("Starting network %s", spec.Name)
+	return lvnet.Create()
+}
+
+// defineNetwork defines the network from the spec, started with the host. A free
+// subnet is picked when the spec has none.
+func (d *Libvirt) defineNetwork(spec networkSpec) (*libvirt.Network, error) {
+	if spec.Subnet == "" {
+		used, err := d.usedSubnets()
+		if err != nil {
+			return nil, err
+		}
+		subnet, err := freeSubnet(used)
+		if err != nil {
+			return nil, err
+		}
+		spec.Subnet = subnet.String()
+	}
+	network, err := NewNetwork(spec.NetworkSpec, spec.forward)
+	if err != nil {
+		return nil, err
+	}
+	networkXML, err := network.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Defining network %s on %s", spec.Name, spec.Subnet)
+	lvnet, err := d.Conn.NetworkDefineXML(networkXML)
+	if err != nil {
+		return nil, fmt.Errorf("failed defining network %s: %w", spec.Name, err)
+	}
+	if err = lvnet.SetAutostart(true); err != nil {
+		klog.Warningf("Unable to autostart network %s: %v", spec.Name, err)
+	}
+	return lvnet, nil
+}
+
+// usedSubnets returns the IPv4 subnets of the networks defined on the host.
+func (d *Libvirt) usedSubnets() ([]netip.Prefix, error) {
+	networks, err := d.Conn.ListAllNetworks(0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, lvnet := range networks {
+			_ = lvnet.Free()
+		}
+	}()
+	var used []netip.Prefix
+	for _, lvnet := range networks {
+		desc, err := lvnet.GetXMLDesc(0)
+		if err != nil {
+			return nil, err
+		}
+		var network Network
+		if err = xml.Unmarshal([]byte(desc), &network); err != nil {
+			return nil, err
+		}
+		if subnet, err := network.Subnet(); err == nil {
+			used = append(used, subnet)
+		}
+	}
+	return used, nil
+}
+
+// checkSubnet verifies the defined network serves the configured subnet, so a
+// network of another tool is not taken over by mistake.
+func (d *Libvirt) checkSubnet(lvnet *libvirt.Network, spec networkSpec) error {
+	desc, err := lvnet.GetXMLDesc(0)
+	if err != nil {
+		return err
+	}
+	var network Network
+	if err = xml.Unmarshal([]byte(desc), &network); err != nil {
+		return err
+	}
+	subnet, err := network.Subnet()
+	if err != nil {
+		return err
+	}
+	if want, err := netip.ParsePrefix(spec.Subnet); err != nil || subnet != want.Masked() {
+		return fmt.Errorf("network %s already exists on %s instead of %s, set existing to reuse it", spec.Name, subnet, spec.Subnet)
+	}
+	return nil
+}
+
+// RemoveNetworks destroys and undefines the networks created by swdt, the ones
+// marked as existing and the networks still used by a domain are kept.
+func (d *Libvirt) RemoveNetworks() error {
+	for _, spec := range d.networks() {
+		if spec.Existing {
+			continue
+		}
+		if err := d.removeNetwork(spec.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Libvirt) removeNetwork(name string) error {
+	lvnet, err := d.Conn.LookupNetworkByName(name)
+	if isLibvirtError(err, libvirt.ERR_NO_NETWORK) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() { _ = lvnet.Free() }()
+
+	domain, err := d.networkUser(name)
+	if err != nil {
+		return err
+	}
+	if domain != "" {
+		klog.Infof("Keeping network %s used by the domain %s", name, domain)
+		return nil
+	}
+	if active, err := lvnet.IsActive(); err != nil {
+		return err
+	} else if active {
+		if err = lvnet.Destroy(); err != nil {
+			return err
+		}
+	}
+	klog.Infof("Removing network %s", name)
+	return lvnet.Undefine()
+}
+
+// networkUser returns a domain with an interface on the network, empty when none.
+func (d *Libvirt) networkUser(network string) (string, error) {
+	domains, err := d.Conn.ListAllDomains(0)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		for _, dom := range domains {
+			_ = dom.Free()
+		}
+	}()
+	for _, dom := range domains {
+		name, err := dom.GetName()
+		if err != nil {
+			return "", err
+		}
+		ifaces, err := ifListFromXML(d.Conn, name)
+		if err != nil {
+			return "", err
+		}
+		for _, iface := range ifaces {
+			if iface.Source.Network == network {
+				return name, nil
+			}
+		}
+	}
+	return "", nil
+}
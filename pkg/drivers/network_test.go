@@ -0,0 +1,89 @@
+package drivers
+
+import (
+	"encoding/xml"
+	"net/netip"
+	"swdt/apis/config/v1alpha1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewNetwork(t *testing.T) {
+	network, err := NewNetwork(v1alpha1.NetworkSpec{Name: "swdt-nat", Subnet: "192.168.124.7/24"}, "nat")
+	assert.Nil(t, err)
+	content, err := network.Marshal()
+	assert.Nil(t, err)
+	assert.Equal(t, `<network>
+  <name>swdt-nat</name>
+  <forward mode="nat"></forward>
+  <ip address="192.168.124.1" netmask="255.255.255.0">
+    <dhcp>
+      <range start="192.168.124.2" end="192.168.124.254"></range>
+    </dhcp>
+  </ip>
+</network>`, content)
+
+	// the private network is isolated, leasing the configured range
+	network, err = NewNetwork(v1alpha1.NetworkSpec{Name: "swdt-private", Subnet: "10.10.0.0/16", DHCPStart: "10.10.1.0", DHCPEnd: "10.10.1.255"}, "")
+	assert.Nil(t, err)
+	assert.Nil(t, network.Forward)
+	assert.Equal(t, NetworkIP{Address: "10.10.0.1", Netmask: "255.255.0.0",
+		DHCP: &NetworkDHCP{Ranges: []NetworkDHCPRange{{Start: "10.10.1.0", End: "10.10.1.255"}}}}, network.IPs[0])
+}
+
+func TestNewNetworkErrors(t *testing.T) {
+	for spec, expected := range map[v1alpha1.NetworkSpec]string{
+		{Name: "n", Subnet: "fd00::/64"}:                                                          `invalid subnet "fd00::/64" of network n, use an IPv4 CIDR like 192.168.125.0/24`,
+		{Name: "n", Subnet: "192.168.1.0/30"}:                                                     "subnet 192.168.1.0/30 of network n is too small, use a /29 or larger one",
+		{Name: "n", Subnet: "192.168.1.0/24", DHCPStart: "192.168.1.1"}:                           `DHCP bound "192.168.1.1" of network n is not a host address of 192.168.1.0/24`,
+		{Name: "n", Subnet: "192.168.1.0/24", DHCPEnd: "192.168.2.10"}:                            `DHCP bound "192.168.2.10" of network n is not a host address of 192.168.1.0/24`,
+		{Name: "n", Subnet: "192.168.1.0/24", DHCPStart: "192.168.1.50", DHCPEnd: "192.168.1.10"}: "DHCP range of network n starts at 192.168.1.50 after its end 192.168.1.10",
+	} {
+		_, err := NewNetwork(spec, "")
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func TestNetworkSubnet(t *testing.T) {
+	// libvirt networks are defined with a netmask or a prefix
+	for desc, expected := range map[string]string{
+		`<network><name>default</name><ip address="192.168.122.1" netmask="255.255.255.0"/></network>`:                                         "192.168.122.0/24",
+		`<network><name>mk-minikube</name><ip family="ipv6" address="fd00::1" prefix="64"/><ip address="192.168.39.1" prefix="24"/></network>`: "192.168.39.0/24",
+	} {
+		var network Network
+		assert.Nil(t, xml.Unmarshal([]byte(desc), &network))
+		subnet, err := network.Subnet()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, subnet.String())
+	}
+	_, err := (&Network{Name: "empty"}).Subnet()
+	assert.EqualError(t, err, "network empty has no IPv4 address")
+}
+
+func TestNetworksNames(t *testing.T) {
+	cluster := &v1alpha1.Cluster{}
+	cluster.Name = "dev"
+	networks := Networks(cluster)
+	assert.Equal(t, "swdt-dev-nat", networks.NAT.Name)
+	assert.Equal(t, "swdt-dev-private", networks.Private.Name)
+	assert.Empty(t, networks.Private.Subnet)
+
+	// the configured names are kept
+	cluster.Spec.Workload.Virtualization.Networks.NAT.Name = "default"
+	assert.Equal(t, "default", Networks(cluster).NAT.Name)
+}
+
+func TestFreeSubnet(t *testing.T) {
+	subnet, err := freeSubnet(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.124.0/24", subnet.String())
+
+	// overlapping subnets are skipped
+	subnet, err = freeSubnet([]netip.Prefix{netip.MustParsePrefix("192.168.122.0/23"), netip.MustParsePrefix("192.168.124.0/22")})
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.128.0/24", subnet.String())
+
+	_, err = freeSubnet([]netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")})
+	assert.EqualError(t, err, "no free subnet after 192.168.124.0/24, set the network subnet")
+}
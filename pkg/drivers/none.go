@@ -0,0 +1,80 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"swdt/apis/config/v1alpha1"
+	"time"
+
+	klog "k8s.io/klog/v2"
+)
+
+// dialTimeout bounds the reachability check of an existing host.
+var dialTimeout = 5 * time.Second
+
+// None is the provider of an existing Windows host reachable only over SSH, the
+// machine is not owned by swdt so its lifecycle is left untouched.
+type None struct {
+	address string
+}
+
+// NewNone returns the provider of the host set in the SSH hostname.
+func NewNone(config *v1alpha1.Cluster) *None {
+	var address string
+	if ssh := config.Spec.Workload.Virtualization.SSH; ssh != nil {
+		address = ssh.Hostname
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil && address != "" {
+		address = net.JoinHostPort(address, "22")
+	}
+	return &None{address: address}
+}
+
+// Create checks the host is set, there is nothing to define.
+func (n *None) Create() error {
+	if n.address == "" {
+		return errors.New("the none provider requires the ssh hostname of the existing host")
+	}
+	return ErrAlreadyExists
+}
+
+// Start is a no-op, the host is expected to be running.
+func (n *None) Start() error {
+	return nil
+}
+
+// Stop is not supported on hosts not owned by swdt.
+func (n *None) Stop() error {
+	return fmt.Errorf("stopping %s: %w by the none provider", n.address, errors.ErrUnsupported)
+}
+
+// Remove leaves the existing host untouched.
+func (n *None) Remove() error {
+	klog.Infof("Host %s is not managed by swdt, skipping removal.", n.address)
+	return nil
+}
+
+// Leases returns the host address as the Windows machine lease.
+func (n *None) Leases() (map[string]string, error) {
+	host, _, err := net.SplitHostPort(n.address)
+	if err != nil {
+		return nil, fmt.Errorf("the none provider requires the ssh hostname of the existing host: %w", err)
+	}
+	return map[string]string{WindowsLease: host}, nil
+}
+
+// State returns Running when the SSH port accepts connections, Unknown otherwise.
+func (n *None) State() (State, error) {
+	conn, err := net.DialTimeout("tcp", n.address, dialTimeout)
+	if err != nil {
+		klog.V(2).Infof("Host %s is unreachable: %v", n.address, err)
+		return StateUnknown, nil
+	}
+	return StateRunning, conn.Close()
+}
+
+// Close is a no-op, there is no hypervisor connection.
+func (n *None) Close() error {
+	return nil
+}
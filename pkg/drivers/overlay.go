@@ -0,0 +1,155 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/config"
+
+	klog "k8s.io/klog/v2"
+	"libvirt.org/go/libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+// overlayFile is the name of the overlay volume in the state directory.
+const overlayFile = "windows.qcow2"
+
+// OverlayPath returns the copy-on-write disk of the cluster in its state directory,
+// backed by the configured image.
+func OverlayPath(cluster *v1alpha1.Cluster) string {
+	return filepath.Join(config.StateDir(cluster), overlayFile)
+}
+
+// StoragePool returns the transient libvirt storage pool on the state directory of
+// the cluster, through which libvirt creates the overlay volume.
+func StoragePool(cluster *v1alpha1.Cluster) string {
+	return config.ResourceName(cluster, "state")
+}
+
+// newStatePool returns the directory pool on the state directory.
+func newStatePool(name, dir string) *libvirtxml.StoragePool {
+	return &libvirtxml.StoragePool{
+		Type:   "dir",
+		Name:   name,
+		Target: &libvirtxml.StoragePoolTarget{Path: dir},
+	}
+}
+
+// newOverlay returns the qcow2 volume with the image as its backing store, libvirt
+// takes its capacity from the image.
+func newOverlay(name, image string) *libvirtxml.StorageVolume {
+	return &libvirtxml.StorageVolume{
+		Name:         name,
+		Target:       &libvirtxml.StorageVolumeTarget{Format: &libvirtxml.StorageVolumeTargetFormat{Type: "qcow2"}},
+		BackingStore: &libvirtxml.StorageVolumeBackingStore{Path: image, Format: &libvirtxml.StorageVolumeTargetFormat{Type: "qcow2"}},
+	}
+}
+
+// statePool returns the storage pool of the state directory, started when it does
+// not exist. The pool is transient, libvirt forgets it when it is stopped or the
+// daemon restarts, while the volumes stay in the directory.
+func (d *Libvirt) statePool() (*libvirt.StoragePool, error) {
+	name := StoragePool(d.cluster)
+	pool, err := d.Conn.LookupStoragePoolByName(name)
+	if err == nil {
+		return pool, pool.Refresh(0)
+	} else if !isLibvirtError(err, libvirt.ERR_NO_STORAGE_POOL) {
+		return nil, err
+	}
+	// libvirt requires an absolute path, SWDT_HOME can be relative.
+	dir, err := filepath.Abs(config.StateDir(d.cluster))
+	if err != nil {
+		return nil, err
+	}
+	desc, err := newStatePool(name, dir).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Starting the storage pool %s on %s", name, dir)
+	pool, err = d.Conn.StoragePoolCreateXML(desc, libvirt.STORAGE_POOL_CREATE_WITH_BUILD)
+	if err != nil {
+		return nil, fmt.Errorf("failed starting the storage pool %s: %w", name, err)
+	}
+	return pool, nil
+}
+
+// createOverlay creates the overlay volume in the state directory and returns its
+// path, an existing volume is kept with its changes. The volume is created by libvirt,
+// so the image path is the one on the libvirt host.
+func (d *Libvirt) createOverlay() (string, error) {
+	pool, err := d.statePool()
+	if pool != nil {
+		defer func() { _ = pool.Free() }()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	vol, err := pool.LookupStorageVolByName(overlayFile)
+	if isLibvirtError(err, libvirt.ERR_NO_STORAGE_VOL) {
+		image, err := filepath.Abs(d.virtualization.DiskPath)
+		if err != nil {
+			return "", err
+		}
+		desc, err := newOverlay(overlayFile, image).Marshal()
+		if err != nil {
+			return "", err
+		}
+		klog.Infof("Creating the overlay volume %s backed by %s", OverlayPath(d.cluster), image)
+		if vol, err = pool.StorageVolCreateXML(desc, 0); err != nil {
+			return "", fmt.Errorf("failed creating the overlay volume: %w", err)
+		}
+	} else if err != nil {
+		return "", err
+	} else {
+		klog.Infof("Using the existing overlay volume %s", OverlayPath(d.cluster))
+	}
+	defer func() { _ = vol.Free() }()
+	return vol.GetPath()
+}
+
+// removeOverlay deletes the overlay volume of the cluster, the backing image is left
+// untouched.
+func (d *Libvirt) removeOverlay() error {
+	return d.removeStatePool(StoragePool(d.cluster))
+}
+
+// removeStatePool deletes the overlay volume of the storage pool and stops the pool.
+// The other files of the state directory are left to the state removal, and a pool
+// whose directory is already removed is only stopped.
+func (d *Libvirt) removeStatePool(name string) error {
+	pool, err := d.Conn.LookupStoragePoolByName(name)
+	if isLibvirtError(err, libvirt.ERR_NO_STORAGE_POOL) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() { _ = pool.Free() }()
+
+	if err = pool.Refresh(0); err != nil {
+		klog.Warningf("Unable to refresh the storage pool %s: %v", name, err)
+	} else if vol, err := pool.LookupStorageVolByName(overlayFile); err == nil {
+		path, _ := vol.GetPath()
+		klog.Infof("Removing the overlay volume %s", path)
+		err = vol.Delete(0)
+		_ = vol.Free()
+		if err != nil {
+			return err
+		}
+	} else if !isLibvirtError(err, libvirt.ERR_NO_STORAGE_VOL) {
+		return err
+	}
+	klog.Infof("Stopping the storage pool %s", name)
+	return pool.Destroy()
+}
+
+// removeFile deletes a file of the state directory, like the config medium.
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"swdt/apis/config/v1alpha1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverlayPath(t *testing.T) {
+	t.Setenv("SWDT_HOME", "/home/user/.swdt")
+	cluster := &v1alpha1.Cluster{}
+	cluster.Name = "sample"
+	assert.Equal(t, "/home/user/.swdt/clusters/sample/windows.qcow2", OverlayPath(cluster))
+	assert.Equal(t, "swdt-sample-state", StoragePool(cluster))
+}
+
+func TestNewStatePool(t *testing.T) {
+	desc, err := newStatePool("swdt-sample-state", "/home/user/.swdt/clusters/sample").Marshal()
+	assert.Nil(t, err)
+	assert.Equal(t, `<pool type="dir">
+  <name>swdt-sample-state</name>
+  <target>
+    <path>/home/user/.swdt/clusters/sample</path>
+  </target>
+</pool>`, desc)
+}
+
+func TestNewOverlay(t *testing.T) {
+	desc, err := newOverlay("windows.qcow2", "/var/lib/swdt/windows.qcow2").Marshal()
+	assert.Nil(t, err)
+	assert.Equal(t, `<volume>
+  <name>windows.qcow2</name>
+  <target>
+    <format type="qcow2"></format>
+  </target>
+  <backingStore>
+    <path>/var/lib/swdt/windows.qcow2</path>
+    <format type="qcow2"></format>
+  </backingStore>
+</volume>`, desc)
+}
+
+func TestRemoveFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.iso")
+	assert.Nil(t, os.WriteFile(file, []byte("medium"), 0o644))
+	assert.Nil(t, removeFile(file))
+	assert.NoFileExists(t, file)
+	assert.Nil(t, removeFile(file))
+}
@@ -0,0 +1,61 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+	"swdt/apis/config/v1alpha1"
+)
+
+// State is the power state of the Windows machine.
+type State string
+
+const (
+	StateRunning  State = "Running"
+	StateStopped  State = "Stopped"
+	StatePaused   State = "Paused"
+	StateNotFound State = "NotFound"
+	StateUnknown  State = "Unknown"
+)
+
+var (
+	// ErrAlreadyExists is returned by Create when the machine is already defined.
+	ErrAlreadyExists = errors.New("machine already exists")
+	// ErrNotFound is returned when the machine is not defined.
+	ErrNotFound = errors.New("machine not found")
+)
+
+// Provider manages the lifecycle of the Windows machine on a hypervisor.
+type Provider interface {
+	// Create defines the machine, returning ErrAlreadyExists when it is already defined.
+	Create() error
+	// Start boots the machine.
+	Start() error
+	// Stop shuts the machine down.
+	Stop() error
+	// Remove deletes the machine and its resources.
+	Remove() error
+	// Leases returns the leased IP addresses of the machines by hostname.
+	Leases() (map[string]string, error)
+	// State returns the power state of the machine.
+	State() (State, error)
+	// Close releases the connection to the hypervisor.
+	Close() error
+}
+
+// NewProvider returns the provider set in the virtualization configuration.
+func NewProvider(config *v1alpha1.Cluster) (Provider, error) {
+	switch provider := config.Spec.Workload.Virtualization.Provider; provider {
+	case v1alpha1.ProviderLibvirt, "":
+		return NewLibvirt(config)
+	case v1alpha1.ProviderNone:
+		return NewNone(config), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q, use %s or %s", provider, v1alpha1.ProviderLibvirt, v1alpha1.ProviderNone)
+	}
+}
+
+// NetworkLeaser is implemented by the providers attaching the machine to several networks.
+type NetworkLeaser interface {
+	// NetworkLeases returns the leased IP addresses of the machines by network and hostname.
+	NetworkLeases() (map[string]map[string]string, error)
+}
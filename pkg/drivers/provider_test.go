@@ -0,0 +1,81 @@
+package drivers
+
+import (
+	"errors"
+	"net"
+	"swdt/apis/config/v1alpha1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeLifecycle(t *testing.T) {
+	fake := NewFake(map[string]string{"windows": "192.168.122.10"})
+	state, _ := fake.State()
+	assert.Equal(t, StateNotFound, state)
+	assert.ErrorIs(t, fake.Start(), ErrNotFound)
+
+	assert.Nil(t, fake.Create())
+	assert.ErrorIs(t, fake.Create(), ErrAlreadyExists)
+	leases, _ := fake.Leases()
+	assert.Empty(t, leases)
+
+	assert.Nil(t, fake.Start())
+	leases, _ = fake.Leases()
+	assert.Equal(t, map[string]string{"windows": "192.168.122.10"}, leases)
+
+	assert.Nil(t, fake.Stop())
+	state, _ = fake.State()
+	assert.Equal(t, StateStopped, state)
+	assert.Nil(t, fake.Remove())
+	assert.ErrorIs(t, fake.Remove(), ErrNotFound)
+
+	failure := errors.New("boom")
+	fake.Fail("Create", failure)
+	assert.ErrorIs(t, fake.Create(), failure)
+	assert.Equal(t, []string{"State", "Start", "Create", "Create", "Leases", "Start", "Leases", "Stop", "State", "Remove", "Remove", "Create"}, fake.Calls())
+}
+
+func TestNewProvider(t *testing.T) {
+	config := &v1alpha1.Cluster{}
+	config.Spec.Workload.Virtualization.Provider = v1alpha1.ProviderNone
+	provider, err := NewProvider(config)
+	assert.Nil(t, err)
+	assert.IsType(t, &None{}, provider)
+
+	config.Spec.Workload.Virtualization.Provider = "hyperv"
+	_, err = NewProvider(config)
+	assert.EqualError(t, err, `unknown provider "hyperv", use libvirt or none`)
+}
+
+func TestNoneProvider(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	config := &v1alpha1.Cluster{}
+	config.Spec.Workload.Virtualization.SSH = &v1alpha1.SSHSpec{Hostname: listener.Addr().String()}
+	none := NewNone(config)
+
+	assert.ErrorIs(t, none.Create(), ErrAlreadyExists)
+	assert.Nil(t, none.Start())
+	assert.ErrorIs(t, none.Stop(), errors.ErrUnsupported)
+	leases, err := none.Leases()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"windows": "127.0.0.1"}, leases)
+
+	state, err := none.State()
+	assert.Nil(t, err)
+	assert.Equal(t, StateRunning, state)
+	assert.Nil(t, listener.Close())
+	state, err = none.State()
+	assert.Nil(t, err)
+	assert.Equal(t, StateUnknown, state)
+}
+
+func TestNoneProviderDefaultPort(t *testing.T) {
+	config := &v1alpha1.Cluster{}
+	config.Spec.Workload.Virtualization.SSH = &v1alpha1.SSHSpec{Hostname: "192.168.1.20"}
+	assert.Equal(t, "192.168.1.20:22", NewNone(config).address)
+
+	config.Spec.Workload.Virtualization.SSH.Hostname = ""
+	assert.Error(t, NewNone(config).Create())
+}
@@ -0,0 +1,200 @@
+package drivers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"libvirt.org/go/libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+// Snapshot is a saved state of the Windows machine.
+type Snapshot struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	State       State     `json:"state"`
+	Current     bool      `json:"current"`
+}
+
+// Snapshotter is implemented by the providers saving and restoring the machine state.
+type Snapshotter interface {
+	// CreateSnapshot saves the machine disks, and memory when it runs, under the name.
+	CreateSnapshot(name, description string) error
+	// ListSnapshots returns the snapshots ordered by creation time.
+	ListSnapshots() ([]Snapshot, error)
+	// RestoreSnapshot reverts the machine to the snapshot.
+	RestoreSnapshot(name string) error
+	// DeleteSnapshot removes the snapshot.
+	DeleteSnapshot(name string) error
+}
+
+var snapshotName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateSnapshotName checks the name is a tag like post-setup.
+func ValidateSnapshotName(name string) error {
+	if !snapshotName.MatchString(name) {
+		return fmt.Errorf("invalid snapshot name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// newDomainSnapshot returns an internal snapshot of the qcow2 disks, the read-only
+// media are skipped and the memory is saved when the domain runs.
+func newDomainSnapshot(name, description string, dom *libvirtxml.Domain, running bool) *libvirtxml.DomainSnapshot {
+	snapshot := &libvirtxml.DomainSnapshot{
+		Name:        name,
+		Description: description,
+		Memory:      &libvirtxml.DomainSnapshotMemory{Snapshot: "no"},
+		Disks:       &libvirtxml.DomainSnapshotDisks{},
+	}
+	if running {
+		snapshot.Memory.Snapshot = "internal"
+	}
+	if dom.Devices == nil {
+		return snapshot
+	}
+	for _, disk := range dom.Devices.Disks {
+		mode := "internal"
+		if disk.Device == "cdrom" || disk.ReadOnly != nil {
+			mode = "no"
+		}
+		snapshot.Disks.Disks = append(snapshot.Disks.Disks, libvirtxml.DomainSnapshotDisk{Name: disk.Target.Dev, Snapshot: mode})
+	}
+	return snapshot
+}
+
+// snapshotState returns the machine state saved in the snapshot.
+func snapshotState(state string) State {
+	switch state {
+	case "running", "blocked":
+		return StateRunning
+	case "paused", "pmsuspended":
+		return StatePaused
+	case "shutoff", "shutdown", "crashed":
+		return StateStopped
+	default:
+		return StateUnknown
+	}
+}
+
+// CreateSnapshot saves an internal qcow2 snapshot of the Windows domain.
+func (d *Libvirt) CreateSnapshot(name, description string) error {
+	if err := ValidateSnapshotName(name); err != nil {
+		return err
+	}
+	dom, err := d.domain()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dom.Free() }()
+
+	desc, err := dom.GetXMLDesc(0)
+	if err != nil {
+		return err
+	}
+	var definition libvirtxml.Domain
+	if err = definition.Unmarshal(desc); err != nil {
+		return fmt.Errorf("failed parsing XML of domain %s: %w", d.KvmDriver.MachineName, err)
+	}
+	running, err := dom.IsActive()
+	if err != nil {
+		return err
+	}
+
+	snapshotXML, err := newDomainSnapshot(name, description, &definition, running).Marshal()
+	if err != nil {
+		return err
+	}
+	snapshot, err := dom.CreateSnapshotXML(snapshotXML, libvirt.DOMAIN_SNAPSHOT_CREATE_ATOMIC)
+	if err != nil {
+		return fmt.Errorf("failed creating snapshot %s: %w", name, err)
+	}
+	return snapshot.Free()
+}
+
+// ListSnapshots returns the snapshots of the Windows domain.
+func (d *Libvirt) ListSnapshots() ([]Snapshot, error) {
+	dom, err := d.domain()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = dom.Free() }()
+
+	snapshots, err := dom.ListAllSnapshots(0)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Snapshot, 0, len(snapshots))
+	for i := range snapshots {
+		snapshot, err := readSnapshot(&snapshots[i])
+		_ = snapshots[i].Free()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, snapshot)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+// readSnapshot returns the snapshot from its libvirt definition.
+func readSnapshot(snapshot *libvirt.DomainSnapshot) (Snapshot, error) {
+	desc, err := snapshot.GetXMLDesc(0)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var definition libvirtxml.DomainSnapshot
+	if err = definition.Unmarshal(desc); err != nil {
+		return Snapshot{}, fmt.Errorf("failed parsing snapshot XML: %w", err)
+	}
+	current, err := snapshot.IsCurrent(0)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	created, _ := strconv.ParseInt(definition.CreationTime, 10, 64)
+	return Snapshot{
+		Name:        definition.Name,
+		Description: definition.Description,
+		CreatedAt:   time.Unix(created, 0),
+		State:       snapshotState(definition.State),
+		Current:     current,
+	}, nil
+}
+
+// lookupSnapshot calls the function with the named snapshot of the Windows domain.
+func (d *Libvirt) lookupSnapshot(name string, fn func(*libvirt.DomainSnapshot) error) error {
+	dom, err := d.domain()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dom.Free() }()
+
+	snapshot, err := dom.SnapshotLookupByName(name, 0)
+	if err != nil {
+		if isLibvirtError(err, libvirt.ERR_NO_DOMAIN_SNAPSHOT) {
+			return fmt.Errorf("snapshot %s: %w", name, ErrNotFound)
+		}
+		return err
+	}
+	defer func() { _ = snapshot.Free() }()
+	return fn(snapshot)
+}
+
+// RestoreSnapshot reverts the Windows domain to the snapshot, the domain is left
+// running or stopped like it was when the snapshot was taken.
+func (d *Libvirt) RestoreSnapshot(name string) error {
+	return d.lookupSnapshot(name, func(snapshot *libvirt.DomainSnapshot) error {
+		return snapshot.RevertToSnapshot(0)
+	})
+}
+
+// DeleteSnapshot removes the snapshot from the domain disks.
+func (d *Libvirt) DeleteSnapshot(name string) error {
+	return d.lookupSnapshot(name, func(snapshot *libvirt.DomainSnapshot) error {
+		return snapshot.Delete(0)
+	})
+}
@@ -0,0 +1,54 @@
+package drivers
+
+import (
+	"encoding/xml"
+	"swdt/apis/config/v1alpha1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDomainSnapshot(t *testing.T) {
+	dom, err := NewDomain(windowsSpec(v1alpha1.VirtualizationSpec{
+		ExtraDisks: []v1alpha1.DiskSpec{{Path: "/var/lib/virtio-win.iso", Device: "cdrom"}},
+	}))
+	assert.Nil(t, err)
+
+	out, err := xml.Marshal(newDomainSnapshot("post-setup", "after setup", dom, true))
+	assert.Nil(t, err)
+	assert.Equal(t, `<domainsnapshot><name>post-setup</name><description>after setup</description>`+
+		`<memory snapshot="internal"></memory><disks><disk name="sda" snapshot="internal"></disk>`+
+		`<disk name="sdb" snapshot="no"></disk></disks></domainsnapshot>`, string(out))
+
+	// the memory of a stopped domain is not saved
+	assert.Equal(t, "no", newDomainSnapshot("off", "", dom, false).Memory.Snapshot)
+}
+
+func TestSnapshotState(t *testing.T) {
+	assert.Equal(t, StateRunning, snapshotState("running"))
+	assert.Equal(t, StateStopped, snapshotState("shutoff"))
+	assert.Equal(t, StatePaused, snapshotState("paused"))
+	assert.Equal(t, StateUnknown, snapshotState("disk-snapshot"))
+}
+
+func TestFakeSnapshots(t *testing.T) {
+	fake := NewFake(nil)
+	assert.ErrorIs(t, fake.CreateSnapshot("post-setup", ""), ErrNotFound)
+
+	fake.SetState(StateRunning)
+	assert.Nil(t, fake.CreateSnapshot("post-setup", ""))
+	assert.ErrorIs(t, fake.CreateSnapshot("post-setup", ""), ErrAlreadyExists)
+	assert.Error(t, fake.CreateSnapshot("-bad", ""))
+	assert.Nil(t, fake.Stop())
+	assert.Nil(t, fake.CreateSnapshot("stopped", ""))
+
+	assert.Nil(t, fake.RestoreSnapshot("post-setup"))
+	state, _ := fake.State()
+	assert.Equal(t, StateRunning, state)
+	snapshots, _ := fake.ListSnapshots()
+	assert.True(t, snapshots[0].Current)
+	assert.False(t, snapshots[1].Current)
+
+	assert.Nil(t, fake.DeleteSnapshot("stopped"))
+	assert.ErrorIs(t, fake.DeleteSnapshot("stopped"), ErrNotFound)
+}
@@ -0,0 +1,334 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"swdt/pkg/executors/iface"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"sigs.k8s.io/yaml"
+)
+
+// Interaction is a command executed in a session with its results.
+type Interaction struct {
+	Target   string            `json:"target"`
+	Command  string            `json:"command"`
+	Params   map[string]string `json:"params,omitempty"`
+	Output   string            `json:"output,omitempty"`
+	ExitCode int               `json:"exitCode,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Record   *RemoteError      `json:"record,omitempty"`
+
+	used bool
+}
+
+// Cassette is the ordered list of interactions of a session, shared by the
+// remote and local executors of a runner.
+type Cassette struct {
+	mu           sync.Mutex
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// LoadCassette reads a YAML cassette from the file.
+func LoadCassette(file string) (*Cassette, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cassette := &Cassette{}
+	if err = yaml.UnmarshalStrict(data, cassette); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", file, err)
+	}
+	return cassette, nil
+}
+
+// Save writes the cassette in the file as YAML.
+func (c *Cassette) Save(file string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// record appends the interaction filling its result from the command error, the secrets
+// are redacted before it is saved.
+func (c *Cassette) record(interaction *Interaction, err error, redactor *Redactor) {
+	var (
+		remoteErr *RemoteError
+		exitErr   *ssh.ExitError
+		localErr  interface{ ExitCode() int }
+	)
+	switch {
+	case err == nil:
+	case errors.As(err, &remoteErr):
+		interaction.ExitCode = remoteErr.ExitCode
+		if remoteErr.Message != "" {
+			record := *remoteErr
+			interaction.Record = &record
+		}
+	case errors.As(err, &exitErr):
+		interaction.ExitCode = exitErr.ExitStatus()
+	case errors.As(err, &localErr):
+		interaction.ExitCode = localErr.ExitCode()
+	default:
+		interaction.Error = err.Error()
+	}
+	interaction.redact(redactor)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, interaction)
+}
+
+// next returns the first interaction not served yet matching the command.
+func (c *Cassette) next(target, command string, params map[string]string) (*Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, interaction := range c.Interactions {
+		if interaction.used || interaction.Target != target || !matchRecorded(interaction.Command, command) {
+			continue
+		}
+		if !matchParams(interaction.Params, params) {
+			continue
+		}
+		interaction.used = true
+		return interaction, nil
+	}
+	return nil, fmt.Errorf("cassette has no %s interaction for command: %s", target, command)
+}
+
+// Pending returns the interactions not served by the replaying executors.
+func (c *Cassette) Pending() []*Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var pending []*Interaction
+	for _, interaction := range c.Interactions {
+		if !interaction.used {
+			pending = append(pending, interaction)
+		}
+	}
+	return pending
+}
+
+// redact replaces the secrets of the command, its params and its results.
+func (i *Interaction) redact(redactor *Redactor) {
+	i.Command, i.Output, i.Error = redactor.Redact(i.Command), redactor.Redact(i.Output), redactor.Redact(i.Error)
+	if i.Params != nil {
+		params := make(map[string]string, len(i.Params))
+		for name, value := range i.Params {
+			params[name] = redactor.Redact(value)
+		}
+		i.Params = params
+	}
+	if i.Record != nil {
+		i.Record.Message, i.Record.Statement = redactor.Redact(i.Record.Message), redactor.Redact(i.Record.Statement)
+	}
+}
+
+// matchRecorded reports whether the value is the recorded one, a redacted secret of
+// the recording matches any text.
+func matchRecorded(recorded, value string) bool {
+	if !strings.Contains(recorded, redacted) {
+		return recorded == value
+	}
+	parts := strings.Split(recorded, redacted)
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile(`(?s)^` + strings.Join(parts, ".*") + `$`).MatchString(value)
+}
+
+// matchParams reports whether the params are the recorded ones.
+func matchParams(recorded, params map[string]string) bool {
+	if len(recorded) != len(params) {
+		return false
+	}
+	for name, value := range params {
+		if expected, ok := recorded[name]; !ok || !matchRecorded(expected, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// err rebuilds the command error from the recorded result.
+func (i *Interaction) err() error {
+	switch {
+	case i.Record != nil:
+		record := *i.Record
+		record.ExitCode = i.ExitCode
+		return &record
+	case i.ExitCode != 0:
+		return &RemoteError{ExitCode: i.ExitCode}
+	case i.Error != "":
+		return errors.New(i.Error)
+	}
+	return nil
+}
+
+// RecordingConnection is an SSHExecutor saving every interaction of the inner executor.
+type RecordingConnection struct {
+	inner    iface.SSHExecutor
+	cassette *Cassette
+	redactor *Redactor
+}
+
+// NewRecordingExecutor returns an SSH executor recording the inner executor in the cassette,
+// the secrets are replaced by the redactor when not nil.
+func NewRecordingExecutor(inner iface.SSHExecutor, cassette *Cassette, redactor *Redactor) iface.SSHExecutor {
+	return &RecordingConnection{inner: inner, cassette: cassette, redactor: redactor}
+}
+
+func (c *RecordingConnection) Connect() error {
+	return c.inner.Connect()
+}
+
+func (c *RecordingConnection) Close() error {
+	return c.inner.Close()
+}
+
+func (c *RecordingConnection) Run(args string, streams iface.Streams) error {
+	return c.RunWithParams(args, nil, streams)
+}
+
+func (c *RecordingConnection) RunWithParams(script string, params map[string]string, streams iface.Streams) error {
+	var stdout syncBuffer
+	err := c.inner.RunWithParams(script, params, iface.Streams{Stdout: tee(&stdout, streams.Stdout), Stderr: streams.Stderr})
+	if ferr := streams.Flush(); err == nil {
+		err = ferr
+	}
+	c.cassette.record(&Interaction{Target: TargetRemote, Command: script, Params: params, Output: trimOutput(stdout.String())}, err, c.redactor)
+	return err
+}
+
+func (c *RecordingConnection) Copy(local, remote, perm string) error {
+	err := c.inner.Copy(local, remote, perm)
+	c.cassette.record(&Interaction{Target: TargetCopy, Command: fmt.Sprintf("%s -> %s (%s)", local, remote, perm)}, err, c.redactor)
+	return err
+}
+
+func (c *RecordingConnection) Download(remote, local string) error {
+	err := c.inner.Download(remote, local)
+	c.cassette.record(&Interaction{Target: TargetDownload, Command: fmt.Sprintf("%s -> %s", remote, local)}, err, c.redactor)
+	return err
+}
+
+// RecordingLocal is a LocalExecutor saving every interaction of the inner executor.
+type RecordingLocal struct {
+	inner    iface.LocalExecutor
+	cassette *Cassette
+	redactor *Redactor
+}
+
+// NewRecordingLocalExecutor returns a local executor recording the inner executor in the cassette,
+// the secrets are replaced by the redactor when not nil.
+func NewRecordingLocalExecutor(inner iface.LocalExecutor, cassette *Cassette, redactor *Redactor) iface.LocalExecutor {
+	return &RecordingLocal{inner: inner, cassette: cassette, redactor: redactor}
+}
+
+func (c *RecordingLocal) Run(cmd *iface.Command, streams iface.Streams) error {
+	var stdout syncBuffer
+	err := c.inner.Run(cmd, iface.Streams{Stdout: tee(&stdout, streams.Stdout), Stderr: streams.Stderr})
+	if ferr := streams.Flush(); err == nil {
+		err = ferr
+	}
+	c.cassette.record(&Interaction{Target: TargetLocal, Command: cmd.String(), Output: trimOutput(stdout.String())}, err, c.redactor)
+	return err
+}
+
+// ReplayingConnection is an SSHExecutor serving the interactions saved in a cassette.
+type ReplayingConnection struct {
+	cassette *Cassette
+}
+
+// NewReplayingExecutor returns an SSH executor answering the commands from the cassette.
+func NewReplayingExecutor(cassette *Cassette) iface.SSHExecutor {
+	return &ReplayingConnection{cassette: cassette}
+}
+
+func (c *ReplayingConnection) Connect() error {
+	return nil
+}
+
+func (c *ReplayingConnection) Close() error {
+	return nil
+}
+
+func (c *ReplayingConnection) Run(args string, streams iface.Streams) error {
+	return c.RunWithParams(args, nil, streams)
+}
+
+func (c *ReplayingConnection) RunWithParams(script string, params map[string]string, streams iface.Streams) error {
+	interaction, err := c.cassette.next(TargetRemote, script, params)
+	if err != nil {
+		return err
+	}
+	if err = sendOutput(interaction.Output, streams); err != nil {
+		return err
+	}
+	return interaction.err()
+}
+
+func (c *ReplayingConnection) Copy(local, remote, perm string) error {
+	interaction, err := c.cassette.next(TargetCopy, fmt.Sprintf("%s -> %s (%s)", local, remote, perm), nil)
+	if err != nil {
+		return err
+	}
+	return interaction.err()
+}
+
+func (c *ReplayingConnection) Download(remote, local string) error {
+	interaction, err := c.cassette.next(TargetDownload, fmt.Sprintf("%s -> %s", remote, local), nil)
+	if err != nil {
+		return err
+	}
+	return interaction.err()
+}
+
+// ReplayingLocal is a LocalExecutor serving the interactions saved in a cassette.
+type ReplayingLocal struct {
+	cassette *Cassette
+}
+
+// NewReplayingLocalExecutor returns a local executor answering the commands from the cassette.
+func NewReplayingLocalExecutor(cassette *Cassette) iface.LocalExecutor {
+	return &ReplayingLocal{cassette: cassette}
+}
+
+func (c *ReplayingLocal) Run(cmd *iface.Command, streams iface.Streams) error {
+	interaction, err := c.cassette.next(TargetLocal, cmd.String(), nil)
+	if err != nil {
+		return err
+	}
+	if err = sendOutput(interaction.Output, streams); err != nil {
+		return err
+	}
+	return interaction.err()
+}
+
+// trimOutput removes the trailing line ending added back by sendOutput.
+func trimOutput(output string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(output, "\n"), "\r")
+}
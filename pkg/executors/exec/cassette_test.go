@@ -0,0 +1,115 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"swdt/pkg/executors/iface"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	var (
+		cassette = &Cassette{}
+		notFound = &RemoteError{ExitCode: 1, Category: "ObjectNotFound", Message: "Cannot find any service", Line: 1}
+		file     = filepath.Join(t.TempDir(), "cassette.yaml")
+	)
+
+	// record the session of dry-run executors with canned results
+	remote := NewRecordingExecutor(NewDryRunExecutor(&Plan{},
+		Result{Match: regexp.MustCompile(`kubelet`), Output: "Running kubelet"},
+		Result{Match: regexp.MustCompile(`containerd`), Err: notFound},
+	), cassette, nil)
+	local := NewRecordingLocalExecutor(NewDryRunLocalExecutor(&Plan{},
+		Result{Match: regexp.MustCompile(`kubectl`), Err: errors.New("connection refused")},
+	), cassette, nil)
+
+	var stdout bytes.Buffer
+	assert.Nil(t, remote.Run("get-service kubelet", iface.Streams{Stdout: &stdout}))
+	assert.Equal(t, "Running kubelet\n", stdout.String())
+	assert.Equal(t, notFound, remote.Run("get-service containerd", iface.Streams{}))
+	assert.Nil(t, remote.Copy("kubelet.exe", "C:\\k\\kubelet.exe", "0755"))
+	assert.NotNil(t, local.Run(iface.NewCommand("kubectl", "get", "nodes"), iface.Streams{}))
+	assert.Nil(t, cassette.Save(file))
+
+	// replay the saved session out of order
+	loaded, err := LoadCassette(file)
+	assert.Nil(t, err)
+	assert.Len(t, loaded.Interactions, 4)
+	replayRemote, replayLocal := NewReplayingExecutor(loaded), NewReplayingLocalExecutor(loaded)
+
+	assert.EqualError(t, replayLocal.Run(iface.NewCommand("kubectl", "get", "nodes"), iface.Streams{}), "connection refused")
+	assert.Nil(t, replayRemote.Copy("kubelet.exe", "C:\\k\\kubelet.exe", "0755"))
+	assert.Equal(t, notFound, replayRemote.Run("get-service containerd", iface.Streams{}))
+
+	stdout.Reset()
+	assert.Nil(t, replayRemote.Run("get-service kubelet", iface.Streams{Stdout: &stdout}))
+	assert.Equal(t, "Running kubelet\n", stdout.String())
+	assert.Empty(t, loaded.Pending())
+
+	// every interaction is served once
+	assert.NotNil(t, replayRemote.Run("get-service kubelet", iface.Streams{}))
+}
+
+func TestCassetteRedacted(t *testing.T) {
+	redactor, err := NewRedactor(DefaultSecretPatterns...)
+	assert.Nil(t, err)
+	redactor.AddSecret("sh4red")
+	var (
+		cassette = &Cassette{}
+		file     = filepath.Join(t.TempDir(), "cassette.yaml")
+	)
+	remote := NewRecordingExecutor(NewDryRunExecutor(&Plan{}), cassette, redactor)
+	local := NewRecordingLocalExecutor(NewDryRunLocalExecutor(&Plan{},
+		Result{Match: regexp.MustCompile(`token create`), Output: "kubeadm join cp:8443 --token abc.def"},
+	), cassette, redactor)
+
+	params := map[string]string{"Share": "data", "Password": "sh4red"}
+	assert.Nil(t, remote.RunWithParams("param($Share, $Password) New-SmbGlobalMapping", params, iface.Streams{}))
+	var stdout bytes.Buffer
+	assert.Nil(t, local.Run(iface.NewCommand("kubeadm", "token", "create"), iface.Streams{Stdout: &stdout}))
+	// the caller receives the secrets
+	assert.Equal(t, "sh4red", params["Password"])
+	assert.Equal(t, "kubeadm join cp:8443 --token abc.def\n", stdout.String())
+	assert.Nil(t, cassette.Save(file))
+
+	data, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "sh4red")
+	assert.NotContains(t, string(data), "abc.def")
+
+	// the redacted interactions are still replayed
+	loaded, err := LoadCassette(file)
+	assert.Nil(t, err)
+	assert.Nil(t, NewReplayingExecutor(loaded).RunWithParams("param($Share, $Password) New-SmbGlobalMapping", params, iface.Streams{}))
+	assert.Nil(t, NewReplayingLocalExecutor(loaded).Run(iface.NewCommand("kubeadm", "token", "create"), iface.Streams{}))
+	assert.Empty(t, loaded.Pending())
+}
+
+func TestMatchRecorded(t *testing.T) {
+	assert.True(t, matchRecorded("kubeadm join", "kubeadm join"))
+	assert.False(t, matchRecorded("kubeadm join", "kubeadm join --token abc"))
+	assert.True(t, matchRecorded("kubeadm join --token ***", "kubeadm join --token abc.def"))
+	assert.False(t, matchRecorded("kubeadm join --token ***", "kubectl apply --token abc.def"))
+	assert.True(t, matchRecorded("a.b *** c", "a.b x\ny c"))
+}
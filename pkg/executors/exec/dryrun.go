@@ -0,0 +1,185 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"swdt/pkg/executors/iface"
+	"sync"
+)
+
+const (
+	TargetRemote   = "remote"
+	TargetLocal    = "local"
+	TargetCopy     = "copy"
+	TargetDownload = "download"
+	TargetLibvirt  = "libvirt"
+)
+
+// Action is a single operation recorded in the plan.
+type Action struct {
+	Target  string
+	Command string
+}
+
+// Plan holds the ordered list of actions recorded by the dry-run executors.
+type Plan struct {
+	mu      sync.Mutex
+	actions []Action
+}
+
+// Record appends an action in the plan.
+func (p *Plan) Record(target, command string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.actions = append(p.actions, Action{Target: target, Command: command})
+}
+
+// Actions returns a copy of the recorded actions.
+func (p *Plan) Actions() []Action {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Action{}, p.actions...)
+}
+
+// Print writes the numbered plan, multi-line scripts are indented under their action.
+func (p *Plan) Print(w io.Writer) {
+	actions := p.Actions()
+	fmt.Fprintf(w, "Plan: %d actions\n", len(actions))
+	for i, action := range actions {
+		lines := strings.Split(strings.TrimSpace(action.Command), "\n")
+		fmt.Fprintf(w, "%3d. [%s] %s\n", i+1, action.Target, strings.TrimSpace(lines[0]))
+		for _, line := range lines[1:] {
+			fmt.Fprintf(w, "       %s\n", strings.TrimSpace(line))
+		}
+	}
+}
+
+// Result is a canned response returned for the commands matching the pattern.
+type Result struct {
+	Match  *regexp.Regexp
+	Output string
+	Err    error
+}
+
+// lookup returns the first result matching the command, commands succeed
+// without output by default.
+func lookup(results []Result, command string) Result {
+	for _, result := range results {
+		if result.Match == nil || result.Match.MatchString(command) {
+			return result
+		}
+	}
+	return Result{}
+}
+
+// sendOutput writes the canned output in the stdout writer as a real execution would.
+func sendOutput(output string, streams iface.Streams) error {
+	if output != "" && streams.Stdout != nil {
+		if _, err := io.WriteString(streams.Stdout, output+"\n"); err != nil {
+			return err
+		}
+	}
+	return streams.Flush()
+}
+
+// DryRunConnection is an SSHExecutor recording the commands instead of running them.
+type DryRunConnection struct {
+	plan    *Plan
+	results []Result
+}
+
+// NewDryRunExecutor returns an SSH executor recording the actions in the plan.
+func NewDryRunExecutor(plan *Plan, results ...Result) iface.SSHExecutor {
+	return &DryRunConnection{plan: plan, results: results}
+}
+
+func (c *DryRunConnection) Connect() error {
+	return nil
+}
+
+func (c *DryRunConnection) Close() error {
+	return nil
+}
+
+func (c *DryRunConnection) Run(args string, streams iface.Streams) error {
+	return c.RunWithParams(args, nil, streams)
+}
+
+func (c *DryRunConnection) RunWithParams(script string, params map[string]string, streams iface.Streams) error {
+	command := script
+	if len(params) > 0 {
+		command = fmt.Sprintf("%s\n%s", script, formatParams(params))
+	}
+	c.plan.Record(TargetRemote, command)
+	result := lookup(c.results, script)
+	if err := sendOutput(result.Output, streams); err != nil {
+		return err
+	}
+	return result.Err
+}
+
+func (c *DryRunConnection) Copy(local, remote, perm string) error {
+	command := fmt.Sprintf("%s -> %s (%s)", local, remote, perm)
+	c.plan.Record(TargetCopy, command)
+	return lookup(c.results, command).Err
+}
+
+func (c *DryRunConnection) Download(remote, local string) error {
+	command := fmt.Sprintf("%s -> %s", remote, local)
+	c.plan.Record(TargetDownload, command)
+	return lookup(c.results, command).Err
+}
+
+// DryRunLocal is a LocalExecutor recording the commands instead of running them.
+type DryRunLocal struct {
+	plan    *Plan
+	results []Result
+}
+
+// NewDryRunLocalExecutor returns a local executor recording the actions in the plan.
+func NewDryRunLocalExecutor(plan *Plan, results ...Result) iface.LocalExecutor {
+	return &DryRunLocal{plan: plan, results: results}
+}
+
+func (c *DryRunLocal) Run(cmd *iface.Command, streams iface.Streams) error {
+	command := cmd.String()
+	c.plan.Record(TargetLocal, command)
+	result := lookup(c.results, command)
+	if err := sendOutput(result.Output, streams); err != nil {
+		return err
+	}
+	return result.Err
+}
+
+// formatParams returns the parameters sorted by name in the PowerShell splatting format.
+func formatParams(params map[string]string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bound := make([]string, 0, len(names))
+	for _, name := range names {
+		bound = append(bound, fmt.Sprintf("-%s %s", name, QuoteArg(params[name])))
+	}
+	return strings.Join(bound, " ")
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"swdt/pkg/executors/iface"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunRecordsPlan(t *testing.T) {
+	plan := &Plan{}
+	remote := NewDryRunExecutor(plan)
+	local := NewDryRunLocalExecutor(plan)
+
+	assert.Nil(t, remote.Connect())
+	assert.Nil(t, remote.Run("get-service -name kubelet", iface.Streams{}))
+	assert.Nil(t, local.Run(iface.NewCommand("kubectl", "create", "-f", "C:\\Program Files\\spec.yaml"), iface.Streams{}))
+	assert.Nil(t, remote.Copy("kubelet.exe", "C:\\k\\kubelet.exe", "0755"))
+	assert.Nil(t, remote.RunWithParams("param($Name) Stop-Service $Name", map[string]string{"Name": "kubelet"}, iface.Streams{}))
+
+	assert.Equal(t, []Action{
+		{Target: TargetRemote, Command: "get-service -name kubelet"},
+		{Target: TargetLocal, Command: `kubectl create -f "C:\\Program Files\\spec.yaml"`},
+		{Target: TargetCopy, Command: "kubelet.exe -> C:\\k\\kubelet.exe (0755)"},
+		{Target: TargetRemote, Command: "param($Name) Stop-Service $Name\n-Name 'kubelet'"},
+	}, plan.Actions())
+
+	var out bytes.Buffer
+	plan.Print(&out)
+	assert.Equal(t, `Plan: 4 actions
+  1. [remote] get-service -name kubelet
+  2. [local] kubectl create -f "C:\\Program Files\\spec.yaml"
+  3. [copy] kubelet.exe -> C:\k\kubelet.exe (0755)
+  4. [remote] param($Name) Stop-Service $Name
+       -Name 'kubelet'
+`, out.String())
+}
+
+func TestDryRunCannedResults(t *testing.T) {
+	plan := &Plan{}
+	remote := NewDryRunExecutor(plan,
+		Result{Match: regexp.MustCompile(`get-service`), Output: "Running kubelet Kubelet"},
+		Result{Match: regexp.MustCompile(`choco`), Err: errors.New("not installed")},
+	)
+
+	assert.NotNil(t, remote.Run("choco --version", iface.Streams{}))
+
+	var stdout bytes.Buffer
+	assert.Nil(t, remote.Run("get-service -name kubelet", iface.Streams{Stdout: &stdout}))
+	assert.Equal(t, "Running kubelet Kubelet\n", stdout.String())
+	assert.Len(t, plan.Actions(), 2)
+}
@@ -1,56 +1,37 @@
 package exec
 
 import (
-	"io"
+	"fmt"
+	"os"
 	"os/exec"
-	"strings"
 	"swdt/pkg/executors/iface"
-	"sync"
 )
 
-type LocalConnection struct {
-	mu     sync.Mutex
-	stdout *chan string // Connection stdout channel
-	stderr *chan string // Connection stderr channel
-}
-
-func (c *LocalConnection) Stdout(std *chan string) {
-	c.stdout = std
-}
-
-func (c *LocalConnection) Stderr(std *chan string) {
-	c.stderr = std
-}
+type LocalConnection struct{}
 
-func NewLocalExecutor() iface.Executor {
+func NewLocalExecutor() iface.LocalExecutor {
 	return &LocalConnection{}
 }
 
-func (c *LocalConnection) Run(args string, stdchan *chan string) error {
-	var (
-		stdout io.Reader
-		stderr io.Reader
-	)
+// Run executes the command, its output is written in the streams before returning.
+func (c *LocalConnection) Run(cmd *iface.Command, streams iface.Streams) error {
+	if cmd == nil || len(cmd.Args) == 0 {
+		return fmt.Errorf("empty command")
+	}
 
 	// Format local command
-	cmd := strings.Split(args, " ")
-	command := exec.Command(cmd[0], cmd[1:]...)
-
-	if c.stdout != nil {
-		// Send command stdout to stdout channel in not empty.
-		stdout, _ = command.StdoutPipe()
-		if stdchan == nil {
-			stdchan = c.stdout
-		}
-		go redirectStandard(&c.mu, stdout, stdchan)
+	command := exec.Command(cmd.Args[0], cmd.Args[1:]...)
+	command.Dir = cmd.Dir
+	if len(cmd.Env) > 0 {
+		command.Env = append(os.Environ(), cmd.Env...)
 	}
+	command.Stdout = streams.Stdout
+	command.Stderr = streams.Stderr
 
-	if c.stderr != nil {
-		// Send command stdout to stdout channel in not empty.
-		stderr, _ = command.StderrPipe()
-		go redirectStandard(&c.mu, stderr, c.stderr)
+	// Start and run test command with arguments, Wait copies the whole output.
+	err := command.Run()
+	if ferr := streams.Flush(); err == nil {
+		err = ferr
 	}
-
-	// Start and run test command with arguments
-	return command.Run()
+	return err
 }
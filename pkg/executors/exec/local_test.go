@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"swdt/pkg/executors/iface"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalRunEmptyCommand(t *testing.T) {
+	e := NewLocalExecutor()
+	assert.NotNil(t, e.Run(nil, iface.Streams{}))
+	assert.NotNil(t, e.Run(&iface.Command{}, iface.Streams{}))
+}
+
+func TestLocalRunArgumentsWithSpaces(t *testing.T) {
+	dir := t.TempDir()
+	e := NewLocalExecutor()
+	cmd := iface.NewCommand("touch", "Program Files").WithDir(dir)
+	assert.Nil(t, e.Run(cmd, iface.Streams{}))
+	_, err := os.Stat(filepath.Join(dir, "Program Files"))
+	assert.Nil(t, err)
+}
+
+func TestLocalRunEnvironment(t *testing.T) {
+	e := NewLocalExecutor()
+	cmd := iface.NewCommand("sh", "-c", `test "$SWDT_TEST" = "a value"`).WithEnv("SWDT_TEST=a value")
+	assert.Nil(t, e.Run(cmd, iface.Streams{}))
+	assert.NotNil(t, e.Run(iface.NewCommand("sh", "-c", `test "$SWDT_TEST" = "a value"`), iface.Streams{}))
+}
+
+func TestLocalConcurrentRuns(t *testing.T) {
+	const runs = 8
+	var (
+		wg      sync.WaitGroup
+		e       = NewLocalExecutor()
+		outputs = make([]bytes.Buffer, runs)
+	)
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cmd := iface.NewCommand("sh", "-c", fmt.Sprintf("echo out-%d; echo err-%d >&2", i, i))
+			assert.Nil(t, e.Run(cmd, iface.Streams{Stdout: &outputs[i]}))
+		}(i)
+	}
+	wg.Wait()
+	for i := range outputs {
+		assert.Equal(t, fmt.Sprintf("out-%d\n", i), outputs[i].String())
+	}
+}
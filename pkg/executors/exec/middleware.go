@@ -0,0 +1,234 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	osexec "os/exec"
+	"strings"
+	"swdt/pkg/executors/iface"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	klog "k8s.io/klog/v2"
+)
+
+// Call is an executor call passed through the middlewares.
+type Call struct {
+	Target  string // one of the Target constants
+	Command string // script, command line or transferred paths
+	Params  map[string]string
+	Streams iface.Streams
+}
+
+// Handler runs a call.
+type Handler func(call *Call) error
+
+// Middleware wraps a handler with cross-cutting behavior, like retries or logging.
+type Middleware func(next Handler) Handler
+
+// chain returns the handler wrapped by the middlewares, the first one is the outermost.
+func chain(handler Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// MiddlewareConnection is an SSH executor passing every call through the middlewares.
+type MiddlewareConnection struct {
+	inner       iface.SSHExecutor
+	middlewares []Middleware
+}
+
+// NewMiddlewareExecutor returns the SSH executor wrapped by the middlewares.
+func NewMiddlewareExecutor(inner iface.SSHExecutor, middlewares ...Middleware) iface.SSHExecutor {
+	return &MiddlewareConnection{inner: inner, middlewares: middlewares}
+}
+
+func (m *MiddlewareConnection) Run(args string, streams iface.Streams) error {
+	return m.RunWithParams(args, nil, streams)
+}
+
+func (m *MiddlewareConnection) RunWithParams(script string, params map[string]string, streams iface.Streams) error {
+	run := func(call *Call) error {
+		return m.inner.RunWithParams(call.Command, call.Params, call.Streams)
+	}
+	return chain(run, m.middlewares)(&Call{Target: TargetRemote, Command: script, Params: params, Streams: streams})
+}
+
+func (m *MiddlewareConnection) Copy(local, remote, perm string) error {
+	copyFile := func(*Call) error {
+		return m.inner.Copy(local, remote, perm)
+	}
+	return chain(copyFile, m.middlewares)(&Call{Target: TargetCopy, Command: fmt.Sprintf("%s -> %s", local, remote)})
+}
+
+func (m *MiddlewareConnection) Download(remote, local string) error {
+	download := func(*Call) error {
+		return m.inner.Download(remote, local)
+	}
+	return chain(download, m.middlewares)(&Call{Target: TargetDownload, Command: fmt.Sprintf("%s -> %s", remote, local)})
+}
+
+func (m *MiddlewareConnection) Connect() error {
+	return m.inner.Connect()
+}
+
+func (m *MiddlewareConnection) Close() error {
+	return m.inner.Close()
+}
+
+// MiddlewareLocal is a local executor passing every call through the middlewares.
+type MiddlewareLocal struct {
+	inner       iface.LocalExecutor
+	middlewares []Middleware
+}
+
+// NewMiddlewareLocalExecutor returns the local executor wrapped by the middlewares.
+func NewMiddlewareLocalExecutor(inner iface.LocalExecutor, middlewares ...Middleware) iface.LocalExecutor {
+	return &MiddlewareLocal{inner: inner, middlewares: middlewares}
+}
+
+func (m *MiddlewareLocal) Run(cmd *iface.Command, streams iface.Streams) error {
+	if cmd == nil {
+		return m.inner.Run(cmd, streams)
+	}
+	run := func(call *Call) error {
+		return m.inner.Run(cmd, call.Streams)
+	}
+	return chain(run, m.middlewares)(&Call{Target: TargetLocal, Command: cmd.String(), Streams: streams})
+}
+
+// summary returns the first line of the redacted command for log messages.
+func summary(call *Call, redactor *Redactor) string {
+	command := redactor.Redact(call.Command)
+	if i := strings.IndexByte(command, '\n'); i >= 0 {
+		command = command[:i] + " ..."
+	}
+	return command
+}
+
+// Trace prints the redacted command of every call in out.
+func Trace(out io.Writer, redactor *Redactor) Middleware {
+	labels := map[string]string{TargetRemote: "SSH", TargetLocal: "LOCAL", TargetCopy: "COPY", TargetDownload: "DOWNLOAD"}
+	return func(next Handler) Handler {
+		return func(call *Call) error {
+			resc.Fprintf(out, "%s: %s\n", labels[call.Target], redactor.Redact(call.Command))
+			return next(call)
+		}
+	}
+}
+
+// Timing logs the duration of every call.
+func Timing(redactor *Redactor) Middleware {
+	return func(next Handler) Handler {
+		return func(call *Call) error {
+			start := time.Now()
+			err := next(call)
+			klog.Infof("[%s] %s finished in %s", call.Target, summary(call, redactor), time.Since(start).Round(time.Millisecond))
+			return err
+		}
+	}
+}
+
+// Transcript writes every call with its redacted output and result in w, each
+// line prefixed with a timestamp. Lines of concurrent calls may interleave.
+func Transcript(w io.Writer, redactor *Redactor) Middleware {
+	var mu sync.Mutex
+	writeLine := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = fmt.Fprintf(w, "%s %s\n", time.Now().UTC().Format(time.RFC3339), fmt.Sprintf(format, args...))
+	}
+	return func(next Handler) Handler {
+		return func(call *Call) error {
+			for i, line := range strings.Split(redactor.Redact(call.Command), "\n") {
+				if i == 0 {
+					writeLine("[%s] %s", call.Target, line)
+				} else {
+					writeLine("  %s", line)
+				}
+			}
+			original := call.Streams
+			stdout := iface.NewLineWriter(func(line string) { writeLine("  stdout: %s", redactor.Redact(line)) })
+			stderr := iface.NewLineWriter(func(line string) { writeLine("  stderr: %s", redactor.Redact(line)) })
+			call.Streams.Stdout = tee(stdout, original.Stdout)
+			call.Streams.Stderr = tee(stderr, original.Stderr)
+
+			start := time.Now()
+			err := next(call)
+			_, _, _ = stdout.Flush(), stderr.Flush(), original.Flush()
+			elapsed := time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				writeLine("  failed in %s: %s", elapsed, redactor.Redact(err.Error()))
+			} else {
+				writeLine("  done in %s", elapsed)
+			}
+			return err
+		}
+	}
+}
+
+// RetryPolicy configures the retries of the failed calls.
+type RetryPolicy struct {
+	Attempts  int                  // total attempts, values under 2 disable the retries
+	Delay     time.Duration        // delay before the first retry, doubled on every retry
+	Retryable func(err error) bool // errors worth a retry, IsTransient when unset
+}
+
+// Retry runs the call again while it fails with a retryable error. The output of
+// the failed attempts was already written in the streams.
+func Retry(policy RetryPolicy) Middleware {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+	return func(next Handler) Handler {
+		return func(call *Call) error {
+			delay := policy.Delay
+			for attempt := 1; ; attempt++ {
+				err := next(call)
+				if err == nil || attempt >= policy.Attempts || !retryable(err) {
+					return err
+				}
+				klog.Warningf("[%s] attempt %d/%d failed, retrying in %s: %v", call.Target, attempt, policy.Attempts, delay, err)
+				time.Sleep(delay)
+				delay *= 2
+			}
+		}
+	}
+}
+
+// IsTransient reports whether the command failed on the connection before it started
+// on the node, so running it again is safe. The connection errors of a started command
+// are not transient since the steps are not all idempotent.
+func IsTransient(err error) bool {
+	var (
+		remoteErr *RemoteError
+		exitErr   *osexec.ExitError
+		openErr   *ssh.OpenChannelError
+	)
+	switch {
+	case err == nil, errors.As(err, &remoteErr), errors.As(err, &exitErr):
+		return false
+	}
+	return errors.Is(err, errNotStarted) || errors.As(err, &openErr)
+}
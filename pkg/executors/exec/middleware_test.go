@@ -0,0 +1,110 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"swdt/pkg/executors/iface"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// order returns a middleware appending its name to the calls order.
+func order(name string, calls *[]string) Middleware {
+	return func(next Handler) Handler {
+		return func(call *Call) error {
+			*calls = append(*calls, name)
+			return next(call)
+		}
+	}
+}
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	var calls []string
+	plan := &Plan{}
+	remote := NewMiddlewareExecutor(NewDryRunExecutor(plan), order("outer", &calls), order("inner", &calls))
+	assert.Nil(t, remote.Run("get-service", iface.Streams{}))
+	assert.Nil(t, remote.Copy("kubelet.exe", "C:\\k\\kubelet.exe", "0755"))
+	assert.Equal(t, []string{"outer", "inner", "outer", "inner"}, calls)
+	assert.Len(t, plan.Actions(), 2)
+}
+
+func TestRetry(t *testing.T) {
+	var attempts int
+	flaky := func(call *Call) error {
+		if attempts++; attempts < 3 {
+			return fmt.Errorf("%w: %w", errNotStarted, io.EOF)
+		}
+		return nil
+	}
+	retry := Retry(RetryPolicy{Attempts: 3, Delay: time.Millisecond})
+	assert.Nil(t, retry(flaky)(&Call{Target: TargetRemote}))
+	assert.Equal(t, 3, attempts)
+
+	// failing scripts are not retried
+	attempts = 0
+	failing := func(call *Call) error {
+		attempts++
+		return &RemoteError{ExitCode: 1}
+	}
+	assert.NotNil(t, retry(failing)(&Call{Target: TargetRemote}))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.False(t, IsTransient(nil))
+	assert.False(t, IsTransient(&RemoteError{ExitCode: 1}))
+	assert.False(t, IsTransient(errors.New("client is empty, call Connect() first")))
+	assert.True(t, IsTransient(fmt.Errorf("%w: %w", errNotStarted, io.EOF)))
+	assert.True(t, IsTransient(&ssh.OpenChannelError{Reason: ssh.ResourceShortage}))
+	// the connection errors of a started command are not retried
+	assert.False(t, IsTransient(io.EOF))
+	assert.False(t, IsTransient(fmt.Errorf("run: %w", errHostExited)))
+}
+
+func TestTraceAndTranscript(t *testing.T) {
+	redactor, err := NewRedactor(DefaultSecretPatterns...)
+	assert.Nil(t, err)
+	var trace, transcript, stdout bytes.Buffer
+	local := NewMiddlewareLocalExecutor(NewDryRunLocalExecutor(&Plan{},
+		Result{Match: regexp.MustCompile(`token create`), Output: "kubeadm join cp:8443 --token abc.def"},
+		Result{Match: regexp.MustCompile(`kubectl`), Err: errors.New("connection refused")},
+	), Trace(&trace, redactor), Transcript(&transcript, redactor))
+
+	assert.Nil(t, local.Run(iface.NewCommand("kubeadm", "token", "create"), iface.Streams{Stdout: &stdout}))
+	assert.NotNil(t, local.Run(iface.NewCommand("kubectl", "apply", "--token", "xyz"), iface.Streams{}))
+
+	// the caller receives the secret, the displayed output is redacted
+	assert.Equal(t, "kubeadm join cp:8443 --token abc.def\n", stdout.String())
+	assert.Equal(t, "LOCAL: kubeadm token create\nLOCAL: kubectl apply --token ***\n", trace.String())
+
+	lines := strings.Split(strings.TrimSpace(transcript.String()), "\n")
+	assert.Len(t, lines, 5)
+	assert.Regexp(t, `^\S+Z \[local\] kubeadm token create$`, lines[0])
+	assert.Regexp(t, `stdout: kubeadm join cp:8443 --token \*\*\*$`, lines[1])
+	assert.Regexp(t, `done in \S+$`, lines[2])
+	assert.Regexp(t, `\[local\] kubectl apply --token \*\*\*$`, lines[3])
+	assert.Regexp(t, `failed in \S+: connection refused$`, lines[4])
+}
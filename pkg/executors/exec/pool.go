@@ -0,0 +1,85 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// defaultMaxSessions leaves room under the sshd default of 10 sessions per connection.
+	defaultMaxSessions = 8
+	defaultKeepAlive   = 30 * time.Second
+)
+
+// sessionPool bounds the number of sessions opened concurrently on one connection,
+// callers block until a slot is released.
+type sessionPool struct {
+	slots chan struct{}
+}
+
+// newSessionPool returns a pool allowing size concurrent sessions.
+func newSessionPool(size int) *sessionPool {
+	if size <= 0 {
+		size = defaultMaxSessions
+	}
+	return &sessionPool{slots: make(chan struct{}, size)}
+}
+
+// acquire takes a slot from the pool, the returned function releases it.
+func (p *sessionPool) acquire() func() {
+	p.slots <- struct{}{}
+	return func() { <-p.slots }
+}
+
+// keepAliveInterval parses the configured keepalive, zero disables it.
+func keepAliveInterval(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultKeepAlive, nil
+	}
+	if value == "0" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("invalid SSH keepalive '%s'", value)
+	}
+	return interval, nil
+}
+
+// keepAlive sends a keepalive request every interval until stop is closed, the
+// connection is closed when the node stops answering so pending calls fail fast.
+func keepAlive(client *ssh.Client, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				klog.Warningf("SSH keepalive failed, closing the connection: %v", err)
+				_ = client.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"bytes"
+	"swdt/pkg/executors/iface"
+	"swdt/pkg/executors/tests"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionPoolBounds(t *testing.T) {
+	pool := newSessionPool(2)
+	first, second := pool.acquire(), pool.acquire()
+
+	acquired := make(chan struct{})
+	go func() {
+		pool.acquire()()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("third session acquired while the pool was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first()
+	<-acquired
+	second()
+	assert.Equal(t, defaultMaxSessions, cap(newSessionPool(0).slots))
+}
+
+func TestKeepAliveInterval(t *testing.T) {
+	interval, err := keepAliveInterval("")
+	assert.Nil(t, err)
+	assert.Equal(t, defaultKeepAlive, interval)
+	interval, err = keepAliveInterval("0")
+	assert.Nil(t, err)
+	assert.Zero(t, interval)
+	interval, err = keepAliveInterval("5s")
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Second, interval)
+	_, err = keepAliveInterval("often")
+	assert.NotNil(t, err)
+}
+
+func TestKeepAliveKeepsConnection(t *testing.T) {
+	server := tests.NewServer(t).Handle(`get-service`, tests.Reply{Stdout: "Running"})
+	credentials := server.Credentials()
+	credentials.KeepAlive = "10ms"
+	executor := NewSSHExecutor(credentials)
+	assert.Nil(t, executor.Connect())
+
+	// a few keepalive requests are answered before the command runs
+	time.Sleep(50 * time.Millisecond)
+	var stdout bytes.Buffer
+	assert.Nil(t, executor.Run("get-service", iface.Streams{Stdout: &stdout}))
+	assert.Equal(t, "Running", stdout.String())
+
+	assert.Nil(t, executor.Close())
+	assert.NotNil(t, executor.Run("get-service", iface.Streams{}))
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/executors/iface"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// maxCommandLength is the cmd.exe limit used by the OpenSSH default shell,
+	// longer scripts are uploaded as temporary files instead.
+	maxCommandLength = 8191
+
+	scriptDirectory = "C:\\Windows\\Temp"
+
+	// utf8BOM marks the uploaded scripts as UTF-8, Windows PowerShell reads the
+	// files without it with the ANSI code page.
+	utf8BOM = "\ufeff"
+
+	// errorMarker prefixes the serialized ErrorRecord written in stderr.
+	errorMarker = "#SWDT-ERROR#"
+
+	strictPrologue = "$ErrorActionPreference = 'Stop'\ntry {\n"
+	catchRecord    = `
+} catch {
+  $swdtRecord = [ordered]@{
+    category = $_.CategoryInfo.Category.ToString()
+    message = $_.Exception.Message
+    errorId = $_.FullyQualifiedErrorId
+    line = $_.InvocationInfo.ScriptLineNumber
+    statement = "$($_.InvocationInfo.Line)".Trim()
+  }
+  [Console]::Error.WriteLine('` + errorMarker + `' + ($swdtRecord | ConvertTo-Json -Compress))
+`
+	strictEpilogue = catchRecord + "  exit 1\n}\nif ($LASTEXITCODE) { exit $LASTEXITCODE }\n"
+)
+
+// RemoteError is a failure of a remote PowerShell script. When the script throws, the
+// fields are filled from its ErrorRecord, otherwise only the exit code is set.
+type RemoteError struct {
+	ExitCode  int    `json:"-"`
+	Category  string `json:"category"`
+	Message   string `json:"message"`
+	ErrorID   string `json:"errorId"`
+	Line      int    `json:"line"`
+	Statement string `json:"statement"`
+}
+
+func (e *RemoteError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("remote script exited with status %d", e.ExitCode)
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("%s: %s (line %d: %s)", e.Category, e.Message, e.Line, e.Statement)
+	}
+	return fmt.Sprintf("%s: %s", e.Category, e.Message)
+}
+
+// recordWriter is the stderr writer extracting the serialized ErrorRecord,
+// the other lines are forwarded.
+type recordWriter struct {
+	*iface.LineWriter
+	record *RemoteError
+}
+
+func newRecordWriter(forward io.Writer, offset int) *recordWriter {
+	w := &recordWriter{}
+	w.LineWriter = iface.NewLineWriter(func(line string) {
+		if record := parseErrorRecord(line, offset); record != nil {
+			w.record = record
+			return
+		}
+		if forward != nil {
+			_, _ = fmt.Fprintln(forward, line)
+		}
+	})
+	return w
+}
+
+// parseErrorRecord returns the ErrorRecord serialized in the line, the line
+// number is made relative to the original script.
+func parseErrorRecord(line string, offset int) *RemoteError {
+	if !strings.HasPrefix(line, errorMarker) {
+		return nil
+	}
+	record := &RemoteError{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, errorMarker)), record); err != nil {
+		return nil
+	}
+	if record.Line -= offset; record.Line < 0 {
+		record.Line = 0
+	}
+	return record
+}
+
+// remoteError combines the session error with the parsed ErrorRecord.
+func remoteError(err error, record *RemoteError) error {
+	var exitErr *ssh.ExitError
+	if err == nil {
+		return nil
+	}
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if record == nil {
+		record = &RemoteError{}
+	}
+	record.ExitCode = exitErr.ExitStatus()
+	return record
+}
+
+// EncodeCommand returns the UTF-16LE base64 form of the script expected by -EncodedCommand.
+func EncodeCommand(script string) string {
+	codes := utf16.Encode([]rune(script))
+	buf := make([]byte, len(codes)*2)
+	for i, code := range codes {
+		binary.LittleEndian.PutUint16(buf[i*2:], code)
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// QuoteArg returns the value as a PowerShell single-quoted string literal.
+func QuoteArg(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// bindParams returns the code surrounding a script to invoke it as a script block with
+// the operator, so a leading param() block always parses. The named parameters are
+// splatted and invoked with & in a child scope, values are bound without any escaping.
+func bindParams(operator string, params map[string]string) (prefix, suffix string) {
+	if len(params) == 0 {
+		return operator + " {\n", "\n}"
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("$swdtParams = @{\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %s = %s\n", QuoteArg(name), QuoteArg(params[name]))
+	}
+	b.WriteString("}\n& {\n")
+	return b.String(), "\n} @swdtParams"
+}
+
+// wrapScript makes the script stop on the first error, reporting the ErrorRecord as JSON
+// in stderr, and exit with the last native exit code. The returned offset is the number
+// of lines added before the script.
+func wrapScript(script string, params map[string]string) (string, int) {
+	return wrap(strictPrologue, strictEpilogue, "&", script, params)
+}
+
+// wrap surrounds the script with the prologue and epilogue, returning the number of lines added before it.
+func wrap(prologue, epilogue, operator, script string, params map[string]string) (string, int) {
+	bindPrefix, bindSuffix := bindParams(operator, params)
+	prefix := prologue + bindPrefix
+	return prefix + script + bindSuffix + epilogue, strings.Count(prefix, "\n")
+}
+
+// shell returns the PowerShell binary configured for the node.
+func (c *SSHConnection) shell() string {
+	if c.creds.Shell != "" {
+		return c.creds.Shell
+	}
+	return v1alpha1.ShellWindowsPowerShell
+}
+
+// encodedCommand returns the command line running the script through -EncodedCommand.
+func (c *SSHConnection) encodedCommand(script string) string {
+	return fmt.Sprintf("%s -NoLogo -NoProfile -NonInteractive -EncodedCommand %s", c.shell(), EncodeCommand(script))
+}
+
+// scriptFile returns the content of the uploaded script file, with a BOM for Windows PowerShell.
+func (c *SSHConnection) scriptFile(script string) string {
+	if c.shell() == v1alpha1.ShellWindowsPowerShell {
+		return utf8BOM + script
+	}
+	return script
+}
+
+// fileCommand returns the command line running a script file uploaded in the node.
+func (c *SSHConnection) fileCommand(remote string) string {
+	return fmt.Sprintf(`%s -NoLogo -NoProfile -NonInteractive -ExecutionPolicy Bypass -File "%s"`, c.shell(), remote)
+}
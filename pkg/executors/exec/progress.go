@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	klog "k8s.io/klog/v2"
+)
+
+const progressInterval = 2 * time.Second
+
+// Progress describes the state of an ongoing file transfer.
+type Progress struct {
+	Filename    string
+	Transferred int64
+	Total       int64
+	Rate        float64 // bytes per second
+	ETA         time.Duration
+}
+
+// ProgressFunc receives periodic transfer progress reports.
+type ProgressFunc func(p Progress)
+
+// LogProgress is the default ProgressFunc, it prints the transfer state in the logs.
+func LogProgress(p Progress) {
+	klog.Infof("%s: %s/%s (%s/s, ETA %s)", p.Filename, formatBytes(p.Transferred),
+		formatBytes(p.Total), formatBytes(int64(p.Rate)), p.ETA.Round(time.Second))
+}
+
+// progressReader wraps a reader and reports the amount of data read through it.
+type progressReader struct {
+	reader   io.Reader
+	filename string
+	total    int64
+	read     int64
+	start    time.Time
+	last     time.Time
+	done     bool
+	fn       ProgressFunc
+}
+
+func newProgressReader(reader io.Reader, filename string, total int64, fn ProgressFunc) *progressReader {
+	now := time.Now()
+	return &progressReader{reader: reader, filename: filename, total: total, start: now, last: now, fn: fn}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	p.read += int64(n)
+	if p.fn == nil || p.done {
+		return n, err
+	}
+	now := time.Now()
+	finished := p.read >= p.total || err == io.EOF
+	if finished || now.Sub(p.last) >= progressInterval {
+		p.last, p.done = now, finished
+		p.fn(p.progress(now))
+	}
+	return n, err
+}
+
+// progress calculates the current rate and the estimated time to finish.
+func (p *progressReader) progress(now time.Time) Progress {
+	var (
+		rate    float64
+		eta     time.Duration
+		elapsed = now.Sub(p.start).Seconds()
+	)
+	if elapsed > 0 {
+		rate = float64(p.read) / elapsed
+	}
+	if rate > 0 && p.total > p.read {
+		eta = time.Duration(float64(p.total-p.read) / rate * float64(time.Second))
+	}
+	return Progress{Filename: p.filename, Transferred: p.read, Total: p.total, Rate: rate, ETA: eta}
+}
+
+// formatBytes returns a human-readable representation of a size in bytes.
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
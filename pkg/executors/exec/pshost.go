@@ -0,0 +1,239 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/executors/iface"
+	"sync"
+
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// endMarker prefixes the sentinels closing the output of a script in the host.
+	endMarker = "#SWDT-END#"
+
+	// hostPrologue resets the status of the previous script, the script is dot-sourced
+	// so the variables it sets persist in the host.
+	hostPrologue = "$global:LASTEXITCODE = 0\n$swdtStatus = 0\n$ProgressPreference = 'SilentlyContinue'\n" + strictPrologue
+	hostEpilogue = catchRecord + "  $swdtStatus = 1\n}\nif (-not $swdtStatus -and $LASTEXITCODE) { $swdtStatus = $LASTEXITCODE }\n"
+
+	// hostCommand is the single line sent to the host for every script, the sentinels are
+	// written in both streams even when the script block fails to parse.
+	hostCommand = "try { . ([ScriptBlock]::Create([Text.Encoding]::Unicode.GetString([Convert]::FromBase64String('%s')))) | Out-String -Stream } " +
+		"catch { $swdtStatus = 1; [Console]::Error.WriteLine($_.ToString()) } " +
+		"finally { [Console]::Error.WriteLine('%[2]s'); [Console]::Out.WriteLine('%[2]s' + $swdtStatus) }\n"
+)
+
+// errHostExited is returned when the PowerShell host stops before finishing a script.
+var errHostExited = errors.New("powershell host exited")
+
+// PowerShellHost is an SSH executor running the scripts in one long-lived PowerShell
+// process, so variables, modules and the working directory persist across calls.
+// A call arriving while the host is busy runs in its own process instead of waiting.
+type PowerShellHost struct {
+	*SSHConnection
+	mu      sync.Mutex // held while a script runs in the host
+	process *hostProcess
+	release func()
+}
+
+// NewPowerShellHostExecutor returns an SSH executor running the scripts in a persistent PowerShell host.
+func NewPowerShellHostExecutor(credentials *v1alpha1.SSHSpec) iface.SSHExecutor {
+	return &PowerShellHost{SSHConnection: NewSSHExecutor(credentials).(*SSHConnection)}
+}
+
+// NewRemoteExecutor returns the SSH executor picked by the credentials.
+func NewRemoteExecutor(credentials *v1alpha1.SSHSpec) iface.SSHExecutor {
+	if credentials.PersistentShell {
+		return NewPowerShellHostExecutor(credentials)
+	}
+	return NewSSHExecutor(credentials)
+}
+
+// Run a powershell command passed in the argument
+func (h *PowerShellHost) Run(args string, streams iface.Streams) error {
+	return h.RunWithParams(args, nil, streams)
+}
+
+// RunWithParams runs the script in the host binding the params to its param() block.
+func (h *PowerShellHost) RunWithParams(script string, params map[string]string, streams iface.Streams) error {
+	if !h.mu.TryLock() {
+		klog.V(2).Info("PowerShell host is busy, running the script in a new process")
+		return h.SSHConnection.RunWithParams(script, params, streams)
+	}
+	defer h.mu.Unlock()
+
+	if h.process == nil {
+		if err := h.start(); err != nil {
+			return fmt.Errorf("%w: %w", errNotStarted, err)
+		}
+	}
+	err := h.process.run(script, params, streams)
+	if errors.Is(err, errHostExited) {
+		h.stop()
+	}
+	return err
+}
+
+// start opens the session running the PowerShell host.
+func (h *PowerShellHost) start() error {
+	session, release, err := h.newSession()
+	if err != nil {
+		return err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		release()
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		release()
+		return err
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		release()
+		return err
+	}
+	if err = session.Start(h.hostCommandLine()); err != nil {
+		release()
+		return fmt.Errorf("failed to start powershell host: %w", err)
+	}
+	h.process, h.release = newHostProcess(stdin, stdout, stderr), release
+	return nil
+}
+
+// stop closes the host input and its session.
+func (h *PowerShellHost) stop() {
+	if h.process == nil {
+		return
+	}
+	_ = h.process.stdin.Close()
+	h.release()
+	// drain the readers so they finish once the session is closed
+	for _, lines := range []<-chan string{h.process.stdout, h.process.stderr} {
+		go func(lines <-chan string) {
+			for range lines {
+			}
+		}(lines)
+	}
+	h.process, h.release = nil, nil
+}
+
+// hostCommandLine returns the command line starting the host reading the scripts from stdin.
+func (h *PowerShellHost) hostCommandLine() string {
+	return fmt.Sprintf("%s -NoLogo -NoProfile -NonInteractive -NoExit -Command -", h.shell())
+}
+
+// Close stops the host and finishes the connection
+func (h *PowerShellHost) Close() error {
+	h.mu.Lock()
+	h.stop()
+	h.mu.Unlock()
+	return h.SSHConnection.Close()
+}
+
+// hostProcess frames the scripts sent to a PowerShell host and reads their output
+// back, every script ends with a numbered sentinel in stdout and stderr.
+type hostProcess struct {
+	stdin          io.WriteCloser
+	stdout, stderr <-chan string
+	count          int
+}
+
+// newHostProcess starts reading the lines written by the host.
+func newHostProcess(stdin io.WriteCloser, stdout, stderr io.Reader) *hostProcess {
+	return &hostProcess{stdin: stdin, stdout: readLines(stdout), stderr: readLines(stderr)}
+}
+
+// readLines sends the lines of the reader in the returned channel, closed at EOF.
+func readLines(reader io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines <- strings.TrimSuffix(scanner.Text(), "\r")
+		}
+	}()
+	return lines
+}
+
+// run sends the script to the host and forwards its output until both sentinels are read.
+func (p *hostProcess) run(script string, params map[string]string, streams iface.Streams) error {
+	p.count++
+	sentinel := fmt.Sprintf("%s%d#", endMarker, p.count)
+	wrapped, offset := wrap(hostPrologue, hostEpilogue, ".", script, params)
+	if _, err := fmt.Fprintf(p.stdin, hostCommand, EncodeCommand(wrapped), sentinel); err != nil {
+		// the host reads whole lines, a script not written was not started
+		return fmt.Errorf("%w: %w: %v", errNotStarted, errHostExited, err)
+	}
+
+	var (
+		status  int
+		records = newRecordWriter(streams.Stderr, offset)
+		stdout  = p.stdout
+		stderr  = p.stderr
+	)
+	for stdout != nil || stderr != nil {
+		select {
+		case line, ok := <-stdout:
+			if !ok {
+				return errHostExited
+			}
+			if strings.HasPrefix(line, sentinel) {
+				status, _ = strconv.Atoi(strings.TrimPrefix(line, sentinel))
+				stdout = nil
+			} else if streams.Stdout != nil {
+				_, _ = fmt.Fprintln(streams.Stdout, line)
+			}
+		case line, ok := <-stderr:
+			if !ok {
+				return errHostExited
+			}
+			if line == sentinel {
+				stderr = nil
+			} else {
+				_, _ = fmt.Fprintln(records, line)
+			}
+		}
+	}
+	_ = records.Flush()
+	if err := streams.Flush(); err != nil {
+		return err
+	}
+
+	if status == 0 {
+		return nil
+	}
+	record := records.record
+	if record == nil {
+		record = &RemoteError{}
+	}
+	record.ExitCode = status
+	return record
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"swdt/pkg/executors/iface"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	hostScript   = regexp.MustCompile(`FromBase64String\('([^']+)'\)`)
+	hostSentinel = regexp.MustCompile(`Error\.WriteLine\('(` + endMarker + `\d+#)'\)`)
+)
+
+// decodeCommand reverses EncodeCommand.
+func decodeCommand(t *testing.T, encoded string) string {
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	assert.Nil(t, err)
+	codes := make([]uint16, len(buf)/2)
+	for i := range codes {
+		codes[i] = binary.LittleEndian.Uint16(buf[i*2:])
+	}
+	return string(utf16.Decode(codes))
+}
+
+// startFakeHost answers every script line with the handler output and the sentinels.
+func startFakeHost(t *testing.T, handler func(script string, stdout, stderr io.Writer) int) *hostProcess {
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	go func() {
+		defer stdoutWriter.Close()
+		defer stderrWriter.Close()
+		scanner := bufio.NewScanner(stdinReader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			script := decodeCommand(t, hostScript.FindStringSubmatch(line)[1])
+			sentinel := hostSentinel.FindStringSubmatch(line)[1]
+			status := handler(script, stdoutWriter, stderrWriter)
+			fmt.Fprintln(stderrWriter, sentinel)
+			fmt.Fprintf(stdoutWriter, "%s%d\r\n", sentinel, status)
+		}
+	}()
+	return newHostProcess(stdinWriter, stdoutReader, stderrReader)
+}
+
+func TestHostProcessRun(t *testing.T) {
+	var scripts []string
+	host := startFakeHost(t, func(script string, stdout, stderr io.Writer) int {
+		scripts = append(scripts, script)
+		switch {
+		case strings.Contains(script, "Stop-Service"):
+			fmt.Fprintln(stderr, "warning")
+			fmt.Fprintln(stderr, errorMarker+`{"category":"ObjectNotFound","message":"no kubelet","line":10}`)
+			return 1
+		case strings.Contains(script, "choco"):
+			return 3
+		}
+		fmt.Fprint(stdout, "Running\r\nkubelet\r\n")
+		return 0
+	})
+
+	var stdout, stderr bytes.Buffer
+	assert.Nil(t, host.run("get-service kubelet", nil, iface.Streams{Stdout: &stdout}))
+	assert.Equal(t, "Running\nkubelet\n", stdout.String())
+	assert.Contains(t, scripts[0], "$swdtStatus = 0")
+	assert.NotContains(t, scripts[0], "exit")
+
+	err := host.run("param($Name) Stop-Service $Name", map[string]string{"Name": "kubelet"}, iface.Streams{Stderr: &stderr})
+	assert.Equal(t, &RemoteError{ExitCode: 1, Category: "ObjectNotFound", Message: "no kubelet", Line: 1}, err)
+	assert.Equal(t, "warning\n", stderr.String())
+
+	assert.Equal(t, &RemoteError{ExitCode: 3}, host.run("choco --version", nil, iface.Streams{}))
+	assert.Equal(t, 3, host.count)
+}
+
+func TestHostProcessExited(t *testing.T) {
+	host := startFakeHost(t, func(string, io.Writer, io.Writer) int { return 0 })
+	assert.Nil(t, host.stdin.Close())
+	assert.ErrorIs(t, host.run("get-service", nil, iface.Streams{}), errHostExited)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+const redacted = "***"
+
+// DefaultSecretPatterns match the secrets passed in commands and printed in their
+// output, the first group of a pattern is replaced, or the whole match without groups.
+var DefaultSecretPatterns = []string{
+	`--token[= ](\S+)`,
+	`--discovery-token-ca-cert-hash[= ](\S+)`,
+	`--certificate-key[= ](\S+)`,
+	`(?i)-Password[= ]('(?:[^']|'')*'|\S+)`,
+	`(?i)password\s*[:=]\s*(\S+)`,
+}
+
+// Redactor replaces the secrets in the commands and outputs displayed to the user,
+// it is safe for concurrent use.
+type Redactor struct {
+	mu       sync.RWMutex
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a redactor for the secret patterns.
+func NewRedactor(patterns ...string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// AddSecret redacts every occurrence of the literal value, empty values are ignored.
+func (r *Redactor) AddSecret(secret string) {
+	if r == nil || secret == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, regexp.MustCompile(regexp.QuoteMeta(secret)))
+}
+
+// Redact returns the text with the secrets replaced, a nil redactor returns it unchanged.
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, re := range r.patterns {
+		text = replaceSecret(re, text)
+	}
+	return text
+}
+
+// replaceSecret replaces the first group of every match, or the match without groups.
+func replaceSecret(re *regexp.Regexp, text string) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+	var (
+		result []byte
+		last   int
+	)
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if len(match) > 2 && match[2] >= 0 {
+			start, end = match[2], match[3]
+		}
+		result = append(result, text[last:start]...)
+		result = append(result, redacted...)
+		last = end
+	}
+	return string(append(result, text[last:]...))
+}
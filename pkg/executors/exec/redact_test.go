@@ -0,0 +1,42 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	redactor, err := NewRedactor(DefaultSecretPatterns...)
+	assert.Nil(t, err)
+	redactor.AddSecret("s3cr3t")
+
+	assert.Equal(t, "kubeadm join cp:8443 --token *** --discovery-token-ca-cert-hash ***",
+		redactor.Redact("kubeadm join cp:8443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234"))
+	assert.Equal(t, "New-LocalUser -Name admin -Password ***", redactor.Redact("New-LocalUser -Name admin -Password 'it''s'"))
+	assert.Equal(t, "login with *** and ***", redactor.Redact("login with s3cr3t and s3cr3t"))
+	assert.Equal(t, "get-service kubelet", redactor.Redact("get-service kubelet"))
+
+	var nilRedactor *Redactor
+	nilRedactor.AddSecret("ignored")
+	assert.Equal(t, "--token abc", nilRedactor.Redact("--token abc"))
+
+	_, err = NewRedactor("(")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+
+	"github.com/pkg/sftp"
+	klog "k8s.io/klog/v2"
+)
+
+const partialSuffix = ".swdt-partial"
+
+var driveLetter = regexp.MustCompile(`^[A-Za-z]:`)
+
+// transferMode returns the configured file transfer protocol, when unset
+// the SFTP subsystem is probed and scp is used as fallback.
+func (c *SSHConnection) transferMode() string {
+	if c.creds.Transfer != "" {
+		return c.creds.Transfer
+	}
+	c.mu.Lock()
+	detected := c.detected
+	c.mu.Unlock()
+	if detected != "" {
+		return detected
+	}
+
+	// concurrent callers may probe twice, both get the same answer
+	detected = v1alpha1.TransferSCP
+	if _, release, err := c.sftpClient(); err == nil {
+		release()
+		detected = v1alpha1.TransferSFTP
+	}
+	klog.V(2).Infof("SSH detected '%s' as file transfer protocol", detected)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.detected = detected
+	return detected
+}
+
+// sftpClient starts the SFTP subsystem once a slot of the pool is free, the
+// returned function closes the client and releases the slot.
+func (c *SSHConnection) sftpClient() (*sftp.Client, func(), error) {
+	conn, err := c.connection()
+	if err != nil {
+		return nil, nil, err
+	}
+	release := c.pool.acquire()
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("%w: failed to start sftp subsystem: %w", errNotStarted, err)
+	}
+	return client, func() {
+		_ = client.Close()
+		release()
+	}, nil
+}
+
+// sftpUpload writes the reader content in a temporary file next to remote, creating
+// the parent directories, and renames it to the final destination when completed.
+func (c *SSHConnection) sftpUpload(reader io.Reader, remote, perm string) error {
+	mode, err := strconv.ParseUint(perm, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid file permission %s: %w", perm, err)
+	}
+
+	client, release, err := c.sftpClient()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	destination := sftpPath(remote)
+	if err = client.MkdirAll(path.Dir(destination)); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
+
+	partial := destination + partialSuffix
+	file, err := client.Create(partial)
+	if err != nil {
+		return err
+	}
+	if _, err = file.ReadFrom(reader); err != nil {
+		_ = file.Close()
+		_ = client.Remove(partial)
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = client.Chmod(partial, os.FileMode(mode)); err != nil {
+		return err
+	}
+	return sftpRename(client, partial, destination)
+}
+
+// sftpDownload copies the remote file content into writer.
+func (c *SSHConnection) sftpDownload(remote string, writer io.Writer) error {
+	client, release, err := c.sftpClient()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	file, err := client.Open(sftpPath(remote))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteTo(writer)
+	return err
+}
+
+// sftpRename atomically replaces destination when the server supports the posix
+// rename extension, otherwise the old file is removed before the rename.
+func sftpRename(client *sftp.Client, source, destination string) error {
+	if err := client.PosixRename(source, destination); err == nil {
+		return nil
+	}
+	if err := client.Remove(destination); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return client.Rename(source, destination)
+}
+
+// sftpPath converts a Windows path to the format used by the OpenSSH SFTP server.
+func sftpPath(remote string) string {
+	remote = strings.ReplaceAll(remote, "\\", "/")
+	if driveLetter.MatchString(remote) {
+		remote = "/" + remote
+	}
+	return remote
+}
@@ -17,15 +17,15 @@ limitations under the License.
 package exec
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/fatih/color"
 	"io"
 	"os"
 	"path"
-	"regexp"
 	"strings"
 	"swdt/apis/config/v1alpha1"
 	"swdt/pkg/executors/iface"
@@ -43,32 +43,39 @@ const (
 	SCP_BINARY = "C:\\Windows\\System32\\OpenSSH\\scp.exe"
 
 	timeout time.Duration = 30 * time.Second
+
+	// minUploadRate is the slowest transfer rate in bytes per second tolerated
+	// before an upload is considered stalled, used to scale the copy deadline.
+	minUploadRate int64 = 256 * 1024
 )
 
 var (
 	resc = color.New(color.FgBlue)
+
+	// errNotStarted wraps the failures happening before the command runs on the node.
+	errNotStarted = errors.New("command not started")
 )
 
+// SSHConnection is safe for concurrent use, the sessions are multiplexed on one
+// client and bounded by the session pool.
 type SSHConnection struct {
-	client *ssh.Client
-	creds  *v1alpha1.SSHSpec
-
-	mu     sync.Mutex
-	stdout *chan string // Connection stdout channel
-	stderr *chan string // Connection stderr channel
+	mu       sync.Mutex
+	client   *ssh.Client
+	creds    *v1alpha1.SSHSpec
+	pool     *sessionPool
+	stop     chan struct{} // stops the keepalive of the client
+	progress ProgressFunc
+	detected string // file transfer protocol detected on the node
 }
 
-func (c *SSHConnection) Stdout(std *chan string) {
-	c.stdout = std
-}
-
-func (c *SSHConnection) Stderr(std *chan string) {
-	c.stderr = std
+// SetProgress overrides the function receiving the upload progress reports.
+func (c *SSHConnection) SetProgress(fn ProgressFunc) {
+	c.progress = fn
 }
 
 // NewSSHExecutor returns a specialized SSH connection
 func NewSSHExecutor(credentials *v1alpha1.SSHSpec) iface.SSHExecutor {
-	return &SSHConnection{creds: credentials}
+	return &SSHConnection{creds: credentials, pool: newSessionPool(credentials.MaxSessions), progress: LogProgress}
 }
 
 // fetchAuthMethod fetches all available authentication methods
@@ -109,6 +116,10 @@ func (c *SSHConnection) Connect() error {
 	if err != nil {
 		return err
 	}
+	interval, err := keepAliveInterval(c.creds.KeepAlive)
+	if err != nil {
+		return err
+	}
 	klog.V(2).Infof("SSH connecting to '%s' as '%s'\n", c.creds.Hostname, c.creds.Username)
 	client, err := ssh.Dial(TCP_TYPE, fmt.Sprintf("%s", c.creds.Hostname), &ssh.ClientConfig{
 		User:            c.creds.Username,
@@ -118,77 +129,248 @@ func (c *SSHConnection) Connect() error {
 	if err != nil {
 		return fmt.Errorf("failed to dial: %s", err)
 	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.client = client
+	if interval > 0 {
+		c.stop = make(chan struct{})
+		go keepAlive(client, interval, c.stop)
+	}
 	return nil
 }
 
-// Run a powershell command passed in the argument
-func (c *SSHConnection) Run(args string, stdchan *chan string) error {
+// connection returns the connected client.
+func (c *SSHConnection) connection() (*ssh.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.client == nil {
-		return fmt.Errorf("client is empty, call Connect() first")
+		return nil, fmt.Errorf("client is empty, call Connect() first")
 	}
+	return c.client, nil
+}
 
-	var (
-		err     error
-		session *ssh.Session
-		stderr  io.Reader
-		stdout  io.Reader
-	)
+// newSession opens a session once a slot of the pool is free, the returned
+// function closes the session and releases the slot.
+func (c *SSHConnection) newSession() (*ssh.Session, func(), error) {
+	client, err := c.connection()
+	if err != nil {
+		return nil, nil, err
+	}
+	release := c.pool.acquire()
+	session, err := client.NewSession()
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return session, func() {
+		_ = session.Close()
+		release()
+	}, nil
+}
+
+// Run a powershell command passed in the argument
+func (c *SSHConnection) Run(args string, streams iface.Streams) error {
+	return c.RunWithParams(args, nil, streams)
+}
 
-	if session, err = c.client.NewSession(); err != nil {
+// RunWithParams runs a powershell script binding the params to its param() block.
+// The script is sent encoded, or uploaded as a file when too long for the command line.
+func (c *SSHConnection) RunWithParams(script string, params map[string]string, streams iface.Streams) error {
+	if _, err := c.connection(); err != nil {
 		return err
 	}
-	defer session.Close() // nolint
 
-	args = regexp.MustCompile(`\r?\n`).ReplaceAllLiteralString(args, ";")
-	cmd := fmt.Sprintf(`powershell -NoLogo -Command "%v"`, strings.Trim(args, "\n"))
-	resc.Printf("SSH: %s\n", cmd)
+	script, offset := wrapScript(script, params)
 
-	if c.stdout != nil || stdchan != nil {
-		// Send command stdout to stdout channel in not empty.
-		stdout, _ = session.StdoutPipe()
-		if stdchan == nil {
-			stdchan = c.stdout
+	cmd := c.encodedCommand(script)
+	if len(cmd) > maxCommandLength {
+		remote := fmt.Sprintf("%s\\swdt-%d.ps1", scriptDirectory, time.Now().UnixNano())
+		content := c.scriptFile(script)
+		if err := c.upload(strings.NewReader(content), remote, "0644", int64(len(content))); err != nil {
+			return fmt.Errorf("%w: failed to upload script: %w", errNotStarted, err)
 		}
-		go redirectStandard(&c.mu, stdout, stdchan)
+		defer c.removeFile(remote)
+		cmd = c.fileCommand(remote)
 	}
 
-	if c.stderr != nil {
-		// Send command stderr to stderr channel if not empty.
-		stderr, _ = session.StderrPipe()
-		go redirectStandard(&c.mu, stderr, c.stderr)
+	session, release, err := c.newSession()
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotStarted, err)
+	}
+	defer release()
+
+	// Wait waits for the output to be copied, the error record is parsed from stderr.
+	records := newRecordWriter(streams.Stderr, offset)
+	session.Stdout = streams.Stdout
+	session.Stderr = records
+
+	if err = session.Start(cmd); err != nil {
+		return fmt.Errorf("%w: %w", errNotStarted, err)
+	}
+	err = session.Wait()
+	_ = records.Flush()
+	if ferr := streams.Flush(); err == nil {
+		err = ferr
 	}
+	return remoteError(err, records.record)
+}
 
-	return session.Run(cmd)
+// output runs a powershell script returning its standard output.
+func (c *SSHConnection) output(script string) (string, error) {
+	var stdout syncBuffer
+	err := c.RunWithParams(script, nil, iface.Streams{Stdout: &stdout})
+	return strings.TrimSpace(stdout.String()), err
 }
 
-// Copy a file from local to remote setting the permissions
+// removeFile deletes a remote file, failures are only logged.
+func (c *SSHConnection) removeFile(remote string) {
+	if _, err := c.output("Remove-Item -Force -LiteralPath " + QuoteArg(remote)); err != nil {
+		klog.V(2).Infof("failed to remove remote file '%s': %v", remote, err)
+	}
+}
+
+// Copy a file from local to remote setting the permissions, the file is streamed
+// from disk and the upload is skipped if the remote file has the same content.
 func (c *SSHConnection) Copy(local, remote, perm string) error {
 	klog.V(2).Infof("SSH copying local '%s' to remote '%s'\n", local, remote)
 	file, err := os.Open(local)
 	if err != nil {
 		return err
 	}
-	var contents []byte
-	contents, err = io.ReadAll(file)
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	hash, err := fileHash(file)
+	if err != nil {
+		return fmt.Errorf("failed to hash local file: %w", err)
+	}
+	if remoteHash, err := c.RemoteHash(remote); err == nil && strings.EqualFold(remoteHash, hash) {
+		klog.Infof("Remote file '%s' is up to date, skipping upload.", remote)
+		return nil
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := newProgressReader(file, path.Base(local), info.Size(), c.progress)
+	return c.upload(reader, remote, perm, info.Size())
+}
+
+// upload writes the reader content in the remote file using the transfer protocol of the node.
+func (c *SSHConnection) upload(reader io.Reader, remote, perm string, size int64) error {
+	if c.transferMode() == v1alpha1.TransferSFTP {
+		return c.sftpUpload(reader, remote, perm)
+	}
+	return c.scpUpload(reader, remote, perm, size)
+}
+
+// scpUpload writes the reader content with scp in a temporary file next to remote,
+// creating the parent directory, and renames it to the final destination when completed.
+func (c *SSHConnection) scpUpload(reader io.Reader, remote, perm string, size int64) error {
+	if dir := remoteDir(remote); dir != "" {
+		if _, err := c.output("New-Item -ItemType Directory -Force -Path " + QuoteArg(dir) + " | Out-Null"); err != nil {
+			return fmt.Errorf("failed to create remote directory: %w", err)
+		}
+	}
+	partial := remote + partialSuffix
+	if err := c.CopyPassThru(reader, partial, perm, size); err != nil {
+		c.removeFile(partial)
+		return err
+	}
+	_, err := c.output(fmt.Sprintf("Move-Item -Force -LiteralPath %s -Destination %s", QuoteArg(partial), QuoteArg(remote)))
+	return err
+}
+
+// remoteDir returns the parent directory of a Windows path, empty for a file at the
+// root of a drive or in the working directory.
+func remoteDir(remote string) string {
+	i := strings.LastIndexAny(remote, "\\/")
+	if i <= 0 || driveLetter.MatchString(remote) && i == 2 {
+		return ""
+	}
+	return remote[:i]
+}
+
+// Download a file from remote to local, the local file is only replaced
+// after the transfer finishes.
+func (c *SSHConnection) Download(remote, local string) error {
+	if _, err := c.connection(); err != nil {
+		return err
+	}
+	klog.V(2).Infof("SSH downloading remote '%s' to local '%s'\n", remote, local)
+	file, err := os.CreateTemp(path.Dir(local), path.Base(local)+"*"+partialSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // nolint
+
+	if c.transferMode() == v1alpha1.TransferSFTP {
+		err = c.sftpDownload(remote, file)
+	} else {
+		err = c.scpDownload(remote, file)
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
-		return fmt.Errorf("failed to read all data from reader: %w", err)
+		return err
+	}
+	return os.Rename(file.Name(), local)
+}
+
+// scpDownload copies the remote file content into writer using the scp binary.
+func (c *SSHConnection) scpDownload(remote string, writer io.Writer) error {
+	conn, err := c.connection()
+	if err != nil {
+		return err
 	}
-	return c.CopyPassThru(bytes.NewReader(contents), remote, perm, int64(len(contents)))
+	defer c.pool.acquire()()
+	client, err := scp.NewClientBySSH(conn)
+	if err != nil {
+		return err
+	}
+	defer client.Session.Close() // nolint
+	client.RemoteBinary = SCP_BINARY
+	client.Timeout = timeout
+	return client.CopyFromRemotePassThru(context.Background(), writer, remote, nil)
+}
+
+// RemoteHash returns the SHA256 hash of a remote file.
+func (c *SSHConnection) RemoteHash(remote string) (string, error) {
+	return c.output(fmt.Sprintf("(Get-FileHash -Algorithm SHA256 -LiteralPath %s).Hash", QuoteArg(remote)))
 }
 
-// CopyPassThru is an auxiliary function for Copy
+// fileHash returns the hex encoded SHA256 hash of the reader content.
+func fileHash(reader io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// copyTimeout returns the upload deadline scaled by the size of the file.
+func copyTimeout(size int64) time.Duration {
+	return timeout + time.Duration(size/minUploadRate)*time.Second
+}
+
+// CopyPassThru is an auxiliary function for Copy using the scp protocol
 func (c *SSHConnection) CopyPassThru(reader io.Reader, remote string, permissions string, size int64) error {
 	var (
 		ctx      = context.Background()
 		filename = path.Base(remote)
 	)
 
-	session, err := c.client.NewSession()
+	session, release, err := c.newSession()
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", errNotStarted, err)
 	}
-	defer session.Close()
+	defer release()
 
 	stdout, err := session.StdoutPipe()
 	if err != nil {
@@ -209,6 +391,11 @@ func (c *SSHConnection) CopyPassThru(reader io.Reader, remote string, permission
 		defer wg.Done()
 		defer writer.Close()
 
+		// the sink acknowledges its start, the header and the written file
+		if err := checkResponse(stdout); err != nil {
+			errCh <- err
+			return
+		}
 		_, err := fmt.Fprintln(writer, "C"+permissions, size, filename)
 		if err != nil {
 			errCh <- err
@@ -245,9 +432,9 @@ func (c *SSHConnection) CopyPassThru(reader io.Reader, remote string, permission
 		}
 	}()
 
-	if timeout > 0 {
+	if deadline := copyTimeout(size); deadline > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, timeout)
+		ctx, cancel = context.WithTimeout(ctx, deadline)
 		defer cancel()
 	}
 
@@ -284,10 +471,18 @@ func wait(wg *sync.WaitGroup, ctx context.Context) error {
 
 // Close finishes the connection
 func (c *SSHConnection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.client == nil {
 		return nil
 	}
-	return c.client.Close()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	client := c.client
+	c.client = nil
+	return client.Close()
 }
 
 func checkResponse(r io.Reader) error {
@@ -17,9 +17,18 @@ limitations under the License.
 package exec
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"swdt/pkg/executors/iface"
 	"swdt/pkg/executors/tests"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"swdt/apis/config/v1alpha1"
@@ -29,48 +38,287 @@ func TestRunWithoutConnect(t *testing.T) {
 	credentials := &v1alpha1.SSHSpec{}
 	conn := NewSSHExecutor(credentials)
 	assert.NotEqual(t, conn, nil)
-	err := conn.Run("ls", nil)
+	err := conn.Run("ls", iface.Streams{})
 	assert.NotNil(t, err)
 }
 
 func TestStdoutFromRun(t *testing.T) {
 	var cmd = "get-service -name kubelet"
-	responses := &[]tests.Response{
-		{
-			Response: "Running kubelet Kubelet",
-			Error:    nil,
-		},
-	}
-	executor := StartServer(t, 2023, responses)
-	err := executor.Connect()
+	server := tests.NewServer(t).Handle(`get-service -name kubelet`, tests.Reply{Stdout: "Running kubelet Kubelet"})
+	executor := connect(t, server.Credentials())
+
+	// capture the output in a buffer owned by this call
+	var stdout bytes.Buffer
+	err := executor.Run(cmd, iface.Streams{Stdout: &stdout})
 	assert.Nil(t, err)
+	assert.Contains(t, stdout.String(), "Running")
+	server.AssertCommands(t, `ErrorActionPreference = 'Stop'\ntry \{\n& \{\nget-service -name kubelet\n\}`)
+}
 
-	// make a new stdout channel and set into the runner
-	stdout := make(chan string)
+func TestConcurrentRunsKeepOutputsApart(t *testing.T) {
+	const runs = 8
+	number := regexp.MustCompile(`get-service (\d+)`)
+	server := tests.NewServer(t).HandleFunc(`get-service`, func(exec *tests.Exec) int {
+		fmt.Fprintf(exec.Stdout, "output-%s", number.FindStringSubmatch(exec.Script)[1])
+		return 0
+	})
+	executor := connect(t, server.Credentials())
 
-	// run the command
-	err = executor.Run(cmd, &stdout)
-	assert.Nil(t, err)
-	var output string
-	select {
-	case n, ok := <-stdout:
-		if ok {
-			output = n
-		}
+	var (
+		wg      sync.WaitGroup
+		outputs = make([]bytes.Buffer, runs)
+	)
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, executor.Run(fmt.Sprintf("get-service %d", i), iface.Streams{Stdout: &outputs[i]}))
+		}(i)
+	}
+	wg.Wait()
+
+	// every call receives its own output
+	for i := range outputs {
+		assert.Equal(t, fmt.Sprintf("output-%d", i), outputs[i].String())
+	}
+	assert.Equal(t, runs, server.Received(`get-service`))
+}
+
+func TestRunRemoteError(t *testing.T) {
+	record := `{"category":"ObjectNotFound","message":"no kubelet","errorId":"NoServiceFoundForGivenName","line":4,"statement":"Stop-Service kubelet"}`
+	server := tests.NewServer(t).
+		Handle(`Stop-Service`, tests.Reply{Stderr: "warning\n" + errorMarker + record + "\n", ExitCode: 1}).
+		Handle(`choco`, tests.Reply{ExitCode: 3})
+	executor := connect(t, server.Credentials())
+
+	var stderr bytes.Buffer
+	err := executor.Run("Stop-Service kubelet", iface.Streams{Stderr: &stderr})
+	assert.Equal(t, &RemoteError{ExitCode: 1, Category: "ObjectNotFound", Message: "no kubelet", ErrorID: "NoServiceFoundForGivenName", Line: 1, Statement: "Stop-Service kubelet"}, err)
+	assert.Equal(t, "warning\n", stderr.String())
+	assert.Equal(t, &RemoteError{ExitCode: 3}, executor.Run("choco --version", iface.Streams{}))
+	// unknown commands fail like a missing binary
+	assert.Equal(t, &RemoteError{ExitCode: 127}, executor.Run("kubectl version", iface.Streams{}))
+}
+
+func TestRunLongScriptUploaded(t *testing.T) {
+	for _, transfer := range []string{v1alpha1.TransferSCP, v1alpha1.TransferSFTP} {
+		t.Run(transfer, func(t *testing.T) {
+			server := tests.NewServer(t).
+				Handle(`Remove-Item`, tests.Reply{}).
+				Handle(`long-script`, tests.Reply{Stdout: "done"})
+			credentials := server.Credentials()
+			credentials.Transfer = transfer
+			executor := connect(t, credentials)
+
+			var stdout bytes.Buffer
+			script := "# long-script\n" + strings.Repeat("Write-Output 'padding'\n", 500)
+			assert.Nil(t, executor.Run(script, iface.Streams{Stdout: &stdout}))
+			assert.Equal(t, "done", stdout.String())
+			server.AssertCommands(t, `long-script`, `Remove-Item -Force -LiteralPath 'C:\\Windows\\Temp\\swdt-\d+\.ps1'`)
+			assert.Len(t, server.Files(), 1)
+		})
 	}
-	assert.Contains(t, output, "Running")
 }
 
-// startServer starts a fake SSH server
-func StartServer(t *testing.T, port int, expected *[]tests.Response) iface.SSHExecutor {
-	hostname := tests.GetHostname(port)
-	tests.NewServer(hostname, expected)
-	credentials := &v1alpha1.SSHSpec{
-		Hostname: hostname,
-		Username: tests.Username,
-		Password: tests.FakePassword,
+func TestRunLongScriptEncoding(t *testing.T) {
+	for shell, prefix := range map[string]string{v1alpha1.ShellWindowsPowerShell: utf8BOM, v1alpha1.ShellPowerShellCore: "$"} {
+		t.Run(shell, func(t *testing.T) {
+			server := tests.NewServer(t).Handle(`long-script|Remove-Item`, tests.Reply{})
+			credentials := server.Credentials()
+			credentials.Shell = shell
+			executor := connect(t, credentials)
+
+			script := "# long-script\n" + strings.Repeat("Write-Output 'café'\n", 500)
+			assert.Nil(t, executor.Run(script, iface.Streams{}))
+			assert.Len(t, server.Files(), 1)
+			for _, content := range server.Files() {
+				assert.True(t, strings.HasPrefix(string(content), prefix))
+			}
+		})
 	}
+}
+
+func TestCopyAndDownload(t *testing.T) {
+	for _, transfer := range []string{v1alpha1.TransferSCP, v1alpha1.TransferSFTP} {
+		t.Run(transfer, func(t *testing.T) {
+			dir := t.TempDir()
+			local := filepath.Join(dir, "kubelet.exe")
+			content := []byte("kubelet binary")
+			assert.Nil(t, os.WriteFile(local, content, 0644))
+
+			// the remote hash does not match before the upload
+			server := tests.NewServer(t).HandleOnce(`Get-FileHash`, tests.Reply{ExitCode: 1})
+			credentials := server.Credentials()
+			credentials.Transfer = transfer
+			executor := connect(t, credentials)
+
+			assert.Nil(t, executor.Copy(local, "C:\\k\\kubelet.exe", "0755"))
+			uploaded, ok := server.File("C:\\k\\kubelet.exe")
+			assert.True(t, ok)
+			assert.Equal(t, content, uploaded)
+
+			// the same content is not uploaded again
+			hash, _ := fileHash(bytes.NewReader(content))
+			server.Handle(`Get-FileHash`, tests.Reply{Stdout: strings.ToUpper(hash)})
+			server.PutFile("C:\\k\\kubelet.exe", []byte("changed on the node"))
+			assert.Nil(t, executor.Copy(local, "C:\\k\\kubelet.exe", "0755"))
+			uploaded, _ = server.File("C:\\k\\kubelet.exe")
+			assert.Equal(t, "changed on the node", string(uploaded))
+
+			downloaded := filepath.Join(dir, "downloaded.exe")
+			assert.Nil(t, executor.Download("C:\\k\\kubelet.exe", downloaded))
+			read, err := os.ReadFile(downloaded)
+			assert.Nil(t, err)
+			assert.Equal(t, "changed on the node", string(read))
+			assert.NotNil(t, executor.Download("C:\\k\\missing.exe", downloaded))
+		})
+	}
+}
+
+func TestCopyCreatesDirectory(t *testing.T) {
+	for _, transfer := range []string{v1alpha1.TransferSCP, v1alpha1.TransferSFTP} {
+		t.Run(transfer, func(t *testing.T) {
+			local := filepath.Join(t.TempDir(), "kubelet.exe")
+			assert.Nil(t, os.WriteFile(local, []byte("kubelet binary"), 0644))
+
+			server := tests.NewServer(t).Handle(`Get-FileHash`, tests.Reply{ExitCode: 1})
+			credentials := server.Credentials()
+			credentials.Transfer = transfer
+			executor := connect(t, credentials)
+
+			assert.Nil(t, executor.Copy(local, "C:\\opt\\bin\\kubelet.exe", "0755"))
+			assert.True(t, server.Exists("C:\\opt\\bin"))
+			// the temporary file is renamed
+			assert.Len(t, server.Files(), 1)
+			uploaded, _ := server.File("C:\\opt\\bin\\kubelet.exe")
+			assert.Equal(t, "kubelet binary", string(uploaded))
+		})
+	}
+}
+
+func TestRemoteDir(t *testing.T) {
+	assert.Equal(t, `C:\k`, remoteDir(`C:\k\kubelet.exe`))
+	assert.Equal(t, `C:/k/bin`, remoteDir(`C:/k/bin/kubelet.exe`))
+	assert.Equal(t, "", remoteDir(`C:\kubelet.exe`))
+	assert.Equal(t, "", remoteDir(`kubelet.exe`))
+}
+
+// connect returns an executor connected to the fake server, closed at the end of the test.
+func connect(t *testing.T, credentials *v1alpha1.SSHSpec) iface.SSHExecutor {
 	executor := NewSSHExecutor(credentials)
-	assert.NotEqual(t, executor, nil)
+	assert.Nil(t, executor.Connect())
+	t.Cleanup(func() { _ = executor.Close() })
 	return executor
 }
+
+func TestCopyTimeoutScalesWithSize(t *testing.T) {
+	assert.Equal(t, timeout, copyTimeout(0))
+	assert.Equal(t, timeout+4*time.Second, copyTimeout(4*minUploadRate))
+	assert.Greater(t, copyTimeout(1<<30), copyTimeout(1<<20))
+}
+
+func TestFileHash(t *testing.T) {
+	hash, err := fileHash(strings.NewReader("kubelet"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1ca4bc7eb9b3d6f1e205da9cfab437c89d3760d0765a29a6bcbccf4ad51a2cb1", hash)
+}
+
+func TestProgressReader(t *testing.T) {
+	var reports []Progress
+	content := strings.Repeat("x", 1024)
+	reader := newProgressReader(strings.NewReader(content), "kubelet.exe", int64(len(content)), func(p Progress) {
+		reports = append(reports, p)
+	})
+	read, err := io.Copy(io.Discard, reader)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), read)
+
+	// only the final report is sent for a transfer faster than the interval
+	assert.Len(t, reports, 1)
+	assert.Equal(t, "kubelet.exe", reports[0].Filename)
+	assert.Equal(t, int64(len(content)), reports[0].Transferred)
+	assert.Equal(t, time.Duration(0), reports[0].ETA)
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512B", formatBytes(512))
+	assert.Equal(t, "1.5KiB", formatBytes(1536))
+	assert.Equal(t, "2.0GiB", formatBytes(2<<30))
+}
+
+func TestSFTPPath(t *testing.T) {
+	assert.Equal(t, "/C:/k/kubelet.exe", sftpPath("C:\\k\\kubelet.exe"))
+	assert.Equal(t, "/c:/Program Files/containerd/containerd.exe", sftpPath("c:\\Program Files\\containerd\\containerd.exe"))
+	assert.Equal(t, "/tmp/file", sftpPath("/tmp/file"))
+}
+
+func TestEncodeCommand(t *testing.T) {
+	assert.Equal(t, "ZABpAHIA", EncodeCommand("dir"))
+	// characters outside the ASCII range are encoded as UTF-16LE code units
+	assert.Equal(t, "6QA=", EncodeCommand("é"))
+}
+
+func TestBindParams(t *testing.T) {
+	prefix, suffix := bindParams("&", nil)
+	assert.Equal(t, "& {\n", prefix)
+	assert.Equal(t, "\n}", suffix)
+
+	prefix, suffix = bindParams(".", map[string]string{"Hostname": "it's", "Address": "10.0.0.1"})
+	assert.Equal(t, "$swdtParams = @{\n  'Address' = '10.0.0.1'\n  'Hostname' = 'it''s'\n}\n& {\n", prefix)
+	assert.Equal(t, "\n} @swdtParams", suffix)
+}
+
+func TestWrapScript(t *testing.T) {
+	script, offset := wrapScript("Stop-Service kubelet", nil)
+	assert.Equal(t, 3, offset)
+	assert.True(t, strings.HasPrefix(script, "$ErrorActionPreference = 'Stop'\ntry {\n& {\nStop-Service kubelet\n}\n} catch {"))
+
+	// a param() block without bound values still starts the script block
+	script, offset = wrapScript("param($Name = 'kubelet') Stop-Service $Name", nil)
+	assert.Equal(t, 3, offset)
+	assert.Contains(t, script, "try {\n& {\nparam($Name = 'kubelet')")
+	assert.Contains(t, script, errorMarker)
+	assert.Contains(t, script, "if ($LASTEXITCODE) { exit $LASTEXITCODE }")
+
+	_, offset = wrapScript("param($Name) Stop-Service $Name", map[string]string{"Name": "kubelet"})
+	assert.Equal(t, 6, offset)
+}
+
+func TestRecordWriter(t *testing.T) {
+	var forwarded bytes.Buffer
+	records := newRecordWriter(&forwarded, 2)
+	_, _ = io.WriteString(records, "warning\n"+errorMarker+`{"category":"ObjectNotFound",`)
+	_, _ = io.WriteString(records, `"message":"Cannot find any service with service name 'kubelet'.","errorId":"NoServiceFoundForGivenName","line":3,"statement":"Stop-Service kubelet"}`+"\r\n")
+	assert.Nil(t, records.Flush())
+
+	record := records.record
+	assert.Equal(t, "warning\n", forwarded.String())
+	assert.Equal(t, "ObjectNotFound", record.Category)
+	assert.Equal(t, "NoServiceFoundForGivenName", record.ErrorID)
+	assert.Equal(t, 1, record.Line)
+	assert.Equal(t, "ObjectNotFound: Cannot find any service with service name 'kubelet'. (line 1: Stop-Service kubelet)", record.Error())
+
+	records = newRecordWriter(nil, 0)
+	_, _ = io.WriteString(records, "no record")
+	assert.Nil(t, records.Flush())
+	assert.Nil(t, records.record)
+}
+
+func TestParseErrorRecord(t *testing.T) {
+	assert.Nil(t, parseErrorRecord("plain stderr", 0))
+	assert.Nil(t, parseErrorRecord(errorMarker+"not json", 0))
+	record := parseErrorRecord(errorMarker+`{"message":"boom","line":7}`, 6)
+	assert.Equal(t, 1, record.Line)
+}
+
+func TestRemoteError(t *testing.T) {
+	assert.Nil(t, remoteError(nil, nil))
+	assert.Equal(t, io.EOF, remoteError(io.EOF, nil))
+}
+
+func TestEncodedCommandShell(t *testing.T) {
+	conn := &SSHConnection{creds: &v1alpha1.SSHSpec{}}
+	assert.Equal(t, "powershell -NoLogo -NoProfile -NonInteractive -EncodedCommand ZABpAHIA", conn.encodedCommand("dir"))
+	conn.creds.Shell = v1alpha1.ShellPowerShellCore
+	assert.Equal(t, "pwsh -NoLogo -NoProfile -NonInteractive -EncodedCommand ZABpAHIA", conn.encodedCommand("dir"))
+}
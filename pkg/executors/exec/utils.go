@@ -1,43 +1,33 @@
 package exec
 
 import (
-	"bufio"
-	"fmt"
+	"bytes"
 	"io"
-	"strings"
 	"sync"
 )
 
-func redirectStandard(mu *sync.Mutex, std io.Reader, to *chan string) {
-	if to != nil {
-		mu.Lock()
-		defer mu.Unlock()
-		scanner := bufio.NewScanner(std)
-		for scanner.Scan() {
-			*to <- scanner.Text()
-		}
-		close(*to)
-		*to = make(chan string)
-	}
+// syncBuffer is a bytes.Buffer safe for concurrent writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
 }
 
-func EnableOutput(output *string, fn func(std *chan string)) {
-	std := make(chan string)
-	fn(&std)
-	var outlist []string
-	for {
-		select {
-		case n, ok := <-std:
-			if !ok {
-				if output != nil {
-					*output = strings.Join(outlist, " ")
-				}
-				break
-			}
-			if output != nil {
-				outlist = append(outlist, n)
-			}
-			fmt.Println(n)
-		}
+// tee returns a writer duplicating the writes to w when it is set.
+func tee(buf io.Writer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
 	}
+	return io.MultiWriter(buf, w)
 }
@@ -0,0 +1,64 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iface
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Command is a local process invocation, arguments are passed as is
+// to the binary without any shell interpretation.
+type Command struct {
+	// Args holds the binary name followed by its arguments.
+	Args []string
+
+	// Env holds extra KEY=VALUE entries added to the current environment.
+	Env []string
+
+	// Dir is the working directory, the current one is used if empty.
+	Dir string
+}
+
+// NewCommand returns a command running the binary with the arguments.
+func NewCommand(name string, args ...string) *Command {
+	return &Command{Args: append([]string{name}, args...)}
+}
+
+// WithEnv appends environment variables in the KEY=VALUE format.
+func (c *Command) WithEnv(env ...string) *Command {
+	c.Env = append(c.Env, env...)
+	return c
+}
+
+// WithDir sets the working directory of the command.
+func (c *Command) WithDir(dir string) *Command {
+	c.Dir = dir
+	return c
+}
+
+// String returns a printable representation of the command line.
+func (c *Command) String() string {
+	quoted := make([]string, 0, len(c.Args))
+	for _, arg := range c.Args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'") {
+			arg = strconv.Quote(arg)
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iface
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCommand(t *testing.T) {
+	cmd := NewCommand("kubectl", "patch", "--patch={\"spec\": {}}").WithEnv("KUBECONFIG=/tmp/config").WithDir("/tmp")
+	assert.Equal(t, []string{"kubectl", "patch", "--patch={\"spec\": {}}"}, cmd.Args)
+	assert.Equal(t, []string{"KUBECONFIG=/tmp/config"}, cmd.Env)
+	assert.Equal(t, "/tmp", cmd.Dir)
+}
+
+func TestCommandString(t *testing.T) {
+	cmd := NewCommand("ls", "C:\\Program Files", "", "-l")
+	assert.Equal(t, `ls "C:\\Program Files" "" -l`, cmd.String())
+}
@@ -16,23 +16,41 @@ limitations under the License.
 
 package iface
 
+import "io"
+
+// Streams holds the writers receiving the output of a single command, nil
+// writers discard the output. Run returns only after the whole output was
+// written and the writers implementing Flusher were flushed.
+type Streams struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
 // Executor is a generic interface executing commands.
 type Executor interface {
 	// Run execute the command via transport method
-	Run(args string, stdout *chan string) error
+	Run(args string, streams Streams) error
+}
 
-	// Stdout and stderr iface channel setters
-	Stdout(std *chan string)
-	Stderr(std *chan string)
+// LocalExecutor is an interface for processes executed in the host.
+type LocalExecutor interface {
+	// Run execute the command without shell interpretation
+	Run(cmd *Command, streams Streams) error
 }
 
 // SSHExecutor is a interface for SSH connections.
 type SSHExecutor interface {
 	Executor
 
-	// Copy files from and to the node
+	// RunWithParams execute the script binding the named parameters to its param() block
+	RunWithParams(script string, params map[string]string, streams Streams) error
+
+	// Copy files from local to the node
 	Copy(local, remote, perm string) error
 
+	// Download files from the node to local
+	Download(remote, local string) error
+
 	// Connect creates the initial connection objects
 	Connect() error
 
@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iface
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Flusher is implemented by writers buffering data until the command finishes.
+type Flusher interface {
+	Flush() error
+}
+
+// Flush flushes the stream writers implementing Flusher.
+func (s Streams) Flush() error {
+	for _, w := range []io.Writer{s.Stdout, s.Stderr} {
+		if f, ok := w.(Flusher); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LineWriter is an io.Writer calling the handler for each complete line written,
+// the trailing partial line is handled on Flush.
+type LineWriter struct {
+	mu      sync.Mutex
+	buf     []byte
+	handler func(line string)
+}
+
+// NewLineWriter returns a writer calling handler for every line without the line ending.
+func NewLineWriter(handler func(line string)) *LineWriter {
+	return &LineWriter{handler: handler}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.handler(string(bytes.TrimSuffix(w.buf[:i], []byte("\r"))))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush handles the remaining partial line.
+func (w *LineWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.handler(string(bytes.TrimSuffix(w.buf, []byte("\r"))))
+		w.buf = nil
+	}
+	return nil
+}
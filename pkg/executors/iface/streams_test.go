@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iface
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type flushWriter struct {
+	bytes.Buffer
+	err error
+}
+
+func (f *flushWriter) Flush() error {
+	return f.err
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := NewLineWriter(func(line string) { lines = append(lines, line) })
+	_, _ = io.WriteString(w, "first\r\nsec")
+	_, _ = io.WriteString(w, "ond\npartial")
+	assert.Equal(t, []string{"first", "second"}, lines)
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, []string{"first", "second", "partial"}, lines)
+}
+
+func TestLineWriterConcurrentWrites(t *testing.T) {
+	const writers = 8
+	var (
+		wg    sync.WaitGroup
+		lines = map[string]int{}
+	)
+	// the handler is serialized by the writer, no extra locking required
+	w := NewLineWriter(func(line string) { lines[line]++ })
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = fmt.Fprintf(w, "line-%d\n", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < writers; i++ {
+		assert.Equal(t, 100, lines[fmt.Sprintf("line-%d", i)])
+	}
+}
+
+func TestStreamsFlush(t *testing.T) {
+	assert.Nil(t, Streams{}.Flush())
+	assert.Nil(t, Streams{Stdout: &bytes.Buffer{}, Stderr: &flushWriter{}}.Flush())
+	assert.EqualError(t, Streams{Stderr: &flushWriter{err: errors.New("closed")}}.Flush(), "closed")
+}
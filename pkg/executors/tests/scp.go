@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// scpCommand matches the scp sink (-t) and source (-f) commands, with the path quoted or not.
+	scpCommand = regexp.MustCompile(`^\S*scp(?:\.exe)?\s+-(\w+)\s+(.+)$`)
+	// scpMkdir and scpRename match the scripts around an scp upload, creating the
+	// parent directory and renaming the temporary file.
+	scpMkdir  = regexp.MustCompile(`New-Item -ItemType Directory -Force -Path ('[^']*') \| Out-Null`)
+	scpRename = regexp.MustCompile(`Move-Item -Force -LiteralPath ('[^']*') -Destination ('[^']*')`)
+)
+
+// scp receives or sends a file with the scp protocol.
+func (s *Server) scp(match []string, channel io.ReadWriter) int {
+	flags, name := match[1], match[2]
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		name = unquoted
+	}
+	switch {
+	case strings.Contains(flags, "t"):
+		return s.scpSink(name, channel)
+	case strings.Contains(flags, "f"):
+		return s.scpSource(name, channel)
+	}
+	return 1
+}
+
+// scpSink stores the single file sent by the client.
+func (s *Server) scpSink(name string, channel io.ReadWriter) int {
+	reader := bufio.NewReader(channel)
+	if _, err := channel.Write([]byte{0}); err != nil {
+		return 1
+	}
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return 1
+	}
+	var (
+		mode     string
+		size     int64
+		filename string
+	)
+	if _, err = fmt.Sscanf(header, "C%s %d %s", &mode, &size, &filename); err != nil {
+		_, _ = fmt.Fprintf(channel, "\x02invalid header %q\n", header)
+		return 1
+	}
+	if _, err = channel.Write([]byte{0}); err != nil {
+		return 1
+	}
+	content := make([]byte, size)
+	if _, err = io.ReadFull(reader, content); err != nil {
+		return 1
+	}
+	// the content is followed by a zero byte
+	if _, err = reader.ReadByte(); err != nil {
+		return 1
+	}
+	s.PutFile(name, content)
+	if _, err = channel.Write([]byte{0}); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// scpSource sends a stored file to the client.
+func (s *Server) scpSource(name string, channel io.ReadWriter) int {
+	ack := make([]byte, 1)
+	if _, err := io.ReadFull(channel, ack); err != nil {
+		return 1
+	}
+	content, ok := s.File(name)
+	if !ok {
+		_, _ = fmt.Fprintf(channel, "\x02scp: %s: No such file or directory\n", name)
+		return 1
+	}
+	base := name[strings.LastIndexAny(name, `\/`)+1:]
+	if _, err := fmt.Fprintf(channel, "C0644 %d %s\n", len(content), base); err != nil {
+		return 1
+	}
+	if _, err := io.ReadFull(channel, ack); err != nil {
+		return 1
+	}
+	if _, err := channel.Write(append(content, 0)); err != nil {
+		return 1
+	}
+	if _, err := io.ReadFull(channel, ack); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// scpScript runs the scripts around an scp upload, it reports whether the script is one.
+func (s *Server) scpScript(script string) (int, bool) {
+	if match := scpMkdir.FindStringSubmatch(script); match != nil {
+		s.Mkdir(unquote(match[1]))
+		return 0, true
+	}
+	if match := scpRename.FindStringSubmatch(script); match != nil {
+		source, destination := unquote(match[1]), unquote(match[2])
+		content, ok := s.File(source)
+		if !ok {
+			return 1, true
+		}
+		s.RemoveFile(source)
+		s.PutFile(destination, content)
+		return 0, true
+	}
+	return 0, false
+}
@@ -1,11 +1,19 @@
 package tests
 
 import (
+	"encoding/base64"
+	"encoding/binary"
 	"fmt"
-	"golang.org/x/crypto/ssh"
-	"golang.org/x/term"
-	"log"
+	"io"
 	"net"
+	"regexp"
+	"strings"
+	"swdt/apis/config/v1alpha1"
+	"sync"
+	"testing"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/ssh"
 )
 
 var (
@@ -53,72 +61,383 @@ KaT3SUfkvAKQEAAAAOYWtuYWJiZW5AaG9ydXMBAgMEBQ==
 -----END OPENSSH PRIVATE KEY-----`)
 )
 
-type Response struct {
-	Response string
-	Error    error
-	Cmd      string
+var (
+	encodedCommand = regexp.MustCompile(`-EncodedCommand\s+(\S+)`)
+	fileCommand    = regexp.MustCompile(`-File\s+"([^"]+)"`)
+)
+
+// Reply is the scripted answer of a command.
+type Reply struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Exec is a command received by the server.
+type Exec struct {
+	// Command is the raw command line sent by the client.
+	Command string
+	// Script is the PowerShell script decoded from -EncodedCommand, or read from the
+	// uploaded -File, otherwise the raw command.
+	Script string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// HandlerFunc answers a command returning its exit code.
+type HandlerFunc func(exec *Exec) int
+
+type handler struct {
+	pattern *regexp.Regexp
+	fn      HandlerFunc
+	once    bool
+	used    bool
+}
+
+// Server is a scripted SSH server for tests, listening on a random local port. The
+// commands are answered by the first handler matching their script, the scp and
+// SFTP uploads are kept in memory.
+type Server struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	handlers []*handler
+	fallback HandlerFunc
+	commands []string
+	files    map[string][]byte
+	dirs     map[string]bool
+	conns    []net.Conn
+	closed   bool
 }
 
-func NewServer(hostname string, expected *[]Response) {
-	var err error
+// NewServer starts a server closed at the end of the test.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
 	config := &ssh.ServerConfig{PasswordCallback: passwordCallback}
-	if err = parsePrivateKey(config, privateKey); err != nil {
-		log.Fatal(err)
+	if err := parsePrivateKey(config, privateKey); err != nil {
+		t.Fatalf("failed to parse host key: %v", err)
 	}
-	listener, err := net.Listen("tcp", hostname)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
-		log.Fatal("failed on listener: ", err)
+		t.Fatalf("failed on listener: %v", err)
+	}
+	s := &Server{listener: listener, config: config, files: map[string][]byte{}, dirs: map[string]bool{}}
+	s.wg.Add(1)
+	go s.accept()
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Credentials returns the SSH configuration connecting to the server.
+func (s *Server) Credentials() *v1alpha1.SSHSpec {
+	return &v1alpha1.SSHSpec{Hostname: s.Addr(), Username: Username, Password: FakePassword}
+}
+
+// Handle answers the commands matching the pattern with the reply.
+func (s *Server) Handle(pattern string, reply Reply) *Server {
+	return s.HandleFunc(pattern, replyFunc(reply))
+}
+
+// HandleOnce answers the first command matching the pattern with the reply, the
+// next ones fall through the other handlers.
+func (s *Server) HandleOnce(pattern string, reply Reply) *Server {
+	s.addHandler(pattern, replyFunc(reply), true)
+	return s
+}
+
+// HandleFunc answers the commands matching the pattern with the function.
+func (s *Server) HandleFunc(pattern string, fn HandlerFunc) *Server {
+	s.addHandler(pattern, fn, false)
+	return s
+}
+
+// Fallback answers the commands matching no handler, they fail with exit code 127 otherwise.
+func (s *Server) Fallback(fn HandlerFunc) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = fn
+	return s
+}
+
+func (s *Server) addHandler(pattern string, fn HandlerFunc, once bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, &handler{pattern: regexp.MustCompile(pattern), fn: fn, once: once})
+}
+
+// replyFunc returns the handler writing the reply.
+func replyFunc(reply Reply) HandlerFunc {
+	return func(exec *Exec) int {
+		_, _ = io.WriteString(exec.Stdout, reply.Stdout)
+		_, _ = io.WriteString(exec.Stderr, reply.Stderr)
+		return reply.ExitCode
+	}
+}
+
+// Commands returns the scripts of the received commands in order, the file transfers excluded.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Received returns the number of received commands matching the pattern.
+func (s *Server) Received(pattern string) int {
+	re := regexp.MustCompile(pattern)
+	count := 0
+	for _, command := range s.Commands() {
+		if re.MatchString(command) {
+			count++
+		}
+	}
+	return count
+}
+
+// AssertCommands checks the server received commands matching the patterns in this order,
+// other commands may run in between.
+func (s *Server) AssertCommands(t testing.TB, patterns ...string) bool {
+	t.Helper()
+	commands := s.Commands()
+	next := 0
+	for _, pattern := range patterns {
+		re := regexp.MustCompile(pattern)
+		for next < len(commands) && !re.MatchString(commands[next]) {
+			next++
+		}
+		if next == len(commands) {
+			t.Errorf("no command matching %q in order, received:\n%s", pattern, strings.Join(commands, "\n---\n"))
+			return false
+		}
+		next++
+	}
+	return true
+}
+
+// AssertNotReceived checks no received command matches the pattern.
+func (s *Server) AssertNotReceived(t testing.TB, pattern string) bool {
+	t.Helper()
+	if count := s.Received(pattern); count > 0 {
+		t.Errorf("received %d commands matching %q", count, pattern)
+		return false
+	}
+	return true
+}
+
+// Files returns the uploaded files by their lower cased Windows path.
+func (s *Server) Files() map[string][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make(map[string][]byte, len(s.files))
+	for name, content := range s.files {
+		files[name] = content
 	}
-	go acceptConnection(listener, config, expected)
+	return files
 }
 
-func acceptConnection(listener net.Listener, config *ssh.ServerConfig, responses *[]Response) {
+// File returns the content of an uploaded file.
+func (s *Server) File(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.files[windowsPath(name)]
+	return content, ok
+}
+
+// PutFile stores a file served by the downloads.
+func (s *Server) PutFile(name string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[windowsPath(name)] = content
+}
+
+// RemoveFile deletes a file, it reports whether the file existed.
+func (s *Server) RemoveFile(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.files[windowsPath(name)]
+	delete(s.files, windowsPath(name))
+	return ok
+}
+
+// Mkdir creates a directory.
+func (s *Server) Mkdir(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirs[windowsPath(name)] = true
+}
+
+// Exists reports whether the path is a file or a directory.
+func (s *Server) Exists(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.files[windowsPath(name)]
+	return ok || s.isDir(windowsPath(name))
+}
+
+// Close stops the listener and the open connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
 	for {
-		conn, err := listener.Accept()
+		conn, err := s.listener.Accept()
 		if err != nil {
-			log.Fatal("failed to accept conn: ", err)
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+}
+
+// serve handles the channels of one connection concurrently.
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
 		}
-		_, channels, _, err := ssh.NewServerConn(conn, config)
+		channel, requests, err := newChannel.Accept()
 		if err != nil {
-			log.Fatal("failed to handshake: ", err)
+			continue
 		}
+		s.wg.Add(1)
+		go s.session(channel, requests)
+	}
+}
 
-		for channel := range channels {
-			channel, requests, err := channel.Accept() // accept channel
-			if err != nil {
-				log.Fatalf("error accepting channel: %v", err)
-			}
-			go handleRequest(requests, channel)
-			t := term.NewTerminal(channel, "")
-			resp, err := PopResponse(responses)
-			if err != nil {
-				stderr := channel.Stderr()
-				_, _ = fmt.Fprintf(stderr, "%v", err)
+// session runs the exec or sftp subsystem request of a session.
+func (s *Server) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer s.wg.Done()
+	defer channel.Close() // nolint
+	for req := range requests {
+		switch req.Type {
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				_ = req.Reply(false, nil)
+				return
 			}
-			_, err = channel.Write([]byte(resp))
-			if err != nil {
-				log.Fatalf("error writing channel: %v", err)
+			_ = req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			status := s.exec(payload.Command, channel)
+			_ = channel.CloseWrite()
+			_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			return
+		case "subsystem":
+			var payload struct{ Name string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil || payload.Name != "sftp" {
+				_ = req.Reply(false, nil)
+				continue
 			}
-			t.ReadLine()    // nolint
-			channel.Close() // nolint
+			_ = req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			s.serveSFTP(channel)
+			return
+		default:
+			_ = req.Reply(req.Type == "env", nil)
 		}
 	}
 }
 
-func PopResponse(responses *[]Response) (string, error) {
-	var resp Response
-	resp, *responses = (*responses)[0], (*responses)[1:]
-	return resp.Response, resp.Error
+// exec answers a command, the scp transfers and their scripts are handled by the server.
+func (s *Server) exec(command string, channel ssh.Channel) int {
+	if scp := scpCommand.FindStringSubmatch(command); scp != nil {
+		return s.scp(scp, channel)
+	}
+
+	exec := &Exec{Command: command, Script: s.script(command), Stdin: channel, Stdout: channel, Stderr: channel.Stderr()}
+	if code, ok := s.scpScript(exec.Script); ok {
+		return code
+	}
+	s.mu.Lock()
+	s.commands = append(s.commands, exec.Script)
+	fn := s.fallback
+	for _, h := range s.handlers {
+		if !h.used && h.pattern.MatchString(exec.Script) {
+			h.used = h.once
+			fn = h.fn
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if fn == nil {
+		_, _ = fmt.Fprintf(exec.Stderr, "no handler for command: %s", exec.Script)
+		return 127
+	}
+	return fn(exec)
 }
 
-func handleRequest(in <-chan *ssh.Request, channel ssh.Channel) {
-	for req := range in {
-		switch req.Type {
-		case "exec":
-			channel.SendRequest("exit-status", false, []byte{0, 0, 0, 0}) // nolint
+// script returns the PowerShell script sent in the command.
+func (s *Server) script(command string) string {
+	if match := encodedCommand.FindStringSubmatch(command); match != nil {
+		if script, err := DecodeCommand(match[1]); err == nil {
+			return script
+		}
+	}
+	if match := fileCommand.FindStringSubmatch(command); match != nil {
+		if content, ok := s.File(match[1]); ok {
+			return strings.TrimPrefix(string(content), "\ufeff")
 		}
-		req.Reply(req.Type == "exec", nil) // nolint
 	}
+	return command
+}
+
+// DecodeCommand returns the script of a UTF-16LE base64 -EncodedCommand.
+func DecodeCommand(encoded string) (string, error) {
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	codes := make([]uint16, len(buf)/2)
+	for i := range codes {
+		codes[i] = binary.LittleEndian.Uint16(buf[i*2:])
+	}
+	return string(utf16.Decode(codes)), nil
+}
+
+// windowsPath returns the file key of a Windows or SFTP path, like c:\k\kubelet.exe,
+// lower cased since Windows paths are case-insensitive.
+func windowsPath(name string) string {
+	if len(name) > 2 && name[0] == '/' && name[2] == ':' {
+		name = name[1:]
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.ReplaceAll(name, "/", "\\"), "\\"))
 }
 
 func passwordCallback(meta ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
@@ -128,13 +447,6 @@ func passwordCallback(meta ssh.ConnMetadata, pass []byte) (*ssh.Permissions, err
 	return nil, fmt.Errorf("invalid password")
 }
 
-func GetHostname(port int) string {
-	if port == 0 {
-		port = 2022
-	}
-	return fmt.Sprintf("%s:%d", "127.0.0.1", port)
-}
-
 func parsePrivateKey(config *ssh.ServerConfig, key []byte) (err error) {
 	var signer ssh.Signer
 	signer, err = ssh.ParsePrivateKey(key)
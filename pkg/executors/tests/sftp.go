@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+var driveRoot = regexp.MustCompile(`^[A-Za-z]:$`)
+
+// serveSFTP serves the SFTP subsystem backed by the server files.
+func (s *Server) serveSFTP(channel io.ReadWriteCloser) {
+	fs := &memFS{server: s}
+	handlers := sftp.Handlers{FileGet: fs, FilePut: fs, FileCmd: fs, FileList: fs}
+	server := sftp.NewRequestServer(channel, handlers)
+	_ = server.Serve()
+	_ = server.Close()
+}
+
+// memFS implements the SFTP request handlers on the server files, the paths are
+// stored by their Windows form.
+type memFS struct {
+	server *Server
+}
+
+func (fs *memFS) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	content, ok := fs.server.File(r.Filepath)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return bytes.NewReader(content), nil
+}
+
+func (fs *memFS) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return &memFile{server: fs.server, name: r.Filepath}, nil
+}
+
+func (fs *memFS) Filecmd(r *sftp.Request) error {
+	s := fs.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := windowsPath(r.Filepath)
+	switch r.Method {
+	case "Setstat":
+		return nil
+	case "Mkdir":
+		s.dirs[name] = true
+		return nil
+	case "Rmdir":
+		delete(s.dirs, name)
+		return nil
+	case "Remove":
+		if _, ok := s.files[name]; !ok {
+			return os.ErrNotExist
+		}
+		delete(s.files, name)
+		return nil
+	case "Rename", "PosixRename":
+		content, ok := s.files[name]
+		if !ok {
+			return os.ErrNotExist
+		}
+		target := windowsPath(r.Target)
+		if _, exists := s.files[target]; exists && r.Method == "Rename" {
+			return os.ErrExist
+		}
+		s.files[target] = content
+		delete(s.files, name)
+		return nil
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (fs *memFS) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	s := fs.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := windowsPath(r.Filepath)
+	switch r.Method {
+	case "Stat":
+		if content, ok := s.files[name]; ok {
+			return lister{&memInfo{name: path.Base(r.Filepath), size: int64(len(content))}}, nil
+		}
+		if s.isDir(name) {
+			return lister{&memInfo{name: path.Base(r.Filepath), dir: true}}, nil
+		}
+		return nil, os.ErrNotExist
+	case "List":
+		var infos lister
+		for file, content := range s.files {
+			if strings.HasPrefix(file, name+"\\") && !strings.Contains(file[len(name)+1:], "\\") {
+				infos = append(infos, &memInfo{name: file[len(name)+1:], size: int64(len(content))})
+			}
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+		return infos, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// isDir reports whether the path is a root, a created directory or the parent of a file.
+func (s *Server) isDir(name string) bool {
+	if name == "" || driveRoot.MatchString(name) || s.dirs[name] {
+		return true
+	}
+	for file := range s.files {
+		if strings.HasPrefix(file, name+"\\") {
+			return true
+		}
+	}
+	return false
+}
+
+// memFile buffers an uploaded file, stored when closed.
+type memFile struct {
+	mu      sync.Mutex
+	server  *Server
+	name    string
+	content []byte
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if end := int(off) + len(p); end > len(f.content) {
+		f.content = append(f.content, make([]byte, end-len(f.content))...)
+	}
+	copy(f.content[off:], p)
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.server.PutFile(f.name, f.content)
+	return nil
+}
+
+type lister []os.FileInfo
+
+func (l lister) ListAt(infos []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(infos, l[offset:])
+	if n < len(infos) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+type memInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) ModTime() time.Time { return time.Time{} }
+func (i *memInfo) IsDir() bool        { return i.dir }
+func (i *memInfo) Sys() interface{}   { return nil }
+func (i *memInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
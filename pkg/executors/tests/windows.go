@@ -0,0 +1,449 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	// errorMarker prefixes the ErrorRecord written in stderr by the strict script
+	// wrapper, it mirrors the exec package constant.
+	errorMarker = "#SWDT-ERROR#"
+
+	// ChocoPath is the Chocolatey binary created by its installer.
+	ChocoPath = `C:\ProgramData\chocolatey\bin\choco.exe`
+	// HomePath is the working directory of the SSH commands.
+	HomePath = `C:\Users\Administrator`
+	// RDPKey is the registry value disabling the Remote Desktop connections.
+	RDPKey = `HKLM:\System\CurrentControlSet\Control\Terminal Server\fDenyTSConnections`
+
+	ServiceRunning = "Running"
+	ServiceStopped = "Stopped"
+)
+
+// psError is a PowerShell ErrorRecord serialized like the strict script wrapper does.
+type psError struct {
+	Category  string `json:"category"`
+	Message   string `json:"message"`
+	ErrorID   string `json:"errorId"`
+	Line      int    `json:"line"`
+	Statement string `json:"statement"`
+	exitCode  int
+}
+
+// command is a statement of a script run against the host state.
+type command struct {
+	pattern *regexp.Regexp
+	run     func(h *WindowsHost, match []string, stdout io.Writer) *psError
+}
+
+// WindowsHost is a fake Windows node on the scripted SSH server. It tracks services,
+// files, Chocolatey packages, registry values and firewall rules, and answers the
+// PowerShell statements emitted by the runners. Handlers registered on the server
+// take precedence over the simulation.
+type WindowsHost struct {
+	*Server
+
+	mu       sync.Mutex
+	services map[string]string
+	packages map[string]string
+	registry map[string]string
+	firewall map[string]bool
+	joined   string // control plane endpoint joined by kubeadm
+}
+
+// NewWindowsHost starts a fake Windows node closed at the end of the test, with
+// Remote Desktop disabled and nothing installed.
+func NewWindowsHost(t testing.TB) *WindowsHost {
+	h := &WindowsHost{
+		Server:   NewServer(t),
+		services: map[string]string{},
+		packages: map[string]string{},
+		registry: map[string]string{strings.ToLower(RDPKey): "1"},
+		firewall: map[string]bool{},
+	}
+	h.Fallback(h.exec)
+	return h
+}
+
+// SetService creates or updates a service with the status.
+func (h *WindowsHost) SetService(name, status string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.services[strings.ToLower(name)] = status
+}
+
+// Service returns the status of a service.
+func (h *WindowsHost) Service(name string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status, ok := h.services[strings.ToLower(name)]
+	return status, ok
+}
+
+// Packages returns the installed Chocolatey packages.
+func (h *WindowsHost) Packages() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	packages := make([]string, 0, len(h.packages))
+	for name := range h.packages {
+		packages = append(packages, name)
+	}
+	sort.Strings(packages)
+	return packages
+}
+
+// InstallChoco creates the Chocolatey binary.
+func (h *WindowsHost) InstallChoco() {
+	h.PutFile(ChocoPath, []byte("choco"))
+}
+
+// SetRegistry sets a registry value, the key is the item path followed by the property name.
+func (h *WindowsHost) SetRegistry(key, value string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.registry[strings.ToLower(key)] = value
+}
+
+// Registry returns a registry value.
+func (h *WindowsHost) Registry(key string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	value, ok := h.registry[strings.ToLower(key)]
+	return value, ok
+}
+
+// FirewallEnabled reports whether the firewall rules of the display group are enabled.
+func (h *WindowsHost) FirewallEnabled(group string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.firewall[strings.ToLower(group)]
+}
+
+// Joined returns the control plane endpoint joined by kubeadm, empty when not joined.
+func (h *WindowsHost) Joined() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.joined
+}
+
+// exec runs the statements of the script in order, stopping on the first error
+// like the strict wrapper does.
+func (h *WindowsHost) exec(exec *Exec) int {
+	for _, statement := range parseScript(exec.Script) {
+		err := h.run(statement.text, exec.Stdout)
+		if err == nil {
+			continue
+		}
+		if err.exitCode > 0 {
+			_, _ = fmt.Fprintln(exec.Stderr, err.Message)
+			return err.exitCode
+		}
+		err.Line, err.Statement = statement.line, statement.text
+		record, _ := json.Marshal(err)
+		_, _ = fmt.Fprintf(exec.Stderr, "%s%s\n", errorMarker, record)
+		return 1
+	}
+	return 0
+}
+
+// run answers a single statement.
+func (h *WindowsHost) run(statement string, stdout io.Writer) *psError {
+	for _, cmd := range commands {
+		if match := cmd.pattern.FindStringSubmatch(statement); match != nil {
+			return cmd.run(h, match, stdout)
+		}
+	}
+	name := strings.Fields(statement)[0]
+	return &psError{
+		Category: "ObjectNotFound",
+		Message:  fmt.Sprintf("The term '%s' is not recognized as the name of a cmdlet, function, script file, or operable program.", name),
+		ErrorID:  "CommandNotFoundException",
+	}
+}
+
+func pathNotFound(name string) *psError {
+	return &psError{
+		Category: "ObjectNotFound",
+		Message:  fmt.Sprintf("Cannot find path '%s' because it does not exist.", name),
+		ErrorID:  "PathNotFound",
+	}
+}
+
+func serviceNotFound(name string) *psError {
+	return &psError{
+		Category: "ObjectNotFound",
+		Message:  fmt.Sprintf("Cannot find any service with service name '%s'.", name),
+		ErrorID:  "NoServiceFoundForGivenName",
+	}
+}
+
+// unquote returns the value of a PowerShell string literal, or the bare word.
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	return strings.Trim(value, `"`)
+}
+
+// homeFile returns the path of a file relative to the SSH working directory.
+func homeFile(name string) string {
+	return HomePath + `\` + strings.TrimPrefix(name, `.\`)
+}
+
+// setService changes the status of an existing service.
+func (h *WindowsHost) setService(name, status string) *psError {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.services[strings.ToLower(name)]; !ok {
+		return serviceNotFound(name)
+	}
+	h.services[strings.ToLower(name)] = status
+	return nil
+}
+
+// installer returns the command running a downloaded installer script.
+func installer(script string, install func(h *WindowsHost, version string)) command {
+	pattern := regexp.MustCompile(`(?i)^\.\\` + regexp.QuoteMeta(script) + ` -\w+ (\S+)$`)
+	return command{pattern, func(h *WindowsHost, m []string, stdout io.Writer) *psError {
+		if _, ok := h.File(homeFile(script)); !ok {
+			return &psError{
+				Category: "ObjectNotFound",
+				Message:  fmt.Sprintf("The term '.\\%s' is not recognized as the name of a cmdlet, function, script file, or operable program.", script),
+				ErrorID:  "CommandNotFoundException",
+			}
+		}
+		install(h, m[1])
+		_, _ = fmt.Fprintf(stdout, "%s %s completed\n", script, m[1])
+		return nil
+	}}
+}
+
+// commands are the statements understood by the host, matched in order.
+var commands = []command{
+	{regexp.MustCompile(`(?i)^Set-ExecutionPolicy\b`), func(*WindowsHost, []string, io.Writer) *psError { return nil }},
+	{regexp.MustCompile(`(?i)^\[System\.Net\.ServicePointManager\]::SecurityProtocol\s*=`), func(*WindowsHost, []string, io.Writer) *psError { return nil }},
+	{regexp.MustCompile(`(?i)^\$env:Path \+= `), func(*WindowsHost, []string, io.Writer) *psError { return nil }},
+	{regexp.MustCompile(`(?i)^iex .*community\.chocolatey\.org/install\.ps1`), func(h *WindowsHost, _ []string, stdout io.Writer) *psError {
+		h.InstallChoco()
+		_, _ = fmt.Fprintln(stdout, "Chocolatey (choco.exe) is now ready.")
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^(?:& )?` + regexp.QuoteMeta(ChocoPath) + `\s+(.*)$`), func(h *WindowsHost, m []string, stdout io.Writer) *psError {
+		if _, ok := h.File(ChocoPath); !ok {
+			return &psError{
+				Category: "ObjectNotFound",
+				Message:  fmt.Sprintf("The term '%s' is not recognized as the name of a cmdlet, function, script file, or operable program.", ChocoPath),
+				ErrorID:  "CommandNotFoundException",
+			}
+		}
+		args := strings.Fields(m[1])
+		switch {
+		case len(args) == 1 && args[0] == "--version":
+			_, _ = fmt.Fprintln(stdout, "2.2.2")
+		case len(args) > 0 && args[0] == "install":
+			name := args[len(args)-1]
+			h.mu.Lock()
+			h.packages[name] = "latest"
+			h.mu.Unlock()
+			_, _ = fmt.Fprintf(stdout, "Chocolatey installed 1/1 packages.\n")
+		default:
+			return &psError{Message: fmt.Sprintf("unsupported choco arguments %q", m[1]), exitCode: 1}
+		}
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^Set-ItemProperty -Path ('[^']*'|\S+) -name ('[^']*'|\S+) -value (\S+)$`), func(h *WindowsHost, m []string, _ io.Writer) *psError {
+		h.SetRegistry(unquote(m[1])+`\`+unquote(m[2]), unquote(m[3]))
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^Enable-NetFirewallRule -DisplayGroup ('[^']*'|\S+)$`), func(h *WindowsHost, m []string, _ io.Writer) *psError {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.firewall[strings.ToLower(unquote(m[1]))] = true
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^get-service -name (\S+)$`), func(h *WindowsHost, m []string, stdout io.Writer) *psError {
+		name := unquote(m[1])
+		status, ok := h.Service(name)
+		if !ok {
+			return serviceNotFound(name)
+		}
+		_, _ = fmt.Fprintf(stdout, "\nStatus   Name               DisplayName\n------   ----               -----------\n%-8s %-18s %s\n", status, name, name)
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^\(Get-Service -Name (\S+) -ErrorAction Stop\)\.Status\.ToString\(\)$`), func(h *WindowsHost, m []string, stdout io.Writer) *psError {
+		name := unquote(m[1])
+		status, ok := h.Service(name)
+		if !ok {
+			return serviceNotFound(name)
+		}
+		_, _ = fmt.Fprintln(stdout, status)
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^Stop-Service -Name (\S+)(?: -Force)?$`), func(h *WindowsHost, m []string, _ io.Writer) *psError {
+		return h.setService(unquote(m[1]), ServiceStopped)
+	}},
+	{regexp.MustCompile(`(?i)^Start-Service -Name (\S+)$`), func(h *WindowsHost, m []string, _ io.Writer) *psError {
+		return h.setService(unquote(m[1]), ServiceRunning)
+	}},
+	{regexp.MustCompile(`(?i)^curl\.exe -LO (\S+)$`), func(h *WindowsHost, m []string, _ io.Writer) *psError {
+		h.PutFile(homeFile(path.Base(m[1])), []byte(m[1]))
+		return nil
+	}},
+	installer("Install-Containerd.ps1", func(h *WindowsHost, version string) {
+		h.PutFile(`C:\Program Files\containerd\containerd.exe`, []byte("containerd "+version))
+		h.SetService("containerd", ServiceRunning)
+	}),
+	installer("PrepareNode.ps1", func(h *WindowsHost, version string) {
+		h.PutFile(`C:\k\kubelet.exe`, []byte("kubelet "+version))
+		h.SetService("kubelet", ServiceStopped)
+	}),
+	{regexp.MustCompile(`(?i)^mkdir (\S+)(?: -Force)?$`), func(h *WindowsHost, m []string, _ io.Writer) *psError {
+		h.Mkdir(unquote(m[1]))
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^Add-Content -Path (\S+) -Value (.*)$`), func(h *WindowsHost, m []string, _ io.Writer) *psError {
+		name := unquote(m[1])
+		content, _ := h.File(name)
+		h.PutFile(name, append(content, []byte(unquote(m[2])+"\r\n")...))
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^(?:cp|Copy-Item) (\S+) (\S+)$`), func(h *WindowsHost, m []string, _ io.Writer) *psError {
+		source, destination := unquote(m[1]), unquote(m[2])
+		content, ok := h.File(source)
+		if !ok {
+			return pathNotFound(source)
+		}
+		h.PutFile(destination, content)
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^Test-Path (?:-LiteralPath )?('[^']*'|\S+)$`), func(h *WindowsHost, m []string, stdout io.Writer) *psError {
+		if h.Exists(unquote(m[1])) {
+			_, _ = fmt.Fprintln(stdout, "True")
+		} else {
+			_, _ = fmt.Fprintln(stdout, "False")
+		}
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^\(Get-FileHash -Algorithm SHA256 -LiteralPath ('[^']*'|\S+)\)\.Hash$`), func(h *WindowsHost, m []string, stdout io.Writer) *psError {
+		name := unquote(m[1])
+		content, ok := h.File(name)
+		if !ok {
+			return pathNotFound(name)
+		}
+		hash := sha256.Sum256(content)
+		_, _ = fmt.Fprintln(stdout, strings.ToUpper(hex.EncodeToString(hash[:])))
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^Remove-Item -Force -LiteralPath ('[^']*'|\S+)$`), func(h *WindowsHost, m []string, _ io.Writer) *psError {
+		if name := unquote(m[1]); !h.RemoveFile(name) {
+			return pathNotFound(name)
+		}
+		return nil
+	}},
+	{regexp.MustCompile(`(?i)^kubeadm join (\S+) .*$`), func(h *WindowsHost, m []string, stdout io.Writer) *psError {
+		if _, ok := h.Service("kubelet"); !ok {
+			return &psError{Message: "error execution phase kubelet-start: kubelet service not found", exitCode: 1}
+		}
+		h.SetService("kubelet", ServiceRunning)
+		h.PutFile(`C:\etc\kubernetes\pki\ca.crt`, []byte("ca"))
+		h.mu.Lock()
+		h.joined = m[1]
+		h.mu.Unlock()
+		_, _ = fmt.Fprintln(stdout, "This node has joined the cluster.")
+		return nil
+	}},
+}
+
+// statement is a statement of a script with its line in the script.
+type statement struct {
+	text string
+	line int
+}
+
+// parseScript returns the statements of the user script inside the strict wrapper,
+// with the named parameters substituted.
+func parseScript(script string) []statement {
+	body, start := script, 0
+	if i := strings.Index(script, "try {\n"); i >= 0 {
+		start = i + len("try {\n")
+		end := strings.LastIndex(script, "\n} catch {")
+		if end < start {
+			end = len(script)
+		}
+		body = script[start:end]
+	}
+
+	params := map[string]string{}
+	if strings.HasPrefix(body, "$swdtParams = @{\n") {
+		i := strings.Index(body, "}\n& {\n")
+		for _, line := range strings.Split(body[len("$swdtParams = @{\n"):i], "\n") {
+			if name, value, ok := strings.Cut(strings.TrimSpace(line), " = "); ok {
+				params[unquote(name)] = unquote(value)
+			}
+		}
+		start += i + len("}\n& {\n")
+		body = strings.TrimSuffix(body[i+len("}\n& {\n"):], "\n} @swdtParams")
+	} else if strings.HasPrefix(body, "& {\n") || strings.HasPrefix(body, ". {\n") {
+		start += len("& {\n")
+		body = strings.TrimSuffix(body[len("& {\n"):], "\n}")
+	}
+	if match := paramBlock.FindStringIndex(body); match != nil {
+		start += match[1]
+		body = body[match[1]:]
+	}
+
+	var statements []statement
+	for _, s := range splitStatements(body) {
+		text := strings.TrimSpace(s.text)
+		if text == "" {
+			continue
+		}
+		for name, value := range params {
+			text = strings.ReplaceAll(text, "$"+name, value)
+		}
+		statements = append(statements, statement{text: text, line: strings.Count(script[:start+s.line], "\n") + 1})
+	}
+	return statements
+}
+
+var paramBlock = regexp.MustCompile(`(?i)^\s*param\([^)]*\)\s*`)
+
+// splitStatements splits the script on the semicolons and new lines outside of quotes
+// and brackets, the line field holds the offset of the statement.
+func splitStatements(script string) []statement {
+	var (
+		statements []statement
+		quote      byte
+		depth      int
+		begin      int
+	)
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(' || c == '{' || c == '[':
+			depth++
+		case c == ')' || c == '}' || c == ']':
+			depth--
+		case depth == 0 && (c == ';' || c == '\n'):
+			statements = append(statements, statement{text: script[begin:i], line: begin})
+			begin = i + 1
+		}
+	}
+	return append(statements, statement{text: script[begin:], line: begin})
+}
@@ -6,6 +6,7 @@ import (
 	"swdt/pkg/executors/iface"
 	"swdt/pkg/pwsh/kubernetes"
 	"swdt/pkg/pwsh/setup"
+	"swdt/pkg/pwsh/status"
 )
 
 type Runner[R RunnerInterface] struct {
@@ -13,18 +14,29 @@ type Runner[R RunnerInterface] struct {
 }
 
 type RunnerInterface interface {
-	*setup.Runner | *kubernetes.Runner
-	SetLocal(executor iface.Executor)
+	*setup.Runner | *kubernetes.Runner | *status.Runner
+	SetLocal(executor iface.LocalExecutor)
 	SetRemote(executor iface.SSHExecutor)
 }
 
 // NewRunner returns the encapsulated picked runner and sets its executors
 func NewRunner[R RunnerInterface](ssh *v1alpha1.SSHSpec, run R) (*Runner[R], error) {
-	var sshExec = exec.NewSSHExecutor(ssh) // Start SSH Connection
-	run.SetRemote(sshExec)
-	run.SetLocal(exec.NewLocalExecutor()) // Start Local executor
-	if err := sshExec.Connect(); err != nil {
+	return NewRunnerWithExecutors(exec.NewRemoteExecutor(ssh), exec.NewLocalExecutor(), run)
+}
+
+// NewRunnerWithExecutors returns the picked runner using the executors, connecting the remote one
+func NewRunnerWithExecutors[R RunnerInterface](remote iface.SSHExecutor, local iface.LocalExecutor, run R) (*Runner[R], error) {
+	run.SetRemote(remote)
+	run.SetLocal(local)
+	if err := remote.Connect(); err != nil {
 		return nil, err
 	}
 	return &Runner[R]{Inner: run}, nil
 }
+
+// NewDryRunner returns the picked runner with executors recording its actions in the plan.
+func NewDryRunner[R RunnerInterface](plan *exec.Plan, run R, results ...exec.Result) *Runner[R] {
+	run.SetRemote(exec.NewDryRunExecutor(plan, results...))
+	run.SetLocal(exec.NewDryRunLocalExecutor(plan, results...))
+	return &Runner[R]{Inner: run}
+}
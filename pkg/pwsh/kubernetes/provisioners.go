@@ -1,11 +1,15 @@
 package kubernetes
 
 import (
+	"errors"
 	"fmt"
 	"github.com/fatih/color"
 	klog "k8s.io/klog/v2"
+	"path/filepath"
+	"strings"
 	"swdt/apis/config/v1alpha1"
 	"swdt/pkg/executors/iface"
+	"sync"
 )
 
 var (
@@ -15,10 +19,14 @@ var (
 
 type Runner struct {
 	remote iface.SSHExecutor
-	local  iface.Executor
+	local  iface.LocalExecutor
+
+	// Shares are the host directories mounted on the node, the provisioners under
+	// them are copied from the drive instead of over SSH.
+	Shares []v1alpha1.ShareSpec
 }
 
-func (r *Runner) SetLocal(executor iface.Executor) {
+func (r *Runner) SetLocal(executor iface.LocalExecutor) {
 	r.local = executor
 }
 
@@ -27,47 +35,93 @@ func (r *Runner) SetRemote(executor iface.SSHExecutor) {
 }
 
 // runL runs a local command using the local executor
-func (r *Runner) runL(args string) error {
-	return r.local.Run(args, nil)
-}
-
-// runLstd runs a local command using the local executor
-func (r *Runner) runLstd(args string, stdout *chan string) error {
-	return r.local.Run(args, stdout)
+func (r *Runner) runL(args ...string) error {
+	return r.local.Run(iface.NewCommand(args[0], args[1:]...), iface.Streams{})
 }
 
-// runR runs a local command using the local executor
+// runR runs a remote script using the SSH executor
 func (r *Runner) runR(args string) error {
-	return r.remote.Run(args, nil)
+	return r.remote.Run(args, iface.Streams{})
 }
 
-// runRstdout runs a local command using the local executor
-func (r *Runner) runRstd(args string, stdout *chan string) error {
-	return r.remote.Run(args, stdout)
+// runRparams runs a remote script binding the named parameters
+func (r *Runner) runRparams(script string, params map[string]string) error {
+	return r.remote.RunWithParams(script, params, iface.Streams{})
 }
 
+// InstallProvisioners replaces the service binaries. The provisioners of a service
+// are installed in order, the services in parallel over the same connection.
 func (r *Runner) InstallProvisioners(provisioners []v1alpha1.ProvisionerSpec) error {
+	var (
+		services []string
+		groups   = map[string][]v1alpha1.ProvisionerSpec{}
+	)
 	for _, provisioner := range provisioners {
-		source, destination := provisioner.SourceURL, provisioner.Destination
-		name := provisioner.Name
-		klog.Info(resc.Sprintf("Service %s binary replacement, trying to stop service...", name))
-		err := r.runR(fmt.Sprintf("Stop-Service -name %s -Force", name))
-		if err != nil {
-			klog.Error(err)
-			continue
+		if _, ok := groups[provisioner.Name]; !ok {
+			services = append(services, provisioner.Name)
 		}
-		klog.Infof("Service stopped. Copying file %s to remote %s...", source, destination)
-		/*if err = (*r.remote).Copy(source, destination, permission); err != nil {
-			klog.Error(err)
-			continue
-		}*/
-		klog.Infof("starting service %s again...", name)
-		err = r.runR(fmt.Sprintf("Start-Service -name %s", name))
-		if err != nil {
-			klog.Error(err)
+		groups[provisioner.Name] = append(groups[provisioner.Name], provisioner)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, service := range services {
+		wg.Add(1)
+		go func(group []v1alpha1.ProvisionerSpec) {
+			defer wg.Done()
+			for _, provisioner := range group {
+				if err := r.installProvisioner(provisioner); err != nil {
+					klog.Error(err)
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}(groups[service])
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// installProvisioner stops the service, copies the binary and starts it again.
+func (r *Runner) installProvisioner(provisioner v1alpha1.ProvisionerSpec) error {
+	source, destination := provisioner.SourceURL, provisioner.Destination
+	name := provisioner.Name
+	klog.Info(resc.Sprintf("Service %s binary replacement, trying to stop service...", name))
+	err := r.runRparams("param($Name) Stop-Service -Name $Name -Force", map[string]string{"Name": name})
+	if err != nil {
+		return fmt.Errorf("failed stopping service %s: %w", name, err)
+	}
+	klog.Infof("Service stopped. Copying file %s to remote %s...", source, destination)
+	if shared, ok := r.sharedPath(source); ok {
+		err = r.runRparams("param($Source, $Destination) Copy-Item -Path $Source -Destination $Destination -Force",
+			map[string]string{"Source": shared, "Destination": destination})
+	} else {
+		err = r.remote.Copy(source, destination, permission)
+	}
+	if err != nil {
+		return fmt.Errorf("failed copying %s of service %s: %w", source, name, err)
+	}
+	klog.Infof("starting service %s again...", name)
+	err = r.runRparams("param($Name) Start-Service -Name $Name", map[string]string{"Name": name})
+	if err != nil {
+		return fmt.Errorf("failed starting service %s: %w", name, err)
+	}
+	klog.Info(resc.Sprintf("Service %s started.\n", name))
+	return nil
+}
+
+// sharedPath returns the path on the node of the host file when it is under a share.
+func (r *Runner) sharedPath(source string) (string, bool) {
+	for _, share := range r.Shares {
+		rel, err := filepath.Rel(share.HostPath, source)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
 			continue
 		}
-		klog.Info(resc.Sprintf("Service started.\n"))
+		return share.DriveLetter + ":\\" + strings.ReplaceAll(rel, "/", "\\"), true
 	}
-	return nil
+	return "", false
 }
@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"os"
+	"path/filepath"
+	"swdt/apis/config/v1alpha1"
+	"swdt/pkg/executors/exec"
+	"swdt/pkg/executors/tests"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startReplay returns a runner answering the commands from the cassette, regenerate
+// it from a real node with `swdt kubernetes --record <file>`.
+func startReplay(t *testing.T, file string) (*Runner, *exec.Cassette) {
+	cassette, err := exec.LoadCassette(file)
+	assert.Nil(t, err)
+	return &Runner{remote: exec.NewReplayingExecutor(cassette), local: exec.NewReplayingLocalExecutor(cassette)}, cassette
+}
+
+func TestInstallProvisioners(t *testing.T) {
+	r, cassette := startReplay(t, "testdata/provisioners.yaml")
+	err := r.InstallProvisioners([]v1alpha1.ProvisionerSpec{
+		{
+			Name:        "containerd",
+			SourceURL:   "/home/user/containerd/bin/containerd",
+			Destination: "C:\\Program Files\\containerd\\containerd.exe",
+		},
+		{
+			// kubelet is not installed, the stop fails and the copy is skipped
+			Name:        "kubelet",
+			SourceURL:   "/home/user/kubernetes/kubelet.exe",
+			Destination: "C:\\k\\kubelet.exe",
+		},
+	})
+	assert.ErrorContains(t, err, "failed stopping service kubelet")
+	assert.Empty(t, cassette.Pending())
+}
+
+func TestInstallProvisionersWindowsHost(t *testing.T) {
+	host := tests.NewWindowsHost(t)
+	host.SetService("containerd", tests.ServiceRunning)
+	remote := exec.NewSSHExecutor(host.Credentials())
+	assert.Nil(t, remote.Connect())
+	t.Cleanup(func() { _ = remote.Close() })
+	r := &Runner{remote: remote}
+
+	dir := t.TempDir()
+	containerd, kubelet := filepath.Join(dir, "containerd"), filepath.Join(dir, "kubelet.exe")
+	assert.Nil(t, os.WriteFile(containerd, []byte("containerd dev"), 0o644))
+	assert.Nil(t, os.WriteFile(kubelet, []byte("kubelet dev"), 0o644))
+
+	err := r.InstallProvisioners([]v1alpha1.ProvisionerSpec{
+		{Name: "containerd", SourceURL: containerd, Destination: "C:\\Program Files\\containerd\\containerd.exe"},
+		{Name: "kubelet", SourceURL: kubelet, Destination: "C:\\k\\kubelet.exe"},
+	})
+	assert.ErrorContains(t, err, "failed stopping service kubelet")
+
+	content, _ := host.File("C:\\Program Files\\containerd\\containerd.exe")
+	assert.Equal(t, "containerd dev", string(content))
+	status, _ := host.Service("containerd")
+	assert.Equal(t, tests.ServiceRunning, status)
+	// kubelet is not installed, the stop fails and the copy is skipped
+	_, ok := host.File("C:\\k\\kubelet.exe")
+	assert.False(t, ok)
+	assert.Equal(t, 1, host.Received(`Start-Service`))
+}
+
+func TestInstallProvisionersFromShare(t *testing.T) {
+	server := tests.NewServer(t).Handle(`Service|Copy-Item`, tests.Reply{})
+	remote := exec.NewSSHExecutor(server.Credentials())
+	assert.Nil(t, remote.Connect())
+	t.Cleanup(func() { _ = remote.Close() })
+	r := &Runner{remote: remote, Shares: []v1alpha1.ShareSpec{{Name: "build", HostPath: "/home/user/build", DriveLetter: "S"}}}
+
+	err := r.InstallProvisioners([]v1alpha1.ProvisionerSpec{
+		{Name: "kubelet", SourceURL: "/home/user/build/bin/kubelet.exe", Destination: "C:\\k\\kubelet.exe"},
+	})
+	assert.Nil(t, err)
+	server.AssertCommands(t, `Stop-Service`,
+		`'Destination' = 'C:\\k\\kubelet\.exe'\n  'Source' = 'S:\\bin\\kubelet\.exe'`, `Start-Service`)
+}
+
+func TestInstallProvisionersSameService(t *testing.T) {
+	server := tests.NewServer(t).Handle(`Service|Copy-Item`, tests.Reply{})
+	remote := exec.NewSSHExecutor(server.Credentials())
+	assert.Nil(t, remote.Connect())
+	t.Cleanup(func() { _ = remote.Close() })
+	r := &Runner{remote: remote, Shares: []v1alpha1.ShareSpec{{Name: "build", HostPath: "/build", DriveLetter: "S"}}}
+
+	// the binaries of a service are replaced one after the other
+	err := r.InstallProvisioners([]v1alpha1.ProvisionerSpec{
+		{Name: "containerd", SourceURL: "/build/containerd.exe", Destination: "C:\\Program Files\\containerd\\containerd.exe"},
+		{Name: "containerd", SourceURL: "/build/ctr.exe", Destination: "C:\\Program Files\\containerd\\ctr.exe"},
+	})
+	assert.Nil(t, err)
+	server.AssertCommands(t, `Stop-Service`, `containerd\.exe`, `Start-Service`, `Stop-Service`, `ctr\.exe`, `Start-Service`)
+}
+
+func TestSharedPath(t *testing.T) {
+	r := &Runner{Shares: []v1alpha1.ShareSpec{{Name: "build", HostPath: "/home/user/build", DriveLetter: "S"}}}
+	path, ok := r.sharedPath("/home/user/build/bin/kubelet.exe")
+	assert.True(t, ok)
+	assert.Equal(t, `S:\bin\kubelet.exe`, path)
+	_, ok = r.sharedPath("/home/user/builds/kubelet.exe")
+	assert.False(t, ok)
+	_, ok = r.sharedPath("kubelet.exe")
+	assert.False(t, ok)
+}
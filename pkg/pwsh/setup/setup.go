@@ -1,11 +1,14 @@
 package setup
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/fatih/color"
+	"io"
 	"k8s.io/klog/v2"
+	"os"
 	"strings"
-	"swdt/pkg/executors/exec"
+	"swdt/pkg/config"
 	"swdt/pkg/executors/iface"
 	"swdt/pkg/templates"
 	"time"
@@ -26,12 +29,13 @@ const (
 )
 
 type Runner struct {
-	Logging bool // enabled verbose logging on calls (both stdout and stderr)
+	Logging bool   // enabled verbose logging on calls (both stdout and stderr)
+	Profile string // minikube profile of the control plane, also the kubectl context
 	remote  iface.SSHExecutor
-	local   iface.Executor
+	local   iface.LocalExecutor
 }
 
-func (r *Runner) SetLocal(executor iface.Executor) {
+func (r *Runner) SetLocal(executor iface.LocalExecutor) {
 	r.local = executor
 }
 
@@ -39,24 +43,51 @@ func (r *Runner) SetRemote(executor iface.SSHExecutor) {
 	r.remote = executor
 }
 
+// streams returns the writers of a command, capturing its stdout when set and
+// printing the output when logging is enabled.
+func (r *Runner) streams(capture io.Writer) iface.Streams {
+	if !r.Logging {
+		return iface.Streams{Stdout: capture}
+	}
+	if capture == nil {
+		return iface.Streams{Stdout: os.Stdout, Stderr: os.Stderr}
+	}
+	return iface.Streams{Stdout: io.MultiWriter(capture, os.Stdout), Stderr: os.Stderr}
+}
+
 // runL runs a local command using the local executor
-func (r *Runner) runL(args string) error {
-	return r.local.Run(args, nil)
+func (r *Runner) runL(args ...string) error {
+	return r.runLcmd(iface.NewCommand(args[0], args[1:]...))
+}
+
+// runLcmd runs a local command using the local executor
+func (r *Runner) runLcmd(cmd *iface.Command) error {
+	return r.local.Run(cmd, r.streams(nil))
 }
 
-// runLstd runs a local command using the local executor
-func (r *Runner) runLstd(args string, stdout *chan string) error {
-	return r.local.Run(args, stdout)
+// runLout runs a local command returning its output, the output is not printed
+// since it can carry secrets like the join token.
+func (r *Runner) runLout(args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := r.local.Run(iface.NewCommand(args[0], args[1:]...), iface.Streams{Stdout: &stdout})
+	return strings.TrimSpace(stdout.String()), err
 }
 
-// runR runs a local command using the local executor
+// runR runs a remote script using the SSH executor
 func (r *Runner) runR(args string) error {
-	return r.remote.Run(args, nil)
+	return r.remote.Run(args, r.streams(nil))
 }
 
-// runRstdout runs a local command using the local executor
-func (r *Runner) runRstd(args string, stdout *chan string) error {
-	return r.remote.Run(args, stdout)
+// runRout runs a remote script returning its output
+func (r *Runner) runRout(args string) (string, error) {
+	var stdout bytes.Buffer
+	err := r.remote.Run(args, r.streams(&stdout))
+	return strings.TrimSpace(stdout.String()), err
+}
+
+// runRparams runs a remote script binding the named parameters
+func (r *Runner) runRparams(script string, params map[string]string) error {
+	return r.remote.RunWithParams(script, params, r.streams(nil))
 }
 
 // ChocoExists check if choco is already installed in the system.
@@ -64,15 +95,15 @@ func (r *Runner) ChocoExists() bool {
 	return r.runR(fmt.Sprintf("%s --version", CHOCO_PATH)) == nil
 }
 
+// BootstrapApplied checks if the first-boot agent applied the config medium.
+func (r *Runner) BootstrapApplied() bool {
+	return r.runR(`if (-not (Test-Path (Join-Path $env:ProgramData 'swdt\applied'))) { exit 1 }`) == nil
+}
+
 // InstallChoco proceed to install choco in the default ProgramData folder.
 func (r *Runner) InstallChoco() error {
 	klog.Info(mainc.Sprint("Installing Choco with PowerShell."))
 
-	if r.Logging {
-		go exec.EnableOutput(nil, r.remote.Stdout)
-		go exec.EnableOutput(nil, r.remote.Stderr)
-	}
-
 	if r.ChocoExists() {
 		klog.Info(resc.Sprintf("Choco already exists, skipping installation..."))
 		return nil
@@ -104,11 +135,6 @@ func (r *Runner) EnableRDP(enable bool) error {
 		return nil
 	}
 
-	if r.Logging {
-		go exec.EnableOutput(nil, r.remote.Stdout)
-		go exec.EnableOutput(nil, r.remote.Stderr)
-	}
-
 	klog.Info(mainc.Sprint("Enabling Remote Desktop."))
 	return r.runR(`Set-ItemProperty -Path 'HKLM:\System\CurrentControlSet\Control\Terminal Server' -name 'fDenyTSConnections' -value 0;
 		Enable-NetFirewallRule -DisplayGroup 'Remote Desktop'`)
@@ -118,14 +144,8 @@ func (r *Runner) EnableRDP(enable bool) error {
 func (r *Runner) InstallContainerd(containerd string) error {
 	klog.Info(mainc.Sprintf("Installing containerd."))
 
-	var output string
-	if r.Logging {
-		go exec.EnableOutput(nil, r.remote.Stdout)
-		go exec.EnableOutput(nil, r.remote.Stderr)
-	}
-
 	// Install containerd if service is not running.
-	if err := r.runR("get-service -name containerd"); err != nil {
+	if output, err := r.runRout("get-service -name containerd"); err != nil {
 		cmd := fmt.Sprintf(".\\Install-Containerd.ps1 -ContainerDVersion %s", containerd)
 		return r.runR(`curl.exe -LO https://raw.githubusercontent.com/kubernetes-sigs/sig-windows-tools/master/hostprocess/Install-Containerd.ps1; ` + cmd)
 	} else if strings.Contains(output, "Running") {
@@ -138,17 +158,11 @@ func (r *Runner) InstallContainerd(containerd string) error {
 func (r *Runner) InstallKubernetes(kubernetes string) error {
 	klog.Info(mainc.Sprintf("Installing Kubelet."))
 
-	var output string
-	if r.Logging {
-		go exec.EnableOutput(nil, r.remote.Stdout)
-		go exec.EnableOutput(nil, r.remote.Stderr)
-	}
-
-	if err := r.runR("get-service -name kubelet"); err != nil {
+	if output, err := r.runRout("get-service -name kubelet"); err != nil {
 		// Install Kubernetes if service is not running.
 		cmd := fmt.Sprintf(".\\PrepareNode.ps1 -KubernetesVersion %s", kubernetes)
 		return r.runR(`curl.exe -LO https://raw.githubusercontent.com/kubernetes-sigs/sig-windows-tools/master/hostprocess/PrepareNode.ps1; ` + cmd)
-	} else if strings.Contains(output, "kubelet") { // Otherwise skip
+	} else if strings.Contains(output, "Running") { // Otherwise skip
 		klog.Info(resc.Sprintf("Skipping Kubelet installation, service already running, use the copy command."))
 	}
 	return nil
@@ -163,18 +177,11 @@ func (r *Runner) JoinNode(cpVersion, cpIPAddr string) error {
 
 	klog.Info(mainc.Sprintf("Joining the node into the cluster."))
 
-	go exec.EnableOutput(&output, r.remote.Stdout)
-	go exec.EnableOutput(&output, r.remote.Stderr)
-	go exec.EnableOutput(&loutput, r.local.Stdout)
-
 	// In case kubelet is already running, skip joining procedure.
-	if err = r.runR("get-service -name kubelet"); err == nil && !strings.Contains(output, "Running") {
-		// Control plane token create and extract, saving the final command
-		lcmd := strings.Join([]string{
-			"minikube", "ssh", "--", "sudo", fmt.Sprintf("/var/lib/minikube/binaries/%s/kubeadm", cpVersion),
-			"token", "create", "--print-join-command",
-		}, " ")
-		if err = r.runL(lcmd); err != nil {
+	if output, err = r.runRout("get-service -name kubelet"); err == nil && !strings.Contains(output, "Running") {
+		// Control plane token create and extract, saving the final command, it carries the token
+		kubeadm := fmt.Sprintf("/var/lib/minikube/binaries/%s/kubeadm", cpVersion)
+		if loutput, err = r.runLout(config.MinikubeCommand(r.Profile, "ssh", "--", "sudo", kubeadm, "token", "create", "--print-join-command")...); err != nil {
 			return err
 		}
 
@@ -183,27 +190,33 @@ func (r *Runner) JoinNode(cpVersion, cpIPAddr string) error {
 			return err
 		}
 		// Copy the control plane host value to Windows hosts
-		if err = r.runR(fmt.Sprintf(`Add-content -Path C:\\Windows\\System32\\drivers\\etc\\hosts -Value \"%s %s\"`, cpIPAddr, cpHost)); err != nil {
+		hosts := `param($Address, $Hostname)
+			Add-Content -Path C:\Windows\System32\drivers\etc\hosts -Value "$Address $Hostname"`
+		if err = r.runRparams(hosts, map[string]string{"Address": cpIPAddr, "Hostname": cpHost}); err != nil {
 			return err
 		}
 
-		// Trigger a goroutine to copy the ca.crt from kubernetes/pki to the CA folder.
+		// Trigger a goroutine to copy the ca.crt from kubernetes/pki to the CA folder,
+		// it stops when the certificate is copied or the join command returns.
+		done := make(chan struct{})
+		defer close(done)
 		go func() {
-		loop:
 			for {
 				select {
+				case <-done:
+					return
 				case <-time.After(1 * time.Second):
 					klog.Info(resc.Sprintf("trying to copy cert..."))
 					cmd := "cp c:\\etc\\kubernetes\\pki\\ca.crt c:\\var\\lib\\minikube\\certs\\ca.crt"
-					if err = r.runRstd(cmd, nil); err == nil {
-						break loop
+					if r.remote.Run(cmd, iface.Streams{}) == nil {
+						return
 					}
 				}
 			}
 		}()
 
 		// Add the control plane into hosts and start the join command.
-		return r.runR(fmt.Sprintf(`$env:Path += ';c:\\k\\'; %s`, strings.Trim(loutput, " \n")))
+		return r.runR(fmt.Sprintf(`$env:Path += ';c:\k\'; %s`, loutput))
 	}
 
 	klog.Info(resc.Sprintf("Skipping node join, the Kubelet service is already running."))
@@ -212,13 +225,8 @@ func (r *Runner) JoinNode(cpVersion, cpIPAddr string) error {
 
 // InstallCNI installs Calico CNI receiving a specific version.
 func (r *Runner) InstallCNI(calicoVersion, cpKubernetes, controlPlaneIP string) error {
-	var loutput string
-
 	klog.Info(mainc.Sprintf("Installing Calico CNI %s.", calicoVersion))
 
-	go exec.EnableOutput(&loutput, r.local.Stdout)
-	go exec.EnableOutput(&loutput, r.local.Stderr)
-
 	var (
 		err     error
 		content []byte
@@ -242,18 +250,16 @@ func (r *Runner) InstallCNI(calicoVersion, cpKubernetes, controlPlaneIP string)
 
 	// Execute Kubernetes steps for Calico installation
 	steps := [][]string{
-		{"kubectl", "config", "set-context", "minikube"},
-		{"kubectl", "create", "-f", fmt.Sprintf("https://raw.githubusercontent.com/projectcalico/calico/%v/manifests/tigera-operator.yaml", calicoVersion)},
-		{"kubectl", "create", "-f", "./specs/installation.yaml"},
-		{"kubectl", "create", "-f", cpTempFile},
-		{"kubectl", "create", "-f", kpTempFile},
-		{"kubectl", "create", "-f", "./specs/smoke-test.yaml"},
+		config.KubectlCommand(r.Profile, "create", "-f", fmt.Sprintf("https://raw.githubusercontent.com/projectcalico/calico/%v/manifests/tigera-operator.yaml", calicoVersion)),
+		config.KubectlCommand(r.Profile, "create", "-f", "./specs/installation.yaml"),
+		config.KubectlCommand(r.Profile, "create", "-f", cpTempFile),
+		config.KubectlCommand(r.Profile, "create", "-f", kpTempFile),
+		config.KubectlCommand(r.Profile, "create", "-f", "./specs/smoke-test.yaml"),
 	}
 
 	for i := 0; i <= len(steps)-1; i++ {
-		cmd := strings.Join(steps[i], " ")
-		resc.Printf("Running: %v\n", cmd)
-		if err := r.runL(cmd); err != nil {
+		cmd := iface.NewCommand(steps[i][0], steps[i][1:]...)
+		if err := r.runLcmd(cmd); err != nil {
 			bad.Printf("%v", err)
 		}
 	}
@@ -264,8 +270,9 @@ loop:
 	for {
 		select {
 		case <-time.After(10 * time.Second):
-			cmd := []string{"kubectl", "patch", "ipamconfig", "default", "--type", "merge", "--patch=" + string(templates.GetSpecAffinity())}
-			if err := r.runL(strings.Join(cmd, " ")); err != nil {
+			patch := config.KubectlCommand(r.Profile, "patch", "ipamconfig", "default", "--type", "merge", "--patch="+string(templates.GetSpecAffinity()))
+			cmd := iface.NewCommand(patch[0], patch[1:]...)
+			if err := r.runLcmd(cmd); err != nil {
 				bad.Printf("calico error: trying to apply %s - %v\n", cmd, err)
 			} else {
 				break loop
@@ -1,8 +1,8 @@
 package setup
 
 import (
-	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"regexp"
 	"swdt/apis/config/v1alpha1"
 	"swdt/pkg/executors/exec"
 	"swdt/pkg/executors/iface"
@@ -10,187 +10,198 @@ import (
 	"testing"
 )
 
-var (
-	calls []string
-	port  = 2222
-)
-
-// startServer starts a fake SSH server
-func StartServer(port int, expected *[]tests.Response) *v1alpha1.SSHSpec {
-	hostname := tests.GetHostname(port)
-	tests.NewServer(hostname, expected)
-	return &v1alpha1.SSHSpec{
-		Hostname: hostname,
-		Username: tests.Username,
-		Password: tests.FakePassword,
-	}
-}
-
-type LocalExec struct {
-	stdout *chan string
-}
+type LocalExec struct{}
 
-func (l LocalExec) Run(args string, stdout *chan string) error {
+func (l LocalExec) Run(cmd *iface.Command, streams iface.Streams) error {
 	return nil
 }
 
-func (l LocalExec) Stdout(std *chan string) {
-	l.stdout = std
-}
-
-func (l LocalExec) Stderr(std *chan string) {
-	panic("implement me")
-}
-
-func NewLocalExecutor() iface.Executor {
+func NewLocalExecutor() iface.LocalExecutor {
 	return &LocalExec{}
 }
 
-func startRunner(responses *[]tests.Response) (*Runner, error) {
-	calls = []string{}
-	credentials := StartServer(port, responses)
-	var sshExec = exec.NewSSHExecutor(credentials) // Start SSH Connection
-	if err := sshExec.Connect(); err != nil {
-		return nil, err
-	}
-	return &Runner{remote: sshExec, local: NewLocalExecutor()}, nil
+// startRunner returns a runner connected to the fake server.
+func startRunner(t *testing.T, server *tests.Server) *Runner {
+	sshExec := exec.NewSSHExecutor(server.Credentials()) // Start SSH Connection
+	assert.Nil(t, sshExec.Connect())
+	t.Cleanup(func() { _ = sshExec.Close() })
+	return &Runner{remote: sshExec, local: NewLocalExecutor()}
 }
 
 func TestChocoExist(t *testing.T) {
-	responses := &[]tests.Response{
-		{
-			Response: "v1.0",
-			Error:    nil,
-		},
-	}
-	port += 1
-	r, err := startRunner(responses)
-	assert.Nil(t, err)
+	server := tests.NewServer(t).
+		HandleOnce(`choco.exe --version`, tests.Reply{Stdout: "v1.0"}).
+		Handle(`choco.exe --version`, tests.Reply{ExitCode: 1})
+	r := startRunner(t, server)
 	assert.True(t, r.ChocoExists())
+	assert.False(t, r.ChocoExists())
+}
+
+func TestBootstrapApplied(t *testing.T) {
+	server := tests.NewServer(t).
+		HandleOnce(`swdt\\applied`, tests.Reply{}).
+		Handle(`swdt\\applied`, tests.Reply{ExitCode: 1})
+	r := startRunner(t, server)
+	assert.True(t, r.BootstrapApplied())
+	assert.False(t, r.BootstrapApplied())
 }
 
 func TestInstallChocoPackages(t *testing.T) {
-	responses := &[]tests.Response{
-		{
-			Response: "",
-			Error:    nil,
-		},
-		{
-			Response: "",
-			Error:    nil,
-		},
-		{
-			Response: "",
-			Error:    nil,
-		},
-	}
-	port += 1
-	r, err := startRunner(responses)
-	assert.Nil(t, err)
+	server := tests.NewServer(t).Handle(`choco.exe`, tests.Reply{})
+	r := startRunner(t, server)
 	config := v1alpha1.AuxiliarySpec{ChocoPackages: &[]string{"vim", "grep"}}
 	assert.Nil(t, r.InstallChocoPackages(*config.ChocoPackages))
+	server.AssertCommands(t, `choco.exe --version`, `choco.exe install --accept-licenses --yes vim`, `choco.exe install --accept-licenses --yes grep`)
 }
 
 func TestEnableRDP(t *testing.T) {
 	var defaultTrue = true
-	responses := &[]tests.Response{
-		{
-			Response: "",
-			Error:    nil,
-		},
-	}
-	port += 1
-	r, err := startRunner(responses)
-	assert.Nil(t, err)
+	server := tests.NewServer(t).Handle(`fDenyTSConnections`, tests.Reply{})
+	r := startRunner(t, server)
 	config := v1alpha1.AuxiliarySpec{EnableRDP: &defaultTrue}
 	assert.Nil(t, r.EnableRDP(*config.EnableRDP))
+	server.AssertCommands(t, `-name 'fDenyTSConnections' -value 0;\s+Enable-NetFirewallRule -DisplayGroup 'Remote Desktop'`)
 }
 
-func TestInstallContainerdSkip(t *testing.T) {
-	responses := &[]tests.Response{
-		{
-			Response: "Running",
-			Error:    nil,
-		},
-		{
-			Response: "",
-			Error:    errors.New("error"),
-		},
+func TestMountShares(t *testing.T) {
+	server := tests.NewServer(t).
+		Handle(`virtiofs\.exe`, tests.Reply{}).
+		Handle(`New-SmbGlobalMapping`, tests.Reply{})
+	r := startRunner(t, server)
+	shares := []v1alpha1.ShareSpec{
+		{Name: "images", HostPath: "/srv/images", DriveLetter: "S", Protocol: v1alpha1.ShareVirtioFS},
+		{Name: "data", HostPath: "/srv/data", DriveLetter: "T", Protocol: v1alpha1.ShareSMB, Username: "swdt", Password: "secret"},
 	}
-	port += 1
-	r, err := startRunner(responses)
-	assert.Nil(t, err)
+	assert.Nil(t, r.MountShares(shares))
+	server.AssertCommands(t,
+		`'Drive' = 'S'\n  'Tag' = 'images'`,
+		`'Drive' = 'T'\n  'Password' = 'secret'\n  'Server' = ''\n  'Share' = 'data'\n  'Username' = 'swdt'`)
+}
+
+func TestMountSharesFailure(t *testing.T) {
+	server := tests.NewServer(t).Handle(`virtiofs\.exe`, tests.Reply{Stderr: "virtiofs.exe is missing", ExitCode: 1})
+	r := startRunner(t, server)
+	err := r.MountShares([]v1alpha1.ShareSpec{{Name: "images", DriveLetter: "S", Protocol: v1alpha1.ShareVirtioFS}})
+	assert.ErrorContains(t, err, "failed mounting the share images")
+}
+
+func TestInstallContainerdSkip(t *testing.T) {
+	server := tests.NewServer(t).Handle(`get-service -name containerd`, tests.Reply{Stdout: "Running"})
+	r := startRunner(t, server)
 	config := v1alpha1.ClusterSpec{CalicoVersion: "v3.27"}
-	err = r.InstallContainerd(config.CalicoVersion)
+	err := r.InstallContainerd(config.CalicoVersion)
 	assert.Nil(t, err)
+	server.AssertNotReceived(t, `Install-Containerd`)
 }
 
 func TestInstallContainerdRunning(t *testing.T) {
-	responses := &[]tests.Response{
-		{
-			Response: "",
-			Error:    errors.New(""),
-		},
-		{
-			Response: "",
-			Error:    nil,
-		},
-	}
-
-	port += 1
-	r, err := startRunner(responses)
-	assert.Nil(t, err)
-	err = r.InstallContainerd("v3.27")
+	server := tests.NewServer(t).
+		Handle(`get-service -name containerd`, tests.Reply{Stderr: "Cannot find any service", ExitCode: 1}).
+		Handle(`Install-Containerd.ps1`, tests.Reply{})
+	r := startRunner(t, server)
+	err := r.InstallContainerd("v3.27")
 	assert.Nil(t, err)
+	server.AssertCommands(t, `get-service -name containerd`, `\.\\Install-Containerd\.ps1 -ContainerDVersion v3\.27`)
 }
 
 func TestInstallKubernetes(t *testing.T) {
-	responses := &[]tests.Response{
-		{
-			Response: "",
-			Error:    errors.New(""),
-			Cmd:      "get-service -name kubelet",
-		},
-		{
-			Response: "",
-			Error:    nil,
-			Cmd:      ".\\PrepareNode.ps1 -KubernetesVersion v1.29.0",
-		},
-	}
-	port += 1
-	r, err := startRunner(responses)
-	assert.Nil(t, err)
+	server := tests.NewServer(t).
+		Handle(`get-service -name kubelet`, tests.Reply{ExitCode: 1}).
+		Handle(`PrepareNode.ps1`, tests.Reply{})
+	r := startRunner(t, server)
 
-	err = r.InstallKubernetes("v1.29.0")
+	err := r.InstallKubernetes("v1.29.0")
 	assert.Nil(t, err)
+	server.AssertCommands(t, `get-service -name kubelet`, `\.\\PrepareNode\.ps1 -KubernetesVersion v1\.29\.0`)
 }
 
 func TestJoinNodeRunner(t *testing.T) {
-	responses := &[]tests.Response{
-		{
-			Response: "Stopped",
-			Error:    nil,
-			Cmd:      "get-service -name kubelet",
-		},
-		{
-			Response: "",
-			Error:    nil,
-			Cmd:      "mkdir",
-		},
-		{
-			Response: "",
-			Error:    nil,
-			Cmd:      "Add-content",
-		},
-		{
-			Response: "",
-			Error:    nil,
-			Cmd:      "$env:Path",
-		},
-	}
-	port += 1
-	r, err := startRunner(responses)
+	server := tests.NewServer(t).
+		Handle(`get-service -name kubelet`, tests.Reply{Stdout: "Stopped"}).
+		Handle(`mkdir`, tests.Reply{}).
+		Handle(`Add-Content`, tests.Reply{}).
+		Handle(`\$env:Path`, tests.Reply{})
+	r := startRunner(t, server)
+	err := r.JoinNode("v1.29.0", "192.168.0.1")
 	assert.Nil(t, err)
-	err = r.JoinNode("v1.29.0", "192.168.0.1")
+	server.AssertCommands(t, `get-service -name kubelet`, `mkdir c:\\var\\lib\\minikube\\certs`,
+		`'Address' = '192\.168\.0\.1'\n  'Hostname' = 'control-plane\.minikube\.internal'`, `\$env:Path \+= ';c:\\k\\'`)
+}
+
+func TestSetupWindowsHost(t *testing.T) {
+	host := tests.NewWindowsHost(t)
+	r := startRunner(t, host.Server)
+	join := "kubeadm join 192.168.0.1:8443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234"
+	r.SetLocal(exec.NewDryRunLocalExecutor(&exec.Plan{}, exec.Result{Match: regexp.MustCompile(`token create`), Output: join}))
+
+	assert.False(t, r.ChocoExists())
+	assert.Nil(t, r.InstallChoco())
+	assert.Nil(t, r.InstallChocoPackages([]string{"vim", "grep"}))
+	assert.Equal(t, []string{"grep", "vim"}, host.Packages())
+
+	assert.Nil(t, r.EnableRDP(true))
+	value, _ := host.Registry(tests.RDPKey)
+	assert.Equal(t, "0", value)
+	assert.True(t, host.FirewallEnabled("Remote Desktop"))
+
+	assert.Nil(t, r.InstallContainerd("1.7.14"))
+	assert.Nil(t, r.InstallKubernetes("v1.29.0"))
+	status, _ := host.Service("containerd")
+	assert.Equal(t, tests.ServiceRunning, status)
+	status, _ = host.Service("kubelet")
+	assert.Equal(t, tests.ServiceStopped, status)
+
+	assert.Nil(t, r.JoinNode("v1.29.0", "192.168.0.1"))
+	status, _ = host.Service("kubelet")
+	assert.Equal(t, tests.ServiceRunning, status)
+	assert.Equal(t, "192.168.0.1:8443", host.Joined())
+	hosts, _ := host.File(`C:\Windows\System32\drivers\etc\hosts`)
+	assert.Equal(t, "192.168.0.1 control-plane.minikube.internal\r\n", string(hosts))
+	assert.True(t, host.Exists(`c:\var\lib\minikube\certs`))
+
+	// a second run skips the installed steps
+	assert.Nil(t, r.InstallChoco())
+	assert.Nil(t, r.InstallContainerd("1.7.14"))
+	assert.Nil(t, r.InstallKubernetes("v1.29.0"))
+	assert.Nil(t, r.JoinNode("v1.29.0", "192.168.0.1"))
+	assert.Equal(t, 1, host.Received(`community\.chocolatey\.org`))
+	assert.Equal(t, 1, host.Received(`Install-Containerd\.ps1 -`))
+	assert.Equal(t, 1, host.Received(`kubeadm join`))
+}
+
+func TestWindowsHostErrors(t *testing.T) {
+	host := tests.NewWindowsHost(t)
+	r := startRunner(t, host.Server)
+
+	err := r.InstallChocoPackages([]string{"vim"})
+	assert.EqualError(t, err, "choco not installed. Skipping package installation")
+
+	err = r.runR("Start-Service -Name kubelet")
+	var remote *exec.RemoteError
+	assert.ErrorAs(t, err, &remote)
+	assert.Equal(t, "NoServiceFoundForGivenName", remote.ErrorID)
+	assert.Equal(t, 1, remote.Line)
+
+	err = r.runR("mkdir c:\\k -Force\nStop-Service -Name kubelet -Force")
+	assert.ErrorAs(t, err, &remote)
+	assert.Equal(t, 2, remote.Line)
+	assert.True(t, host.Exists(`C:\k`))
+}
+
+// startReplay returns a runner answering the commands from the cassette, regenerate
+// it from a real node with `swdt setup --record <file>`.
+func startReplay(t *testing.T, file string) (*Runner, *exec.Cassette) {
+	cassette, err := exec.LoadCassette(file)
 	assert.Nil(t, err)
+	return &Runner{remote: exec.NewReplayingExecutor(cassette), local: exec.NewReplayingLocalExecutor(cassette)}, cassette
+}
+
+func TestSetupFromCassette(t *testing.T) {
+	r, cassette := startReplay(t, "testdata/setup.yaml")
+	assert.Nil(t, r.InstallChocoPackages([]string{"vim", "grep"}))
+	// containerd service is missing and gets installed
+	assert.Nil(t, r.InstallContainerd("1.7.14"))
+	// kubelet service exists, installation is skipped
+	assert.Nil(t, r.InstallKubernetes("v1.29.0"))
+	assert.Empty(t, cassette.Pending())
 }
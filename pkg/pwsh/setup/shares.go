@@ -0,0 +1,53 @@
+package setup
+
+import (
+	"fmt"
+	"swdt/apis/config/v1alpha1"
+
+	"k8s.io/klog/v2"
+)
+
+// mountVirtioFS starts virtiofs.exe of the virtio-win guest tools from a startup task,
+// so the drive is mounted again at every boot. A mounted drive is kept.
+const mountVirtioFS = `param($Tag, $Drive)
+	if (Test-Path "${Drive}:\") { return }
+	$virtiofs = Join-Path $env:ProgramFiles 'Virtio-Win\VioFS\virtiofs.exe'
+	if (-not (Test-Path $virtiofs)) { throw "$virtiofs is missing, install the virtio-win guest tools and WinFsp" }
+	$task = "swdt-share-$Tag"
+	$action = New-ScheduledTaskAction -Execute $virtiofs -Argument "-t $Tag -m ${Drive}:"
+	$settings = New-ScheduledTaskSettingsSet -ExecutionTimeLimit ([TimeSpan]::Zero)
+	Register-ScheduledTask -TaskName $task -Action $action -Trigger (New-ScheduledTaskTrigger -AtStartup) -Settings $settings -User SYSTEM -RunLevel Highest -Force | Out-Null
+	Start-ScheduledTask -TaskName $task
+	for ($i = 0; $i -lt 30 -and -not (Test-Path "${Drive}:\"); $i++) { Start-Sleep -Seconds 1 }
+	if (-not (Test-Path "${Drive}:\")) { throw "share $Tag is not mounted at ${Drive}:" }`
+
+// mountSMB maps the Samba share for every session, services included. The server is
+// the default gateway of the node when empty. A mapped drive is kept.
+const mountSMB = `param($Share, $Server, $Drive, $Username, $Password)
+	if (Get-SmbGlobalMapping -LocalPath "${Drive}:" -ErrorAction SilentlyContinue) { return }
+	if (-not $Server) {
+		$Server = (Get-NetRoute -DestinationPrefix '0.0.0.0/0' | Sort-Object RouteMetric | Select-Object -First 1).NextHop
+	}
+	$credential = New-Object System.Management.Automation.PSCredential($Username, (ConvertTo-SecureString $Password -AsPlainText -Force))
+	New-SmbGlobalMapping -RemotePath "\\$Server\$Share" -LocalPath "${Drive}:" -Credential $credential -Persistent $true | Out-Null`
+
+// MountShares mounts the host directories at their drive letter.
+func (r *Runner) MountShares(shares []v1alpha1.ShareSpec) error {
+	for _, share := range shares {
+		klog.Info(mainc.Sprintf("Mounting the share %s at %s:.", share.Name, share.DriveLetter))
+		var err error
+		switch share.Protocol {
+		case v1alpha1.ShareSMB:
+			err = r.runRparams(mountSMB, map[string]string{
+				"Share": share.Name, "Server": share.Server, "Drive": share.DriveLetter,
+				"Username": share.Username, "Password": share.Password,
+			})
+		default:
+			err = r.runRparams(mountVirtioFS, map[string]string{"Tag": share.Name, "Drive": share.DriveLetter})
+		}
+		if err != nil {
+			return fmt.Errorf("failed mounting the share %s: %w", share.Name, err)
+		}
+	}
+	return nil
+}
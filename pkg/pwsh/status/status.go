@@ -0,0 +1,131 @@
+package status
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"swdt/pkg/config"
+	"swdt/pkg/executors/exec"
+	"swdt/pkg/executors/iface"
+)
+
+const (
+	NodeReady    = "Ready"
+	NodeNotReady = "NotReady"
+
+	ServiceNotFound = "NotFound"
+	StatusUnknown   = "Unknown"
+)
+
+// serviceStatus prints the status of the service, like Running.
+const serviceStatus = `param($Name) (Get-Service -Name $Name -ErrorAction Stop).Status.ToString()`
+
+// Runner probes the state of the Windows node and the control plane.
+type Runner struct {
+	Profile string // minikube profile of the control plane, also the kubectl context
+	remote  iface.SSHExecutor
+	local   iface.LocalExecutor
+}
+
+func (r *Runner) SetLocal(executor iface.LocalExecutor) {
+	r.local = executor
+}
+
+func (r *Runner) SetRemote(executor iface.SSHExecutor) {
+	r.remote = executor
+}
+
+// runLout runs a local command returning its output, it is returned on failures too
+// since the status commands exit with an error for stopped components.
+func (r *Runner) runLout(args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	err := r.local.Run(iface.NewCommand(args[0], args[1:]...), iface.Streams{Stdout: &stdout})
+	return stdout.Bytes(), err
+}
+
+// runRparams runs a remote script binding the named parameters, returning its output.
+func (r *Runner) runRparams(script string, params map[string]string) (string, error) {
+	var stdout bytes.Buffer
+	err := r.remote.RunWithParams(script, params, iface.Streams{Stdout: &stdout})
+	return strings.TrimSpace(stdout.String()), err
+}
+
+// Service returns the status of a Windows service, like Running, or NotFound when
+// the service is not installed.
+func (r *Runner) Service(name string) (string, error) {
+	status, err := r.runRparams(serviceStatus, map[string]string{"Name": name})
+	var remote *exec.RemoteError
+	if errors.As(err, &remote) && strings.HasPrefix(remote.ErrorID, "NoServiceFoundForGivenName") {
+		// the error ID is qualified by the command, like NoServiceFoundForGivenName,Microsoft.PowerShell.Commands.GetServiceCommand
+		return ServiceNotFound, nil
+	} else if err != nil {
+		return StatusUnknown, err
+	} else if status == "" {
+		return StatusUnknown, fmt.Errorf("no status for the service %s", name)
+	}
+	return status, nil
+}
+
+// nodeList holds the fields read from kubectl get nodes.
+type nodeList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Status struct {
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// WindowsNodes returns the Ready condition of the Windows nodes by name.
+func (r *Runner) WindowsNodes() (map[string]string, error) {
+	output, err := r.runLout(config.KubectlCommand(r.Profile, "get", "nodes", "-l", "kubernetes.io/os=windows", "-o", "json")...)
+	if err != nil {
+		return nil, err
+	}
+	var list nodeList
+	if err = json.Unmarshal(output, &list); err != nil {
+		return nil, fmt.Errorf("failed parsing the nodes: %w", err)
+	}
+	nodes := make(map[string]string, len(list.Items))
+	for _, node := range list.Items {
+		nodes[node.Metadata.Name] = StatusUnknown
+		for _, condition := range node.Status.Conditions {
+			if condition.Type != "Ready" {
+				continue
+			}
+			switch condition.Status {
+			case "True":
+				nodes[node.Metadata.Name] = NodeReady
+			case "False":
+				nodes[node.Metadata.Name] = NodeNotReady
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// Minikube returns the status of the minikube components, like Host and APIServer.
+func (r *Runner) Minikube() (map[string]string, error) {
+	output, err := r.runLout(config.MinikubeCommand(r.Profile, "status", "-o", "json")...)
+	var components map[string]interface{}
+	if jerr := json.Unmarshal(output, &components); jerr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed parsing the minikube status: %w", jerr)
+	}
+	status := make(map[string]string, len(components))
+	for name, value := range components {
+		if s, ok := value.(string); ok && name != "Name" {
+			status[name] = s
+		}
+	}
+	return status, nil
+}
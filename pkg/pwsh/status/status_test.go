@@ -0,0 +1,90 @@
+package status
+
+import (
+	"errors"
+	"regexp"
+	"swdt/pkg/executors/exec"
+	"swdt/pkg/executors/tests"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const nodes = `{"items": [
+	{"metadata": {"name": "win-ready"}, "status": {"conditions": [{"type": "MemoryPressure", "status": "False"}, {"type": "Ready", "status": "True"}]}},
+	{"metadata": {"name": "win-joining"}, "status": {"conditions": [{"type": "Ready", "status": "False"}]}},
+	{"metadata": {"name": "win-lost"}, "status": {"conditions": [{"type": "Ready", "status": "Unknown"}]}}
+]}`
+
+// startRunner returns a runner connected to the fake host, the local commands return the results.
+func startRunner(t *testing.T, host *tests.WindowsHost, results ...exec.Result) *Runner {
+	sshExec := exec.NewSSHExecutor(host.Credentials())
+	assert.Nil(t, sshExec.Connect())
+	t.Cleanup(func() { _ = sshExec.Close() })
+	return &Runner{remote: sshExec, local: exec.NewDryRunLocalExecutor(&exec.Plan{}, results...)}
+}
+
+func TestService(t *testing.T) {
+	host := tests.NewWindowsHost(t)
+	host.SetService("containerd", tests.ServiceRunning)
+	host.SetService("kubelet", tests.ServiceStopped)
+	r := startRunner(t, host)
+
+	for name, expected := range map[string]string{"containerd": "Running", "kubelet": "Stopped", "docker": ServiceNotFound} {
+		status, err := r.Service(name)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, status, name)
+	}
+}
+
+func TestServiceQualifiedErrorID(t *testing.T) {
+	// a real host qualifies the error ID with the command
+	record := `#SWDT-ERROR#{"category":"ObjectNotFound","message":"Cannot find any service with service name 'docker'.","errorId":"NoServiceFoundForGivenName,Microsoft.PowerShell.Commands.GetServiceCommand","line":1}`
+	server := tests.NewServer(t).Handle(`Get-Service -Name \$Name`, tests.Reply{Stderr: record, ExitCode: 1})
+	sshExec := exec.NewSSHExecutor(server.Credentials())
+	assert.Nil(t, sshExec.Connect())
+	t.Cleanup(func() { _ = sshExec.Close() })
+	r := &Runner{remote: sshExec}
+
+	status, err := r.Service("docker")
+	assert.Nil(t, err)
+	assert.Equal(t, ServiceNotFound, status)
+	server.AssertCommands(t, `'Name' = 'docker'`)
+}
+
+func TestWindowsNodes(t *testing.T) {
+	r := startRunner(t, tests.NewWindowsHost(t), exec.Result{Match: regexp.MustCompile(`kubectl get nodes`), Output: nodes})
+	found, err := r.WindowsNodes()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"win-ready": NodeReady, "win-joining": NodeNotReady, "win-lost": StatusUnknown}, found)
+
+	r = startRunner(t, tests.NewWindowsHost(t), exec.Result{Match: regexp.MustCompile(`kubectl`), Err: errors.New("connection refused")})
+	_, err = r.WindowsNodes()
+	assert.EqualError(t, err, "connection refused")
+}
+
+func TestMinikube(t *testing.T) {
+	// minikube exits with an error when a component is stopped, the status is still printed
+	stopped := `{"Name":"minikube","Host":"Running","Kubelet":"Stopped","APIServer":"Stopped","Kubeconfig":"Configured","Worker":false}`
+	r := startRunner(t, tests.NewWindowsHost(t), exec.Result{Match: regexp.MustCompile(`minikube status`), Output: stopped, Err: errors.New("exit status 7")})
+	found, err := r.Minikube()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"Host": "Running", "Kubelet": "Stopped", "APIServer": "Stopped", "Kubeconfig": "Configured"}, found)
+
+	r = startRunner(t, tests.NewWindowsHost(t), exec.Result{Match: regexp.MustCompile(`minikube status`), Err: errors.New("minikube not found")})
+	_, err = r.Minikube()
+	assert.EqualError(t, err, "minikube not found")
+}
+
+func TestProfile(t *testing.T) {
+	r := startRunner(t, tests.NewWindowsHost(t),
+		exec.Result{Match: regexp.MustCompile(`^minikube -p swdt-dev status`), Output: `{"Host":"Running"}`},
+		exec.Result{Match: regexp.MustCompile(`^kubectl --context swdt-dev get nodes`), Output: nodes})
+	r.Profile = "swdt-dev"
+	found, err := r.Minikube()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"Host": "Running"}, found)
+	windows, err := r.WindowsNodes()
+	assert.Nil(t, err)
+	assert.Len(t, windows, 3)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"path/filepath"
 
 	"text/template"
 )
@@ -54,12 +55,24 @@ func GetSpecAffinity() (content []byte) {
 	return
 }
 
+// tempPattern names the files written by SaveFile, so the leftover ones are found.
+const tempPattern = "swdt-*.yaml"
+
+// tempDir holds the files written by SaveFile.
+var tempDir = "/tmp"
+
 func SaveFile(content string) string {
-	fd, _ := os.CreateTemp("/tmp", "*.yaml")
+	fd, _ := os.CreateTemp(tempDir, tempPattern)
+	defer fd.Close()
 	_, _ = fd.WriteString(content)
 	return fd.Name()
 }
 
+// TempFiles returns the files written by SaveFile and not deleted yet.
+func TempFiles() ([]string, error) {
+	return filepath.Glob(filepath.Join(tempDir, tempPattern))
+}
+
 func DeleteFile(filename string) {
 	os.Remove(filename)
 }
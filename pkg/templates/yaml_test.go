@@ -5,17 +5,17 @@ import (
 	"testing"
 )
 
-var filepath = "./testdata/kube-proxy.yml"
+var kubeProxyFile = "./testdata/kube-proxy.yml"
 
 func TestOpenYAML(t *testing.T) {
-	content, err := OpenYAMLFile(filepath)
+	content, err := OpenYAMLFile(kubeProxyFile)
 	assert.Nil(t, err)
 	assert.Greater(t, len(content), 0)
 	assert.Contains(t, string(content), "{{.KUBERNETES_VERSION}}")
 }
 
 func TestRenderTemplate(t *testing.T) {
-	content, err := OpenYAMLFile(filepath)
+	content, err := OpenYAMLFile(kubeProxyFile)
 	assert.Nil(t, err)
 
 	var version string = "v1.19.0"
@@ -24,3 +24,18 @@ func TestRenderTemplate(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Contains(t, output, version)
 }
+
+func TestTempFiles(t *testing.T) {
+	tempDir = t.TempDir()
+	t.Cleanup(func() { tempDir = "/tmp" })
+
+	name := SaveFile("kind: ConfigMap")
+	files, err := TempFiles()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{name}, files)
+
+	DeleteFile(name)
+	files, err = TempFiles()
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+}